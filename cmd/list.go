@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	listSince  string
+	listUntil  string
+	listStatus string
+	listPrompt string
+	listJSON   bool
+)
+
+var listCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List past sessions and process runs",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		cfg.ExpandPaths()
+		cfg.ApplyDefaults()
+
+		filter := session.IndexFilter{Status: listStatus, Prompt: listPrompt}
+		if filter.Since, err = parseListDate("since", listSince); err != nil {
+			return err
+		}
+		if filter.Until, err = parseListDate("until", listUntil); err != nil {
+			return err
+		}
+
+		entries, err := session.ReadIndex(cfg)
+		if err != nil {
+			return err
+		}
+
+		matching := []session.IndexEntry{}
+		for _, entry := range entries {
+			if filter.Match(entry) {
+				matching = append(matching, entry)
+			}
+		}
+
+		if listJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(matching)
+		}
+
+		if len(matching) == 0 {
+			fmt.Println("No sessions found")
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TITLE\tSOURCE\tSTATUS\tDURATION\tPROMPT\tNOTE")
+		for _, entry := range matching {
+			duration := "-"
+			if entry.DurationSeconds > 0 {
+				duration = seconds(entry.DurationSeconds).String()
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Title, entry.Source, entry.Status, duration, entry.PromptTemplate, entry.NotePath)
+		}
+		return w.Flush()
+	},
+}
+
+func parseListDate(flag, value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid --%s date %q (expected YYYY-MM-DD)", flag, value)
+	}
+	return t, nil
+}
+
+func init() {
+	listCmd.Flags().StringVar(&listSince, "since", "", "Only sessions started on or after this date (YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listUntil, "until", "", "Only sessions started on or before this date (YYYY-MM-DD)")
+	listCmd.Flags().StringVar(&listStatus, "status", "", "Only sessions with this status (recording, summarizing, summarized, summary_failed, recovering)")
+	listCmd.Flags().StringVar(&listPrompt, "prompt", "", "Only sessions summarized with this prompt template")
+	listCmd.Flags().BoolVar(&listJSON, "json", false, "Print sessions as JSON")
+	rootCmd.AddCommand(listCmd)
+}
@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var recoverCmd = &cobra.Command{
+	Use:   "recover",
+	Short: "Finish sessions whose recording process died",
+	Long:  `Transcribe the chunks left behind by sessions whose recording process died (out of memory, logout, reboot) and generate their summaries, as if they had been stopped normally.`,
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		cfg.ExpandPaths()
+		cfg.ApplyDefaults()
+
+		if _, err := session.StashStaleSession(cfg); err != nil {
+			return err
+		}
+		if _, err := session.StashOrphanedChunks(cfg); err != nil {
+			return err
+		}
+
+		recoverable, err := session.ListRecoverable(cfg)
+		if err != nil {
+			return err
+		}
+		if len(recoverable) == 0 {
+			fmt.Println("No sessions to recover")
+			return nil
+		}
+
+		var failed int
+		for _, rec := range recoverable {
+			fmt.Printf("Recovering %s...\n", rec.Lock.Title)
+			if err := session.Recover(context.Background(), rec, cfg); err != nil {
+				fmt.Printf("Failed to recover %s: %v\n", rec.Lock.Title, err)
+				failed++
+				continue
+			}
+			fmt.Printf("Generating summary for %s in the background\n", rec.Lock.Path)
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d session(s) could not be recovered; run `trani recover` again to retry", failed)
+		}
+		return nil
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(recoverCmd)
+}
@@ -0,0 +1,38 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var resumeCmd = &cobra.Command{
+	Use:   "resume",
+	Short: "Resume a paused recording session",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		cfg.ExpandPaths()
+		cfg.ApplyDefaults()
+
+		lock, err := session.ReadLock(cfg)
+		if err != nil {
+			return err
+		}
+		if lock == nil {
+			return fmt.Errorf("no active session found")
+		}
+
+		return session.SignalResume(lock)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(resumeCmd)
+}
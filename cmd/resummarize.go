@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"context"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var (
+	resummarizePrompt  string
+	resummarizeReplace bool
+)
+
+var resummarizeCmd = &cobra.Command{
+	Use:   "resummarize <note-or-title>",
+	Short: "Generate a session's summary again from its existing transcript",
+	Long:  `Generate a session's summary again from its saved transcript (.sources/<title>.txt) and the note's current content, without re-recording or re-transcribing anything. Useful after a failed summary (bad API key, rate limit, empty response) or to try a different prompt.`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		cfg.ExpandPaths()
+		cfg.ApplyDefaults()
+
+		return session.Resummarize(
+			context.Background(),
+			args[0],
+			resummarizePrompt,
+			resummarizeReplace,
+			cfg,
+		)
+	},
+}
+
+func init() {
+	resummarizeCmd.Flags().StringVar(&resummarizePrompt, "prompt", "", "Prompt template name (default: the one the session was summarized with)")
+	resummarizeCmd.Flags().BoolVar(&resummarizeReplace, "replace", false, "Replace the note's existing summary instead of appending another one")
+	rootCmd.AddCommand(resummarizeCmd)
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/session"
+	"github.com/spf13/cobra"
+)
+
+var statusJSON bool
+
+var statusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show the active recording and any summaries still being generated",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := config.Load()
+		if err != nil {
+			return err
+		}
+
+		cfg.ExpandPaths()
+		cfg.ApplyDefaults()
+
+		status, err := session.ReadStatus(cfg)
+		if err != nil {
+			return err
+		}
+
+		if statusJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			return encoder.Encode(status)
+		}
+
+		printStatus(status)
+		return nil
+	},
+}
+
+func printStatus(status *session.Status) {
+	if rec := status.Recording; rec != nil {
+		state := "recording"
+		if rec.Paused {
+			state = "paused"
+		}
+		fmt.Printf("Recording: %s (%s)\n", rec.Title, state)
+		fmt.Printf("  Elapsed:  %s\n", seconds(rec.ElapsedSeconds))
+		if rec.Mode != "" {
+			fmt.Printf("  Mode:     %s\n", rec.Mode)
+		}
+		fmt.Printf("  Prompt:   %s\n", rec.Prompt)
+		fmt.Printf("  Chunks:   %d of %d closed transcribed\n", rec.ChunksTranscribed, rec.ChunksClosed)
+		if rec.LastChunkSpeech != nil {
+			fmt.Printf("  Speech:   %.0f%% of the last chunk\n", *rec.LastChunkSpeech*100)
+		}
+		if rec.ChunksQueued > 0 {
+			fmt.Printf("  Queued:   %d failed, retrying\n", rec.ChunksQueued)
+		}
+		if rec.RollingSummary != "" {
+			fmt.Printf("  Summary so far (%s): %s\n", rec.RollingSummaryAt.Format("15:04:05"), rec.RollingSummary)
+		}
+		if rec.LastChunkError != "" {
+			fmt.Printf("  Last chunk error (%s): %s\n", rec.LastChunkErrorAt.Format("15:04:05"), rec.LastChunkError)
+		}
+	} else {
+		fmt.Println("No active recording")
+	}
+
+	if len(status.Postprocess) == 0 {
+		return
+	}
+	fmt.Println()
+	fmt.Println("Postprocessing:")
+	for _, job := range status.Postprocess {
+		fmt.Printf("  %s: %s (%s)\n", job.Title, job.Stage, seconds(job.ElapsedSeconds))
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second)).Round(time.Second)
+}
+
+func init() {
+	statusCmd.Flags().BoolVar(&statusJSON, "json", false, "Print status as JSON")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -0,0 +1,54 @@
+package audio
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Decode converts any audio file ffmpeg can read (MP3, FLAC, Opus, M4A,
+// WAV at other bit depths, ...) to a 16-bit PCM WAV at dst, keeping its
+// sample rate and channels. The rest of the pipeline only reads 16-bit
+// PCM WAV.
+func Decode(ctx context.Context, src, dst string) error {
+	output, err := exec.CommandContext(
+		ctx,
+		"ffmpeg",
+		"-hide_banner", "-loglevel", "error",
+		"-i", src,
+		"-vn", "-acodec", "pcm_s16le",
+		"-y", dst,
+	).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed to decode %s: %w: %s", src, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// archiveCodecArgs are the ffmpeg encoder settings for each compressed
+// archive format, keyed by file extension. 24 kbps Opus is transparent for
+// 16 kHz mono speech at a fraction of FLAC's size.
+var archiveCodecArgs = map[string][]string{
+	".flac": {"-c:a", "flac", "-compression_level", "8"},
+	".opus": {"-c:a", "libopus", "-b:a", "24k", "-application", "voip"},
+}
+
+// Encode compresses the WAV file at src into dst, picking the codec from
+// dst's extension (.flac or .opus).
+func Encode(ctx context.Context, src, dst string) error {
+	codec, ok := archiveCodecArgs[filepath.Ext(dst)]
+	if !ok {
+		return fmt.Errorf("unsupported archive format %q", filepath.Ext(dst))
+	}
+
+	args := append([]string{"-hide_banner", "-loglevel", "error", "-i", src}, codec...)
+	args = append(args, "-y", dst)
+
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("ffmpeg failed to encode %s: %w: %s", dst, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
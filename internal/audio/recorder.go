@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 
@@ -20,11 +21,18 @@ import (
 // Each stream is segmented into fixed-length chunks by ffmpeg as it
 // records, so a chunker can pick up and transcribe finished segments
 // progressively instead of waiting for the whole session to end.
+//
+// Pausing stops both ffmpeg processes and resuming starts new ones, so a
+// session can span several capture runs. ffmpeg always truncates its
+// segment list when it starts, it can't append to an existing one, so every
+// run after the first writes its own list and chunk files (see
+// MicSegmentLists).
 type Recorder struct {
 	tempDir      string
 	mode         string
 	micDevice    string
 	chunkSeconds int
+	run          int
 
 	micCmd    *exec.Cmd
 	systemCmd *exec.Cmd
@@ -56,24 +64,73 @@ func (r *Recorder) HasSystemAudio() bool {
 
 // MicChunkPattern is the ffmpeg segment output pattern for mic chunks.
 func (r *Recorder) MicChunkPattern() string {
-	return filepath.Join(r.tempDir, "chunk-mic-%03d.wav")
+	return runChunkPattern(r.tempDir, "mic", 0)
 }
 
 // MicSegmentList is the path ffmpeg appends a line to every time it closes
 // a mic chunk.
 func (r *Recorder) MicSegmentList() string {
-	return filepath.Join(r.tempDir, "chunk-mic-segments.txt")
+	return runSegmentList(r.tempDir, "mic", 0)
+}
+
+// MicSegmentLists returns the mic segment list of every capture run so
+// far, first run first. Reading them in order yields the session's chunks
+// in recording order, across any pauses.
+func (r *Recorder) MicSegmentLists() []string {
+	return segmentLists(r.tempDir, "mic")
 }
 
 // SystemChunkPattern is the ffmpeg segment output pattern for system chunks.
 func (r *Recorder) SystemChunkPattern() string {
-	return filepath.Join(r.tempDir, "chunk-system-%03d.wav")
+	return runChunkPattern(r.tempDir, "system", 0)
 }
 
 // SystemSegmentList is the path ffmpeg appends a line to every time it
 // closes a system audio chunk.
 func (r *Recorder) SystemSegmentList() string {
-	return filepath.Join(r.tempDir, "chunk-system-segments.txt")
+	return runSegmentList(r.tempDir, "system", 0)
+}
+
+// SystemSegmentLists is MicSegmentLists for the system audio stream.
+func (r *Recorder) SystemSegmentLists() []string {
+	return segmentLists(r.tempDir, "system")
+}
+
+// runChunkPattern and runSegmentList name the files of a capture run. The
+// first run keeps the plain names (MicChunkPattern, MicSegmentList, ...);
+// later runs, started by Resume, get a zero-padded run number so their
+// lists sort in run order and their chunks never overwrite earlier ones.
+func runChunkPattern(tempDir, stream string, run int) string {
+	if run == 0 {
+		return filepath.Join(tempDir, "chunk-"+stream+"-%03d.wav")
+	}
+	return filepath.Join(tempDir, fmt.Sprintf("chunk-%s-run%03d-%%03d.wav", stream, run))
+}
+
+func runSegmentList(tempDir, stream string, run int) string {
+	if run == 0 {
+		return filepath.Join(tempDir, "chunk-"+stream+"-segments.txt")
+	}
+	return filepath.Join(tempDir, fmt.Sprintf("chunk-%s-segments-run%03d.txt", stream, run))
+}
+
+func segmentLists(tempDir, stream string) []string {
+	lists := []string{runSegmentList(tempDir, stream, 0)}
+
+	// The pattern is fixed and valid, so Glob can't fail; lexical order is
+	// run order thanks to the zero padding.
+	resumed, _ := filepath.Glob(filepath.Join(tempDir, "chunk-"+stream+"-segments-run*.txt"))
+	sort.Strings(resumed)
+
+	return append(lists, resumed...)
+}
+
+// removeSegmentLists clears every segment list a previous session may have
+// left behind, so its chunks are never mistaken for this session's.
+func removeSegmentLists(tempDir, stream string) {
+	for _, list := range segmentLists(tempDir, stream) {
+		os.Remove(list)
+	}
 }
 
 func activeMonitorSource() (string, error) {
@@ -135,14 +192,41 @@ func startSegmentedCapture(ctx context.Context, source string, chunkSeconds int,
 // output monitor in parallel, as two independent direct streams segmented
 // into chunks.
 func (r *Recorder) Start(ctx context.Context) error {
+	removeSegmentLists(r.tempDir, "mic")
+	removeSegmentLists(r.tempDir, "system")
+
+	r.run = 0
+	return r.startRun(ctx)
+}
+
+// Pause stops capturing without ending the session, letting ffmpeg finalize
+// (and list) whatever chunk was still open, same as Stop. Resume picks up
+// again in a new capture run.
+func (r *Recorder) Pause() error {
+	return r.Stop()
+}
+
+// Resume starts a new capture run after Pause. Its chunks land in their own
+// segment lists, after the ones already recorded.
+func (r *Recorder) Resume(ctx context.Context) error {
+	if r.micCmd != nil {
+		return fmt.Errorf("recording is not paused")
+	}
+
+	r.run++
+	return r.startRun(ctx)
+}
+
+func (r *Recorder) startRun(ctx context.Context) error {
 	micSource, err := activeMicSource(r.micDevice)
 	if err != nil {
 		return fmt.Errorf("failed to resolve microphone source: %w", err)
 	}
 
-	os.Remove(r.MicSegmentList())
+	micList := runSegmentList(r.tempDir, "mic", r.run)
+	os.Remove(micList)
 
-	micCmd, err := startSegmentedCapture(ctx, micSource, r.chunkSeconds, r.MicSegmentList(), r.MicChunkPattern())
+	micCmd, err := startSegmentedCapture(ctx, micSource, r.chunkSeconds, micList, runChunkPattern(r.tempDir, "mic", r.run))
 	if err != nil {
 		return fmt.Errorf("failed to start microphone recording: %w", err)
 	}
@@ -159,9 +243,10 @@ func (r *Recorder) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to resolve system output source: %w", err)
 	}
 
-	os.Remove(r.SystemSegmentList())
+	systemList := runSegmentList(r.tempDir, "system", r.run)
+	os.Remove(systemList)
 
-	systemCmd, err := startSegmentedCapture(ctx, systemSource, r.chunkSeconds, r.SystemSegmentList(), r.SystemChunkPattern())
+	systemCmd, err := startSegmentedCapture(ctx, systemSource, r.chunkSeconds, systemList, runChunkPattern(r.tempDir, "system", r.run))
 	if err != nil {
 		stopCmd(r.micCmd)
 		r.micCmd = nil
@@ -172,6 +257,20 @@ func (r *Recorder) Start(ctx context.Context) error {
 	return nil
 }
 
+// PIDs returns the process IDs of the ffmpeg captures currently running,
+// none while stopped or paused. They're recorded in the recording lock so
+// that, if this process dies, captures it leaves behind can still be found
+// and stopped.
+func (r *Recorder) PIDs() []int {
+	var pids []int
+	for _, cmd := range []*exec.Cmd{r.micCmd, r.systemCmd} {
+		if cmd != nil && cmd.Process != nil {
+			pids = append(pids, cmd.Process.Pid)
+		}
+	}
+	return pids
+}
+
 // Stop stops any active recording streams, letting ffmpeg finalize (and
 // list) whatever chunk was still open.
 func (r *Recorder) Stop() error {
@@ -1,7 +1,10 @@
 package audio
 
 import (
+	"context"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
 
 	"github.com/sabhz/trani/internal/config"
@@ -96,3 +99,64 @@ func TestStopClearsCommands(t *testing.T) {
 		t.Error("systemCmd should be cleared")
 	}
 }
+
+func TestSegmentListsIncludeResumedRunsInOrder(t *testing.T) {
+	tempDir := t.TempDir()
+	recorder := New(config.AudioConfig{}, tempDir)
+
+	// Written out of order on purpose: the lists must come back in run
+	// order regardless of creation order.
+	for _, run := range []int{2, 0, 10, 1} {
+		if err := os.WriteFile(runSegmentList(tempDir, "mic", run), nil, 0644); err != nil {
+			t.Fatalf("failed to write segment list: %v", err)
+		}
+	}
+
+	expected := []string{
+		filepath.Join(tempDir, "chunk-mic-segments.txt"),
+		filepath.Join(tempDir, "chunk-mic-segments-run001.txt"),
+		filepath.Join(tempDir, "chunk-mic-segments-run002.txt"),
+		filepath.Join(tempDir, "chunk-mic-segments-run010.txt"),
+	}
+
+	got := recorder.MicSegmentLists()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d lists, got %d (%v)", len(expected), len(got), got)
+	}
+	for i, e := range expected {
+		if got[i] != e {
+			t.Errorf("list %d: expected %s, got %s", i, e, got[i])
+		}
+	}
+
+	if lists := recorder.SystemSegmentLists(); len(lists) != 1 {
+		t.Errorf("expected only the first-run system list, got %v", lists)
+	}
+}
+
+func TestRunChunkPatternsNeverOverlap(t *testing.T) {
+	first := runChunkPattern("/tmp/trani", "mic", 0)
+	resumed := runChunkPattern("/tmp/trani", "mic", 1)
+
+	if first != "/tmp/trani/chunk-mic-%03d.wav" {
+		t.Errorf("first run pattern: got %s", first)
+	}
+	if resumed != "/tmp/trani/chunk-mic-run001-%03d.wav" {
+		t.Errorf("resumed run pattern: got %s", resumed)
+	}
+}
+
+func TestResumeWhileRecordingFails(t *testing.T) {
+	recorder := New(config.AudioConfig{}, t.TempDir())
+
+	micProc := exec.Command("sleep", "30")
+	if err := micProc.Start(); err != nil {
+		t.Fatalf("failed to start placeholder process: %v", err)
+	}
+	recorder.micCmd = micProc
+	defer recorder.Stop()
+
+	if err := recorder.Resume(context.Background()); err == nil {
+		t.Error("Resume() should fail while capture is still running")
+	}
+}
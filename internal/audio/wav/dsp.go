@@ -0,0 +1,259 @@
+package wav
+
+import (
+	"fmt"
+	"math"
+)
+
+// Every operation here returns new Audio rather than modifying its input.
+// Samples are processed as float64 and rounded back to 16 bits, with
+// clipping, only once per operation.
+
+// Downmix averages all channels into one.
+func Downmix(a *Audio) *Audio {
+	if a.Channels == 1 {
+		return a
+	}
+
+	frames := a.Frames()
+	out := make([]float64, frames)
+	for i := 0; i < frames; i++ {
+		var sum float64
+		for ch := 0; ch < a.Channels; ch++ {
+			sum += float64(a.Samples[i*a.Channels+ch])
+		}
+		out[i] = sum / float64(a.Channels)
+	}
+
+	return &Audio{SampleRate: a.SampleRate, Channels: 1, Samples: toInt16(out)}
+}
+
+// Normalize scales a so its loudest sample sits at full scale (0 dBFS),
+// like sox's "norm". Digital silence is returned as is.
+func Normalize(a *Audio) *Audio {
+	var peak float64
+	for _, s := range a.Samples {
+		peak = math.Max(peak, math.Abs(float64(s)))
+	}
+	if peak == 0 {
+		return a
+	}
+
+	gain := math.MaxInt16 / peak
+	out := make([]float64, len(a.Samples))
+	for i, s := range a.Samples {
+		out[i] = float64(s) * gain
+	}
+
+	return &Audio{SampleRate: a.SampleRate, Channels: a.Channels, Samples: toInt16(out)}
+}
+
+// Mix sums two streams of the same format into one, each at half gain (as
+// sox -m does) so the sum can't clip. The result is as long as the longer
+// input; callers normalize afterward.
+func Mix(a, b *Audio) (*Audio, error) {
+	if a.SampleRate != b.SampleRate || a.Channels != b.Channels {
+		return nil, fmt.Errorf("cannot mix %d Hz/%d ch audio with %d Hz/%d ch audio", a.SampleRate, a.Channels, b.SampleRate, b.Channels)
+	}
+
+	n := max(len(a.Samples), len(b.Samples))
+	out := make([]float64, n)
+	for i := range out {
+		if i < len(a.Samples) {
+			out[i] += float64(a.Samples[i]) / 2
+		}
+		if i < len(b.Samples) {
+			out[i] += float64(b.Samples[i]) / 2
+		}
+	}
+
+	return &Audio{SampleRate: a.SampleRate, Channels: a.Channels, Samples: toInt16(out)}, nil
+}
+
+// Concat appends b after a. Both must have the same format.
+func Concat(a, b *Audio) (*Audio, error) {
+	if a.SampleRate != b.SampleRate || a.Channels != b.Channels {
+		return nil, fmt.Errorf("cannot concatenate %d Hz/%d ch audio with %d Hz/%d ch audio", a.SampleRate, a.Channels, b.SampleRate, b.Channels)
+	}
+
+	samples := make([]int16, 0, len(a.Samples)+len(b.Samples))
+	samples = append(samples, a.Samples...)
+	samples = append(samples, b.Samples...)
+
+	return &Audio{SampleRate: a.SampleRate, Channels: a.Channels, Samples: samples}, nil
+}
+
+// HighPass attenuates frequencies below cutoffHz with a two-pole
+// Butterworth filter (sox's "highpass" default).
+func HighPass(a *Audio, cutoffHz float64) *Audio {
+	return applyBiquad(a, highPassBiquad(float64(a.SampleRate), cutoffHz))
+}
+
+// LowPass attenuates frequencies above cutoffHz with a two-pole
+// Butterworth filter (sox's "lowpass" default). A cutoff at or above the
+// Nyquist frequency has nothing to remove, so a is returned as is.
+func LowPass(a *Audio, cutoffHz float64) *Audio {
+	if cutoffHz >= float64(a.SampleRate)/2 {
+		return a
+	}
+	return applyBiquad(a, lowPassBiquad(float64(a.SampleRate), cutoffHz))
+}
+
+// biquad holds normalized coefficients (a0 == 1) of a second-order IIR
+// filter, per the RBJ Audio EQ Cookbook.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+}
+
+// butterworthQ gives a maximally flat passband.
+const butterworthQ = 1 / math.Sqrt2
+
+func lowPassBiquad(rate, cutoff float64) biquad {
+	w0 := 2 * math.Pi * cutoff / rate
+	alpha := math.Sin(w0) / (2 * butterworthQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 - cos) / 2 / a0,
+		b1: (1 - cos) / a0,
+		b2: (1 - cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func highPassBiquad(rate, cutoff float64) biquad {
+	w0 := 2 * math.Pi * cutoff / rate
+	alpha := math.Sin(w0) / (2 * butterworthQ)
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+	return biquad{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+// applyBiquad filters each channel independently.
+func applyBiquad(a *Audio, f biquad) *Audio {
+	out := make([]float64, len(a.Samples))
+	for ch := 0; ch < a.Channels; ch++ {
+		var x1, x2, y1, y2 float64
+		for i := ch; i < len(a.Samples); i += a.Channels {
+			x := float64(a.Samples[i])
+			y := f.b0*x + f.b1*x1 + f.b2*x2 - f.a1*y1 - f.a2*y2
+			x2, x1 = x1, x
+			y2, y1 = y1, y
+			out[i] = y
+		}
+	}
+
+	return &Audio{SampleRate: a.SampleRate, Channels: a.Channels, Samples: toInt16(out)}
+}
+
+// Resampling uses a polyphase windowed-sinc filter. resampleZeroCrossings
+// sets the kernel length, trading speed for stopband attenuation;
+// resampleRolloff places the cutoff just below the output's Nyquist
+// frequency so the transition band doesn't alias.
+const (
+	resampleZeroCrossings = 16
+	resampleRolloff       = 0.95
+)
+
+// Resample converts a to the given sample rate, band-limiting it first so
+// frequencies above the new Nyquist frequency don't alias.
+func Resample(a *Audio, rate int) *Audio {
+	if a.SampleRate == rate || len(a.Samples) == 0 {
+		return &Audio{SampleRate: rate, Channels: a.Channels, Samples: a.Samples}
+	}
+
+	// Output sample n sits at input position n*down/up; with up and down
+	// reduced by their gcd, only `up` distinct fractional positions
+	// (phases) ever occur, so the kernel is computed once per phase.
+	g := gcd(a.SampleRate, rate)
+	up, down := rate/g, a.SampleRate/g
+
+	// Cutoff in cycles per input sample.
+	cutoff := 0.5 * resampleRolloff * math.Min(1, float64(up)/float64(down))
+	half := int(math.Ceil(resampleZeroCrossings / (2 * cutoff)))
+	taps := 2 * half
+
+	kernels := make([][]float64, up)
+	for phase := 0; phase < up; phase++ {
+		frac := float64(phase) / float64(up)
+		kernel := make([]float64, taps)
+		for k := range kernel {
+			// Distance from the output position to input sample
+			// (base - half + 1 + k).
+			x := float64(k-half+1) - frac
+			kernel[k] = 2 * cutoff * sinc(2*cutoff*x) * blackman(x, float64(half))
+		}
+		kernels[phase] = kernel
+	}
+
+	inFrames := a.Frames()
+	outFrames := (inFrames*up + down - 1) / down
+	out := make([]float64, outFrames*a.Channels)
+
+	for n := 0; n < outFrames; n++ {
+		pos := n * down
+		base, phase := pos/up, pos%up
+		kernel := kernels[phase]
+		first := base - half + 1
+
+		for ch := 0; ch < a.Channels; ch++ {
+			var sum float64
+			for k, h := range kernel {
+				i := first + k
+				if i < 0 || i >= inFrames {
+					continue
+				}
+				sum += h * float64(a.Samples[i*a.Channels+ch])
+			}
+			out[n*a.Channels+ch] = sum
+		}
+	}
+
+	return &Audio{SampleRate: rate, Channels: a.Channels, Samples: toInt16(out)}
+}
+
+func sinc(x float64) float64 {
+	if x == 0 {
+		return 1
+	}
+	return math.Sin(math.Pi*x) / (math.Pi * x)
+}
+
+// blackman is a Blackman window over [-half, half], zero outside it.
+func blackman(x, half float64) float64 {
+	if math.Abs(x) >= half {
+		return 0
+	}
+	t := (x + half) / (2 * half)
+	return 0.42 - 0.5*math.Cos(2*math.Pi*t) + 0.08*math.Cos(4*math.Pi*t)
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// toInt16 rounds and clips float samples to 16 bits.
+func toInt16(samples []float64) []int16 {
+	out := make([]int16, len(samples))
+	for i, s := range samples {
+		s = math.Round(s)
+		switch {
+		case s > math.MaxInt16:
+			s = math.MaxInt16
+		case s < math.MinInt16:
+			s = math.MinInt16
+		}
+		out[i] = int16(s)
+	}
+	return out
+}
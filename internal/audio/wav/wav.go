@@ -0,0 +1,300 @@
+// Package wav reads and writes 16-bit PCM WAV files, the only format trani
+// ever records or produces.
+package wav
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"time"
+)
+
+// Format tags trani accepts in the "fmt " chunk. ffmpeg and sox both write
+// plain PCM for mono/stereo 16-bit audio, but may use the extensible form.
+const (
+	formatPCM        = 1
+	formatExtensible = 0xFFFE
+)
+
+// Audio is decoded 16-bit PCM audio. Samples are interleaved by channel:
+// for stereo, left and right alternate.
+type Audio struct {
+	SampleRate int
+	Channels   int
+	Samples    []int16
+}
+
+// Frames is the number of samples per channel.
+func (a *Audio) Frames() int {
+	if a.Channels == 0 {
+		return 0
+	}
+	return len(a.Samples) / a.Channels
+}
+
+// Duration is the length of the audio.
+func (a *Audio) Duration() time.Duration {
+	if a.SampleRate == 0 {
+		return 0
+	}
+	return time.Duration(a.Frames()) * time.Second / time.Duration(a.SampleRate)
+}
+
+// Read decodes a 16-bit PCM WAV file.
+func Read(path string) (*Audio, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	audio, dataSize, err := readHeader(f, path)
+	if err != nil {
+		return nil, err
+	}
+
+	// A writer that was killed mid-recording can leave a data size larger
+	// than what's actually there; take what exists.
+	data, err := io.ReadAll(io.LimitReader(f, int64(dataSize)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WAV data: %w", err)
+	}
+	audio.Samples = make([]int16, len(data)/2)
+	for i := range audio.Samples {
+		audio.Samples[i] = int16(binary.LittleEndian.Uint16(data[2*i:]))
+	}
+
+	return audio, nil
+}
+
+// FileDuration reads a WAV file's length from its header alone, without
+// reading the samples.
+func FileDuration(path string) (time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	audio, dataSize, err := readHeader(f, path)
+	if err != nil {
+		return 0, err
+	}
+
+	// Same leniency as Read: ffmpeg declares a placeholder size until it
+	// finishes a file, so a capture killed mid-chunk leaves a size far
+	// past what's actually there.
+	dataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, fmt.Errorf("failed to locate WAV data: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	if available := info.Size() - dataStart; available < int64(dataSize) {
+		dataSize = uint32(max(available, 0))
+	}
+
+	bytesPerSecond := audio.SampleRate * audio.Channels * 2
+	return time.Duration(float64(dataSize) / float64(bytesPerSecond) * float64(time.Second)), nil
+}
+
+// readHeader walks r's chunks up to the "data" chunk, leaving r positioned
+// at the first sample. It returns the format (with no samples yet) and the
+// data chunk's declared size in bytes.
+func readHeader(r io.ReadSeeker, path string) (*Audio, uint32, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, 0, fmt.Errorf("failed to read WAV header: %w", err)
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, 0, fmt.Errorf("%s is not a WAV file", path)
+	}
+
+	var audio *Audio
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, 0, fmt.Errorf("no data chunk in WAV file: %w", err)
+		}
+		id := string(header[0:4])
+		size := binary.LittleEndian.Uint32(header[4:8])
+
+		switch id {
+		case "fmt ":
+			format := make([]byte, size)
+			if _, err := io.ReadFull(r, format); err != nil {
+				return nil, 0, fmt.Errorf("failed to read WAV fmt chunk: %w", err)
+			}
+			var err error
+			audio, err = parseFormat(format)
+			if err != nil {
+				return nil, 0, err
+			}
+			size = size % 2 // only the padding byte, if any, is left
+
+		case "data":
+			if audio == nil {
+				return nil, 0, fmt.Errorf("WAV data chunk before fmt chunk")
+			}
+			return audio, size, nil
+
+		default:
+			size += size % 2
+		}
+
+		// Chunks are word-aligned: an odd-sized chunk is followed by one
+		// padding byte.
+		if _, err := r.Seek(int64(size), io.SeekCurrent); err != nil {
+			return nil, 0, fmt.Errorf("failed to skip WAV chunk: %w", err)
+		}
+	}
+}
+
+func parseFormat(format []byte) (*Audio, error) {
+	if len(format) < 16 {
+		return nil, fmt.Errorf("malformed WAV fmt chunk")
+	}
+
+	tag := binary.LittleEndian.Uint16(format[0:2])
+	channels := int(binary.LittleEndian.Uint16(format[2:4]))
+	sampleRate := int(binary.LittleEndian.Uint32(format[4:8]))
+	bitsPerSample := binary.LittleEndian.Uint16(format[14:16])
+
+	if tag != formatPCM && tag != formatExtensible {
+		return nil, fmt.Errorf("unsupported WAV format tag %#x (only PCM is supported)", tag)
+	}
+	if bitsPerSample != 16 {
+		return nil, fmt.Errorf("unsupported WAV bit depth %d (only 16-bit is supported)", bitsPerSample)
+	}
+	if channels == 0 || sampleRate == 0 {
+		return nil, fmt.Errorf("malformed WAV fmt chunk")
+	}
+
+	return &Audio{SampleRate: sampleRate, Channels: channels}, nil
+}
+
+// Write encodes audio as a 16-bit PCM WAV file, replacing path if it
+// exists.
+func Write(path string, audio *Audio) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := encode(f, audio); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Append adds audio to the end of the WAV file at path in place, then
+// patches the RIFF and data chunk sizes, so the cost of appending depends
+// only on len(audio.Samples), not on how long the file already is. The
+// file's format must match audio's.
+//
+// Samples are written before the sizes are patched: if the process dies in
+// between, the file still reads as it was before the call, and the next
+// Append overwrites the stray samples.
+func Append(path string, audio *Audio) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	existing, dataSize, err := readHeader(f, path)
+	if err != nil {
+		return err
+	}
+	if existing.SampleRate != audio.SampleRate || existing.Channels != audio.Channels {
+		return fmt.Errorf("cannot append %d Hz/%d ch audio to %d Hz/%d ch WAV file",
+			audio.SampleRate, audio.Channels, existing.SampleRate, existing.Channels)
+	}
+
+	dataStart, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to locate WAV data: %w", err)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	// Same leniency as Read: a declared size past the end of the file only
+	// counts what's actually there, rounded down to whole frames.
+	end := min(dataStart+int64(dataSize), info.Size())
+	frameSize := int64(existing.Channels * 2)
+	end = dataStart + (end-dataStart)/frameSize*frameSize
+
+	newDataSize := end - dataStart + int64(len(audio.Samples)*2)
+	if dataStart+newDataSize-8 > math.MaxUint32 {
+		return fmt.Errorf("appending would exceed the 4 GiB WAV size limit")
+	}
+
+	data := make([]byte, len(audio.Samples)*2)
+	for i, s := range audio.Samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	if _, err := f.WriteAt(data, end); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	// Drops anything past the new end, such as stray samples from an
+	// interrupted append or chunks some other writer put after "data".
+	if err := f.Truncate(dataStart + newDataSize); err != nil {
+		return fmt.Errorf("failed to truncate WAV file: %w", err)
+	}
+
+	var size [4]byte
+	binary.LittleEndian.PutUint32(size[:], uint32(newDataSize))
+	if _, err := f.WriteAt(size[:], dataStart-4); err != nil {
+		return fmt.Errorf("failed to update WAV data size: %w", err)
+	}
+	binary.LittleEndian.PutUint32(size[:], uint32(dataStart+newDataSize-8))
+	if _, err := f.WriteAt(size[:], 4); err != nil {
+		return fmt.Errorf("failed to update WAV RIFF size: %w", err)
+	}
+
+	return f.Close()
+}
+
+func encode(w io.Writer, audio *Audio) error {
+	dataSize := uint32(len(audio.Samples) * 2)
+	if _, err := w.Write(header(audio.SampleRate, audio.Channels, dataSize)); err != nil {
+		return fmt.Errorf("failed to write WAV header: %w", err)
+	}
+
+	data := make([]byte, dataSize)
+	for i, s := range audio.Samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(s))
+	}
+	if _, err := w.Write(data); err != nil {
+		return fmt.Errorf("failed to write WAV data: %w", err)
+	}
+	return nil
+}
+
+// header is the 44-byte canonical header for a 16-bit PCM WAV file with
+// dataSize bytes of samples.
+func header(sampleRate, channels int, dataSize uint32) []byte {
+	le := binary.LittleEndian
+	b := make([]byte, 0, 44)
+	b = append(b, "RIFF"...)
+	b = le.AppendUint32(b, 36+dataSize)
+	b = append(b, "WAVE"...)
+	b = append(b, "fmt "...)
+	b = le.AppendUint32(b, 16)
+	b = le.AppendUint16(b, formatPCM)
+	b = le.AppendUint16(b, uint16(channels))
+	b = le.AppendUint32(b, uint32(sampleRate))
+	b = le.AppendUint32(b, uint32(sampleRate*channels*2))
+	b = le.AppendUint16(b, uint16(channels*2))
+	b = le.AppendUint16(b, 16)
+	b = append(b, "data"...)
+	b = le.AppendUint32(b, dataSize)
+	return b
+}
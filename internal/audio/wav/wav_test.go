@@ -0,0 +1,242 @@
+package wav
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteReadRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "roundtrip.wav")
+	in := &Audio{SampleRate: 16000, Channels: 2, Samples: []int16{0, 1, -1, 32767, -32768, 1234}}
+
+	if err := Write(path, in); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+	out, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+
+	if out.SampleRate != 16000 || out.Channels != 2 {
+		t.Errorf("unexpected format: %d Hz, %d channels", out.SampleRate, out.Channels)
+	}
+	if len(out.Samples) != len(in.Samples) {
+		t.Fatalf("expected %d samples, got %d", len(in.Samples), len(out.Samples))
+	}
+	for i := range in.Samples {
+		if out.Samples[i] != in.Samples[i] {
+			t.Errorf("sample %d: expected %d, got %d", i, in.Samples[i], out.Samples[i])
+		}
+	}
+	if out.Frames() != 3 {
+		t.Errorf("expected 3 frames, got %d", out.Frames())
+	}
+}
+
+func TestDuration(t *testing.T) {
+	a := &Audio{SampleRate: 16000, Channels: 1, Samples: make([]int16, 24000)}
+	if a.Duration() != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s, got %v", a.Duration())
+	}
+}
+
+func TestReadAcceptsExtensibleFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "extensible.wav")
+
+	b := header(48000, 2, 4)
+	binary.LittleEndian.PutUint16(b[20:22], formatExtensible)
+	b = append(b, 1, 0, 2, 0)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	a, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(a.Samples) != 2 || a.Samples[0] != 1 || a.Samples[1] != 2 {
+		t.Errorf("unexpected samples: %v", a.Samples)
+	}
+}
+
+func TestReadTruncatedData(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "truncated.wav")
+
+	// Header claims 100 bytes of data, but only 4 made it to disk, as
+	// when a recorder is killed before it can patch the header.
+	b := append(header(16000, 1, 100), 1, 0, 2, 0)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	a, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(a.Samples) != 2 {
+		t.Errorf("expected the 2 samples actually present, got %d", len(a.Samples))
+	}
+
+	d, err := FileDuration(path)
+	if err != nil {
+		t.Fatalf("FileDuration failed: %v", err)
+	}
+	if d != 2*time.Second/16000 {
+		t.Errorf("expected the duration of the 2 samples present, got %v", d)
+	}
+}
+
+func TestReadRejectsUnsupportedBitDepth(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "24bit.wav")
+
+	b := header(16000, 1, 0)
+	binary.LittleEndian.PutUint16(b[34:36], 24)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := Read(path); err == nil {
+		t.Error("expected an error for 24-bit audio")
+	}
+}
+
+func TestFileDuration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunk.wav")
+	// 1.5s of 16 kHz mono audio.
+	if err := Write(path, &Audio{SampleRate: 16000, Channels: 1, Samples: make([]int16, 24000)}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	d, err := FileDuration(path)
+	if err != nil {
+		t.Fatalf("FileDuration failed: %v", err)
+	}
+	if d != 1500*time.Millisecond {
+		t.Errorf("expected 1.5s, got %v", d)
+	}
+}
+
+func TestReadSkipsOtherChunks(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.wav")
+
+	// An odd-sized LIST chunk between "fmt " and "data" exercises the
+	// padding byte.
+	full := header(48000, 2, 4)
+	b := append([]byte{}, full[:36]...)
+	b = append(b, "LIST"...)
+	b = binary.LittleEndian.AppendUint32(b, 3)
+	b = append(b, "odd"...)
+	b = append(b, 0)
+	b = append(b, full[36:]...)
+	b = append(b, 7, 0, 9, 0)
+	if err := os.WriteFile(path, b, 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	a, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(a.Samples) != 2 || a.Samples[0] != 7 || a.Samples[1] != 9 {
+		t.Errorf("unexpected samples: %v", a.Samples)
+	}
+
+	d, err := FileDuration(path)
+	if err != nil {
+		t.Fatalf("FileDuration failed: %v", err)
+	}
+	if d != time.Second/48000 {
+		t.Errorf("expected one frame's duration, got %v", d)
+	}
+}
+
+func TestReadRejectsNonWAV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "not.wav")
+	if err := os.WriteFile(path, []byte("definitely not a RIFF file"), 0644); err != nil {
+		t.Fatalf("failed to write file: %v", err)
+	}
+
+	if _, err := Read(path); err == nil {
+		t.Error("expected an error for a non-WAV file")
+	}
+}
+
+func TestAppend(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.wav")
+	if err := Write(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{1, 2, 3}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := Append(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{4, 5}}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+	if err := Append(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{6}}); err != nil {
+		t.Fatalf("second Append failed: %v", err)
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read file: %v", err)
+	}
+	if riff := binary.LittleEndian.Uint32(b[4:8]); int(riff) != len(b)-8 {
+		t.Errorf("RIFF size %d doesn't match file length %d", riff, len(b))
+	}
+
+	a, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	want := []int16{1, 2, 3, 4, 5, 6}
+	if len(a.Samples) != len(want) {
+		t.Fatalf("expected %v, got %v", want, a.Samples)
+	}
+	for i := range want {
+		if a.Samples[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, a.Samples)
+		}
+	}
+}
+
+func TestAppendOverwritesSamplesPastDeclaredSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.wav")
+	if err := Write(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{1, 2}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	// Samples written by an append that died before patching the header.
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatalf("failed to open file: %v", err)
+	}
+	f.Write([]byte{99, 0, 99, 0})
+	f.Close()
+
+	if err := Append(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{3}}); err != nil {
+		t.Fatalf("Append failed: %v", err)
+	}
+
+	a, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	if len(a.Samples) != 3 || a.Samples[2] != 3 {
+		t.Errorf("expected [1 2 3], got %v", a.Samples)
+	}
+	if info, _ := os.Stat(path); info.Size() != 44+6 {
+		t.Errorf("expected stray samples to be dropped, file is %d bytes", info.Size())
+	}
+}
+
+func TestAppendRejectsFormatMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "archive.wav")
+	if err := Write(path, &Audio{SampleRate: 16000, Channels: 1, Samples: []int16{1}}); err != nil {
+		t.Fatalf("Write failed: %v", err)
+	}
+
+	if err := Append(path, &Audio{SampleRate: 48000, Channels: 2, Samples: []int16{1, 2}}); err == nil {
+		t.Error("expected an error appending audio in a different format")
+	}
+}
@@ -16,6 +16,7 @@ type Config struct {
 	Audio         AudioConfig         `yaml:"audio"`
 	Paths         PathsConfig         `yaml:"paths"`
 	Obsidian      ObsidianConfig      `yaml:"obsidian"`
+	Postprocess   PostprocessConfig   `yaml:"postprocess"`
 }
 
 // ObsidianConfig points trani at an Obsidian vault for the session note.
@@ -25,11 +26,27 @@ type ObsidianConfig struct {
 	VaultPath string `yaml:"vault_path"`
 }
 
+// PostprocessConfig turns on what's generated for a session besides its
+// summary, once the summary is written.
+type PostprocessConfig struct {
+	ActionItems  bool   `yaml:"action_items"`   // extract action items into a "## Tareas" section and the frontmatter
+	TasksFile    string `yaml:"tasks_file"`     // also append them here; relative to the vault (or sessions_dir without one)
+	TitleAndTags bool   `yaml:"title_and_tags"` // generate a title and tags into the note's frontmatter
+	RenameNote   bool   `yaml:"rename_note"`    // with title_and_tags, rename the note to "<date> <title>.md"
+}
+
 // TranscriptionConfig specifies which backend to use and its settings.
+// Fallback lists backends to try, in order, when Backend fails in a way
+// that could pass on its own (an outage, a rate limit or exhausted quota).
+// Retry applies to the backends that call an HTTP API.
 type TranscriptionConfig struct {
-	Backend string             `yaml:"backend"`
-	Local   LocalWhisperConfig `yaml:"local"`
-	OpenAI  OpenAIConfig       `yaml:"openai"`
+	Backend          string                              `yaml:"backend"`
+	Fallback         []string                            `yaml:"fallback"`
+	Retry            RetryConfig                         `yaml:"retry"`
+	Local            LocalWhisperConfig                  `yaml:"local"`
+	OpenAI           OpenAIConfig                        `yaml:"openai"`
+	OpenAICompatible OpenAICompatibleTranscriptionConfig `yaml:"openai_compatible"`
+	WhisperServer    WhisperServerConfig                 `yaml:"whisper_server"`
 }
 
 // LocalWhisperConfig contains settings for local whisper.cpp transcription.
@@ -46,11 +63,63 @@ type OpenAIConfig struct {
 	Language string `yaml:"language"`
 }
 
-// LLMConfig contains settings for LLM providers.
+// OpenAICompatibleTranscriptionConfig contains settings for self-hosted
+// servers implementing OpenAI's /audio/transcriptions endpoint
+// (faster-whisper-server, speaches, whisper.cpp's server with
+// --inference-path). BaseURL includes the API version path (e.g.
+// http://localhost:8000/v1). APIKeyEnv names the environment variable
+// holding the API key; empty sends none. Model is sent only when set.
+type OpenAICompatibleTranscriptionConfig struct {
+	BaseURL   string `yaml:"base_url"`
+	Model     string `yaml:"model"`
+	Language  string `yaml:"language"`
+	APIKeyEnv string `yaml:"api_key_env"`
+}
+
+// WhisperServerConfig contains settings for a long-running whisper.cpp
+// server (whisper-server), which keeps its model loaded between chunks
+// instead of loading it for each one like the local backend. URL is where
+// it listens (e.g. http://127.0.0.1:8178). With BinaryPath and ModelPath
+// set, trani starts the server itself when it first needs it, unless one
+// already answers at URL, and stops it once done with it; otherwise the
+// server must already be running.
+type WhisperServerConfig struct {
+	URL        string `yaml:"url"`
+	Language   string `yaml:"language"`
+	BinaryPath string `yaml:"binary_path"`
+	ModelPath  string `yaml:"model_path"`
+	Threads    int    `yaml:"threads"`
+}
+
+// LLMConfig contains settings for LLM providers. MaxPromptTokens is the
+// largest prompt (estimated, see session.estimateTokens) sent to the model
+// in one request; a transcript that doesn't fit is summarized in parts
+// first. Defaults depend on the backend. RollingSummaryChunks, when set,
+// updates a "summary so far" every that many chunks transcribed during a
+// live session; zero (the default) disables it. Fallback lists backends to
+// try, in order, when Backend fails in a way that could pass on its own.
 type LLMConfig struct {
-	Backend string        `yaml:"backend"`
-	Claude  ClaudeConfig  `yaml:"claude"`
-	Ollama  OllamaConfig  `yaml:"ollama"`
+	Backend              string                 `yaml:"backend"`
+	Fallback             []string               `yaml:"fallback"`
+	MaxPromptTokens      int                    `yaml:"max_prompt_tokens"`
+	RollingSummaryChunks int                    `yaml:"rolling_summary_chunks"`
+	Retry                RetryConfig            `yaml:"retry"`
+	Claude               ClaudeConfig           `yaml:"claude"`
+	Ollama               OllamaConfig           `yaml:"ollama"`
+	OpenAICompatible     OpenAICompatibleConfig `yaml:"openai_compatible"`
+}
+
+// RetryConfig controls how API calls that fail in a way worth retrying
+// (rate limits, server errors, no response) are retried: up to MaxAttempts
+// attempts in all, waiting between them with exponential backoff from
+// InitialBackoffSeconds up to MaxBackoffSeconds, or as long as the server
+// asks with Retry-After if that's no longer than MaxBackoffSeconds. Each
+// attempt is given up on after TimeoutSeconds.
+type RetryConfig struct {
+	MaxAttempts           int `yaml:"max_attempts"`
+	InitialBackoffSeconds int `yaml:"initial_backoff_seconds"`
+	MaxBackoffSeconds     int `yaml:"max_backoff_seconds"`
+	TimeoutSeconds        int `yaml:"timeout_seconds"`
 }
 
 // ClaudeConfig contains settings for Claude API.
@@ -65,6 +134,20 @@ type OllamaConfig struct {
 	Model   string `yaml:"model"`
 }
 
+// OpenAICompatibleConfig contains settings for any server implementing the
+// OpenAI chat completions API (llama.cpp's llama-server, vLLM, LM Studio).
+// BaseURL includes the API version path, as OpenAI's own clients expect
+// (e.g. http://localhost:8080/v1). APIKeyEnv names the environment variable
+// holding the API key; empty sends none. Temperature and MaxTokens are left
+// to the server's defaults when unset.
+type OpenAICompatibleConfig struct {
+	BaseURL     string   `yaml:"base_url"`
+	Model       string   `yaml:"model"`
+	APIKeyEnv   string   `yaml:"api_key_env"`
+	Temperature *float64 `yaml:"temperature"`
+	MaxTokens   int      `yaml:"max_tokens"`
+}
+
 // Audio capture modes.
 const (
 	AudioModeMic       = "mic"
@@ -75,17 +158,37 @@ const (
 const (
 	MixStrategyPostMix            = "post_mix"
 	MixStrategySeparateTranscribe = "separate_transcribe"
+	MixStrategySpeakerLabels      = "speaker_labels"
+)
+
+// Formats the archived session audio can be kept in.
+const (
+	ArchiveFormatWAV  = "wav"
+	ArchiveFormatFLAC = "flac"
+	ArchiveFormatOpus = "opus"
 )
 
 // AudioConfig contains audio recording settings.
 type AudioConfig struct {
-	SampleRate   int    `yaml:"sample_rate"`
-	Channels     int    `yaml:"channels"`
-	Mode         string `yaml:"mode"`          // mic | mic_system
-	MicDevice    string `yaml:"mic_device"`    // pactl source name; empty uses the default source
-	MixStrategy  string `yaml:"mix_strategy"`  // post_mix | separate_transcribe (mic_system only)
-	ChunkSeconds int    `yaml:"chunk_seconds"` // how often to segment and transcribe progressively
-	Preserve     bool   `yaml:"preserved"`     // keep the archived audio in .sources/ after processing
+	SampleRate    int    `yaml:"sample_rate"`
+	Channels      int    `yaml:"channels"`
+	Mode          string `yaml:"mode"`           // mic | mic_system
+	MicDevice     string `yaml:"mic_device"`     // pactl source name; empty uses the default source
+	MixStrategy   string `yaml:"mix_strategy"`   // post_mix | separate_transcribe | speaker_labels (mic_system only)
+	ChunkSeconds  int    `yaml:"chunk_seconds"`  // how often to segment and transcribe progressively
+	Preserve      bool   `yaml:"preserved"`      // keep the archived audio in .sources/ after processing
+	ArchiveFormat string `yaml:"archive_format"` // wav | flac | opus, what preserved audio is encoded to on finalize
+	MicLabel      string `yaml:"mic_label"`      // speaker label for the mic stream (speaker_labels only)
+	SystemLabel   string `yaml:"system_label"`   // speaker label for the system stream (speaker_labels only)
+
+	// Voice-activity detection, run on each chunk before transcribing it.
+	// The thresholds are pointers because 0 is a setting of its own (count
+	// any frame above the noise floor as speech, transcribe every chunk
+	// with any speech, trim all silence); only unset ones are defaulted.
+	VAD                  bool     `yaml:"vad"`                     // skip silent chunks and trim leading/trailing dead air
+	VADThresholdDB       *float64 `yaml:"vad_threshold_db"`        // how far above a chunk's noise floor a frame must be to count as speech
+	VADMinSpeechRatio    *float64 `yaml:"vad_min_speech_ratio"`    // chunks with a lower share of speech frames aren't transcribed
+	VADMaxSilenceSeconds *float64 `yaml:"vad_max_silence_seconds"` // leading/trailing silence kept before trimming the rest
 }
 
 // PathsConfig contains file system paths.
@@ -113,20 +216,39 @@ func Load() (*Config, error) {
 	if err := yaml.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse config YAML: %w", err)
 	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
 
 	return &cfg, nil
 }
 
+// validate rejects values that would otherwise only fail once they're
+// used, possibly at the end of a long session (an archive_format typo is
+// only noticed when the audio is compressed, after the summary). Empty
+// values are left to ApplyDefaults.
+func (c *Config) validate() error {
+	switch c.Audio.ArchiveFormat {
+	case "", ArchiveFormatWAV, ArchiveFormatFLAC, ArchiveFormatOpus:
+	default:
+		return fmt.Errorf("audio.archive_format: unknown format %q (expected %s, %s or %s)", c.Audio.ArchiveFormat, ArchiveFormatWAV, ArchiveFormatFLAC, ArchiveFormatOpus)
+	}
+	return nil
+}
+
 // ExpandPaths replaces ~ with $HOME in all path fields.
 func (c *Config) ExpandPaths() {
 	home := os.Getenv("HOME")
 
 	c.Transcription.Local.ModelPath = expandPath(c.Transcription.Local.ModelPath, home)
 	c.Transcription.Local.BinaryPath = expandPath(c.Transcription.Local.BinaryPath, home)
+	c.Transcription.WhisperServer.ModelPath = expandPath(c.Transcription.WhisperServer.ModelPath, home)
+	c.Transcription.WhisperServer.BinaryPath = expandPath(c.Transcription.WhisperServer.BinaryPath, home)
 	c.Paths.SessionsDir = expandPath(c.Paths.SessionsDir, home)
 	c.Paths.TempDir = expandPath(c.Paths.TempDir, home)
 	c.Paths.PromptsDir = expandPath(c.Paths.PromptsDir, home)
 	c.Obsidian.VaultPath = expandPath(c.Obsidian.VaultPath, home)
+	c.Postprocess.TasksFile = expandPath(c.Postprocess.TasksFile, home)
 }
 
 func expandPath(path, home string) string {
@@ -165,6 +287,36 @@ func (c *Config) ApplyDefaults() {
 	if c.Audio.ChunkSeconds == 0 {
 		c.Audio.ChunkSeconds = 300
 	}
+	if c.Audio.ArchiveFormat == "" {
+		c.Audio.ArchiveFormat = ArchiveFormatWAV
+	}
+	if c.Audio.MicLabel == "" {
+		c.Audio.MicLabel = "Yo"
+	}
+	if c.Audio.SystemLabel == "" {
+		c.Audio.SystemLabel = "Otros"
+	}
+	if c.Audio.VADThresholdDB == nil {
+		c.Audio.VADThresholdDB = floatPtr(12)
+	}
+	if c.Audio.VADMinSpeechRatio == nil {
+		c.Audio.VADMinSpeechRatio = floatPtr(0.02)
+	}
+	if c.Audio.VADMaxSilenceSeconds == nil {
+		c.Audio.VADMaxSilenceSeconds = floatPtr(1)
+	}
+
+	if c.Transcription.WhisperServer.URL == "" {
+		// Not whisper.cpp's own default (8080), which llama.cpp's server
+		// shares, so both can run side by side without configuring either.
+		c.Transcription.WhisperServer.URL = "http://127.0.0.1:8178"
+	}
+
+	// A chunk is five minutes of audio, which a local server on CPU can
+	// take a few minutes to transcribe; a summary can take longer than that
+	// to generate.
+	c.Transcription.Retry.applyDefaults(300)
+	c.LLM.Retry.applyDefaults(600)
 
 	if c.LLM.Backend == "" {
 		c.LLM.Backend = "claude"
@@ -172,4 +324,39 @@ func (c *Config) ApplyDefaults() {
 	if c.LLM.Ollama.BaseURL == "" {
 		c.LLM.Ollama.BaseURL = "http://localhost:11434"
 	}
+	if c.LLM.OpenAICompatible.BaseURL == "" {
+		c.LLM.OpenAICompatible.BaseURL = "http://localhost:8080/v1"
+	}
+	if c.LLM.MaxPromptTokens == 0 {
+		// Local servers run with small context windows unless told
+		// otherwise (2048-4096 tokens), and Ollama silently truncates
+		// prompts past it.
+		// The limit has to hold for whichever backend ends up answering,
+		// fallbacks included.
+		c.LLM.MaxPromptTokens = 150000
+		for _, backend := range append([]string{c.LLM.Backend}, c.LLM.Fallback...) {
+			if backend == "ollama" || backend == "openai_compatible" {
+				c.LLM.MaxPromptTokens = 3000
+			}
+		}
+	}
+}
+
+func floatPtr(v float64) *float64 {
+	return &v
+}
+
+func (r *RetryConfig) applyDefaults(timeoutSeconds int) {
+	if r.MaxAttempts == 0 {
+		r.MaxAttempts = 4
+	}
+	if r.InitialBackoffSeconds == 0 {
+		r.InitialBackoffSeconds = 2
+	}
+	if r.MaxBackoffSeconds == 0 {
+		r.MaxBackoffSeconds = 60
+	}
+	if r.TimeoutSeconds == 0 {
+		r.TimeoutSeconds = timeoutSeconds
+	}
 }
@@ -47,6 +47,28 @@ func TestLoad_InvalidYAML(t *testing.T) {
 	}
 }
 
+func TestLoad_RejectsUnknownArchiveFormat(t *testing.T) {
+	for content, rejected := range map[string]bool{
+		"audio:\n  archive_format: ogg\n": true,
+		// An unknown mix strategy falls back to post_mix, as it always has.
+		"audio:\n  mix_strategy: speaker_label\n": false,
+	} {
+		tempDir := t.TempDir()
+		t.Setenv("HOME", tempDir)
+		configDir := filepath.Join(tempDir, ".config", "trani")
+		if err := os.MkdirAll(configDir, 0755); err != nil {
+			t.Fatalf("Failed to create config dir: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write config: %v", err)
+		}
+
+		if _, err := Load(); (err != nil) != rejected {
+			t.Errorf("Load(%q): expected rejected=%v, got %v", content, rejected, err)
+		}
+	}
+}
+
 func TestLoad_ValidYAML(t *testing.T) {
 	originalHome := os.Getenv("HOME")
 	defer os.Setenv("HOME", originalHome)
@@ -165,6 +187,9 @@ func TestApplyDefaults(t *testing.T) {
 	if cfg.Paths.PromptsDir != expected["PromptsDir"] {
 		t.Errorf("PromptsDir: expected %s, got %s", expected["PromptsDir"], cfg.Paths.PromptsDir)
 	}
+	if cfg.Transcription.WhisperServer.URL != "http://127.0.0.1:8178" {
+		t.Errorf("WhisperServer.URL: expected http://127.0.0.1:8178, got %s", cfg.Transcription.WhisperServer.URL)
+	}
 }
 
 func TestApplyDefaults_PreservesExistingValues(t *testing.T) {
@@ -187,3 +212,93 @@ func TestApplyDefaults_PreservesExistingValues(t *testing.T) {
 		t.Errorf("TempDir should be defaulted, got %s", cfg.Paths.TempDir)
 	}
 }
+
+func TestApplyDefaultsSpeakerLabels(t *testing.T) {
+	cfg := &Config{}
+	cfg.ApplyDefaults()
+
+	if cfg.Audio.MicLabel != "Yo" {
+		t.Errorf("MicLabel: expected Yo, got %s", cfg.Audio.MicLabel)
+	}
+	if cfg.Audio.SystemLabel != "Otros" {
+		t.Errorf("SystemLabel: expected Otros, got %s", cfg.Audio.SystemLabel)
+	}
+}
+
+func TestApplyDefaultsArchiveFormat(t *testing.T) {
+	cfg := &Config{}
+	cfg.ApplyDefaults()
+	if cfg.Audio.ArchiveFormat != ArchiveFormatWAV {
+		t.Errorf("ArchiveFormat: expected wav, got %s", cfg.Audio.ArchiveFormat)
+	}
+
+	cfg = &Config{Audio: AudioConfig{ArchiveFormat: ArchiveFormatOpus}}
+	cfg.ApplyDefaults()
+	if cfg.Audio.ArchiveFormat != ArchiveFormatOpus {
+		t.Errorf("ArchiveFormat: expected opus to be kept, got %s", cfg.Audio.ArchiveFormat)
+	}
+}
+
+func TestApplyDefaultsMaxPromptTokens(t *testing.T) {
+	cfg := &Config{}
+	cfg.ApplyDefaults()
+	if cfg.LLM.MaxPromptTokens != 150000 {
+		t.Errorf("MaxPromptTokens (claude): expected 150000, got %d", cfg.LLM.MaxPromptTokens)
+	}
+
+	cfg = &Config{LLM: LLMConfig{Backend: "ollama"}}
+	cfg.ApplyDefaults()
+	if cfg.LLM.MaxPromptTokens != 3000 {
+		t.Errorf("MaxPromptTokens (ollama): expected 3000, got %d", cfg.LLM.MaxPromptTokens)
+	}
+
+	cfg = &Config{LLM: LLMConfig{Backend: "openai_compatible"}}
+	cfg.ApplyDefaults()
+	if cfg.LLM.MaxPromptTokens != 3000 {
+		t.Errorf("MaxPromptTokens (openai_compatible): expected 3000, got %d", cfg.LLM.MaxPromptTokens)
+	}
+	if cfg.LLM.OpenAICompatible.BaseURL != "http://localhost:8080/v1" {
+		t.Errorf("OpenAICompatible.BaseURL: expected http://localhost:8080/v1, got %s", cfg.LLM.OpenAICompatible.BaseURL)
+	}
+
+	cfg = &Config{LLM: LLMConfig{Backend: "claude", Fallback: []string{"ollama"}}}
+	cfg.ApplyDefaults()
+	if cfg.LLM.MaxPromptTokens != 3000 {
+		t.Errorf("MaxPromptTokens (claude falling back to ollama): expected 3000, got %d", cfg.LLM.MaxPromptTokens)
+	}
+
+	cfg = &Config{LLM: LLMConfig{Backend: "ollama", MaxPromptTokens: 32000}}
+	cfg.ApplyDefaults()
+	if cfg.LLM.MaxPromptTokens != 32000 {
+		t.Errorf("MaxPromptTokens: expected 32000 to be kept, got %d", cfg.LLM.MaxPromptTokens)
+	}
+}
+
+func TestApplyDefaultsVADKeepsZero(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("HOME", tempDir)
+	configDir := filepath.Join(tempDir, ".config", "trani")
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		t.Fatalf("Failed to create config dir: %v", err)
+	}
+	content := "audio:\n  vad: true\n  vad_threshold_db: 0\n  vad_min_speech_ratio: 0\n"
+	if err := os.WriteFile(filepath.Join(configDir, "config.yaml"), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatalf("Load() failed: %v", err)
+	}
+	cfg.ApplyDefaults()
+
+	if *cfg.Audio.VADThresholdDB != 0 {
+		t.Errorf("VADThresholdDB: expected 0 to be kept, got %v", *cfg.Audio.VADThresholdDB)
+	}
+	if *cfg.Audio.VADMinSpeechRatio != 0 {
+		t.Errorf("VADMinSpeechRatio: expected 0 to be kept, got %v", *cfg.Audio.VADMinSpeechRatio)
+	}
+	if *cfg.Audio.VADMaxSilenceSeconds != 1 {
+		t.Errorf("VADMaxSilenceSeconds: expected the default 1, got %v", *cfg.Audio.VADMaxSilenceSeconds)
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
 const claudeAPIURL = "https://api.anthropic.com/v1/messages"
@@ -21,9 +22,10 @@ type Claude struct {
 	maxTokens int
 	client    *http.Client
 	baseURL   string
+	policy    retry.Policy
 }
 
-func NewClaude(cfg config.ClaudeConfig) (Generator, error) {
+func NewClaude(cfg config.ClaudeConfig, policy retry.Policy) (Generator, error) {
 	apiKey := os.Getenv("ANTHROPIC_API_KEY")
 	if apiKey == "" {
 		return nil, fmt.Errorf("ANTHROPIC_API_KEY environment variable not set")
@@ -35,14 +37,17 @@ func NewClaude(cfg config.ClaudeConfig) (Generator, error) {
 		maxTokens: cfg.MaxTokens,
 		client:    &http.Client{},
 		baseURL:   claudeAPIURL,
+		policy:    policy,
 	}, nil
 }
 
 // claudeRequest represents the request body for Claude API.
 type claudeRequest struct {
-	Model     string          `json:"model"`
-	MaxTokens int             `json:"max_tokens"`
-	Messages  []claudeMessage `json:"messages"`
+	Model       string          `json:"model"`
+	MaxTokens   int             `json:"max_tokens"`
+	System      string          `json:"system,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	Messages    []claudeMessage `json:"messages"`
 }
 
 // claudeMessage represents a message in the conversation.
@@ -70,23 +75,42 @@ type claudeError struct {
 }
 
 // Generate sends a prompt to Claude and returns the response text.
-func (c *Claude) Generate(ctx context.Context, prompt string) (string, error) {
+func (c *Claude) Generate(ctx context.Context, r Request) (string, error) {
 	reqBody := claudeRequest{
-		Model:     c.model,
-		MaxTokens: c.maxTokens,
+		Model:       c.model,
+		MaxTokens:   c.maxTokens,
+		System:      r.System,
+		Temperature: r.Options.Temperature,
 		Messages: []claudeMessage{
 			{
 				Role:    "user",
-				Content: prompt,
+				Content: r.Prompt,
 			},
 		},
 	}
+	if r.Options.Model != "" {
+		reqBody.Model = r.Options.Model
+	}
+	if r.Options.MaxTokens > 0 {
+		reqBody.MaxTokens = r.Options.MaxTokens
+	}
 
 	data, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	var text string
+	err = retry.Do(ctx, c.policy, func(ctx context.Context) error {
+		var err error
+		text, err = c.send(ctx, data)
+		return err
+	})
+	return text, err
+}
+
+// send makes a single request to the Claude API.
+func (c *Claude) send(ctx context.Context, data []byte) (string, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL, bytes.NewReader(data))
 	if err != nil {
 		return "", fmt.Errorf("failed to create request: %w", err)
@@ -98,21 +122,21 @@ func (c *Claude) Generate(ctx context.Context, prompt string) (string, error) {
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", retry.FromTransport(fmt.Errorf("failed to send request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", retry.FromTransport(fmt.Errorf("failed to read response: %w", err))
 	}
 
 	if resp.StatusCode != http.StatusOK {
 		var errResp claudeResponse
 		if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
-			return "", fmt.Errorf("Claude API error: %s", errResp.Error.Message)
+			return "", retry.FromResponse(resp, fmt.Errorf("Claude API error: %s", errResp.Error.Message))
 		}
-		return "", fmt.Errorf("Claude API returned status %d: %s", resp.StatusCode, string(body))
+		return "", retry.FromResponse(resp, fmt.Errorf("Claude API returned status %d: %s", resp.StatusCode, string(body)))
 	}
 
 	var result claudeResponse
@@ -2,10 +2,15 @@ package llm
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/retry"
 )
 
 func newTestClaude(t *testing.T, handler http.HandlerFunc) *Claude {
@@ -44,7 +49,7 @@ func TestGenerate_SkipsThinkingBlock(t *testing.T) {
 		}`))
 	})
 
-	got, err := claude.Generate(context.Background(), "prompt")
+	got, err := claude.Generate(context.Background(), Prompt("prompt"))
 	if err != nil {
 		t.Fatalf("Generate failed: %v", err)
 	}
@@ -59,7 +64,7 @@ func TestGenerate_NoTextBlock(t *testing.T) {
 		w.Write([]byte(`{"content": [{"type": "thinking", "text": ""}]}`))
 	})
 
-	if _, err := claude.Generate(context.Background(), "prompt"); err == nil {
+	if _, err := claude.Generate(context.Background(), Prompt("prompt")); err == nil {
 		t.Error("expected an error when the response has no text block")
 	}
 }
@@ -70,7 +75,77 @@ func TestGenerate_EmptyContent(t *testing.T) {
 		w.Write([]byte(`{"content": []}`))
 	})
 
-	if _, err := claude.Generate(context.Background(), "prompt"); err == nil {
+	if _, err := claude.Generate(context.Background(), Prompt("prompt")); err == nil {
 		t.Error("expected an error when the response has no content blocks")
 	}
 }
+
+func TestGenerate_RetriesOverloaded(t *testing.T) {
+	calls := 0
+	claude := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(529)
+			w.Write([]byte(`{"type": "error", "error": {"type": "overloaded_error", "message": "Overloaded"}}`))
+			return
+		}
+		w.Write([]byte(`{"content": [{"type": "text", "text": "the summary"}]}`))
+	})
+	claude.policy = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	got, err := claude.Generate(context.Background(), Prompt("prompt"))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got != "the summary" || calls != 2 {
+		t.Errorf("expected the summary after one retry, got %q after %d calls", got, calls)
+	}
+}
+
+func TestGenerate_AuthErrorIsPermanent(t *testing.T) {
+	calls := 0
+	claude := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"type": "error", "error": {"type": "authentication_error", "message": "invalid x-api-key"}}`))
+	})
+	claude.policy = retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: time.Millisecond}
+
+	_, err := claude.Generate(context.Background(), Prompt("prompt"))
+	var apiErr *retry.Error
+	if !errors.As(err, &apiErr) || apiErr.Kind != retry.Auth {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+	if calls != 1 {
+		t.Errorf("expected no retries, got %d calls", calls)
+	}
+}
+
+func TestGenerateSendsSystemAndOverrides(t *testing.T) {
+	var got claudeRequest
+	claude := newTestClaude(t, func(w http.ResponseWriter, r *http.Request) {
+		got = claudeRequest{}
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"content": [{"type": "text", "text": "ok"}]}`))
+	})
+
+	temperature := 0.3
+	_, err := claude.Generate(context.Background(), Request{
+		System:  "Eres un secretario de actas.",
+		Prompt:  "prompt",
+		Options: Options{Model: "claude-opus-5", MaxTokens: 16000, Temperature: &temperature},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got.System != "Eres un secretario de actas." || got.Model != "claude-opus-5" || got.MaxTokens != 16000 || got.Temperature == nil || *got.Temperature != 0.3 {
+		t.Errorf("unexpected request: %+v", got)
+	}
+
+	if _, err := claude.Generate(context.Background(), Prompt("prompt")); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if got.System != "" || got.Model != "claude-sonnet-5" || got.MaxTokens != 4000 || got.Temperature != nil {
+		t.Errorf("expected the configured settings without overrides, got %+v", got)
+	}
+}
@@ -0,0 +1,70 @@
+package llm
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sabhz/trani/internal/retry"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// Fallback is a Generator that tries several backends in order
+// (llm.backend, then llm.fallback), moving on to the next one when a
+// backend fails, after its own retries, in a way another backend might not
+// (see retry.CanFallBack): an outage, a rate limit, a rejected key or no
+// credit left. A request the backend found wrong is returned as is, since
+// the next one would most likely reject it too. It remembers which backends
+// answered, for Used.
+type Fallback struct {
+	names      []string
+	generators []Generator
+
+	mu   sync.Mutex
+	used []string
+}
+
+// Generate returns the reply of the first backend that succeeds. A model
+// named in r's options only means something to the first backend, so the
+// others get r with their configured model.
+func (f *Fallback) Generate(ctx context.Context, r Request) (string, error) {
+	var err error
+	for i, generator := range f.generators {
+		if i > 0 {
+			r.Options.Model = ""
+		}
+		var reply string
+		reply, err = generator.Generate(ctx, r)
+		if err == nil {
+			f.mu.Lock()
+			if !slices.Contains(f.used, f.names[i]) {
+				f.used = append(f.used, f.names[i])
+			}
+			f.mu.Unlock()
+			return reply, nil
+		}
+		if !retry.CanFallBack(err) || ctx.Err() != nil {
+			return "", fmt.Errorf("%s: %w", f.names[i], err)
+		}
+		if i+1 < len(f.generators) {
+			errlog.Warn("llm_fallback", "", fmt.Errorf("%s: %w", f.names[i], err), "next", f.names[i+1])
+		}
+	}
+	return "", fmt.Errorf("every llm backend failed, last %s: %w", f.names[len(f.names)-1], err)
+}
+
+// Used names the backends that have answered so far, in the order they
+// first did, joined with "+" (e.g. "claude+ollama" when a summary made in
+// parts fell back partway through). For a Generator that isn't a Fallback
+// chain, it's simply configured.
+func Used(g Generator, configured string) string {
+	f, ok := g.(*Fallback)
+	if !ok {
+		return configured
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return strings.Join(f.used, "+")
+}
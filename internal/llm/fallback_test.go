@@ -0,0 +1,166 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
+)
+
+// TestMain keeps every test's errlog lines out of the real log; tests that
+// check what's logged use tempHome.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "trani-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// tempHome points $HOME at a temp dir for the test, so that errlog writes
+// there rather than to the real log, and returns the log's contents so
+// far each time it's called.
+func tempHome(t *testing.T) func() string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return func() string {
+		log, _ := os.ReadFile(filepath.Join(home, ".config", "trani", "logs.jsonl"))
+		return string(log)
+	}
+}
+
+// scriptedGenerator fails with err if set, and otherwise returns reply.
+type scriptedGenerator struct {
+	reply string
+	err   error
+	calls int
+	last  Request
+}
+
+func (s *scriptedGenerator) Generate(ctx context.Context, r Request) (string, error) {
+	s.calls++
+	s.last = r
+	if s.err != nil {
+		return "", s.err
+	}
+	return s.reply, nil
+}
+
+func TestNewFallbackChain(t *testing.T) {
+	t.Setenv("ANTHROPIC_API_KEY", "test-key")
+	cfg := config.LLMConfig{
+		Backend:  "claude",
+		Fallback: []string{"ollama"},
+		Ollama:   config.OllamaConfig{BaseURL: "http://localhost:11434", Model: "llama3.2"},
+	}
+	g, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	if _, ok := g.(*Fallback); !ok {
+		t.Fatalf("expected a fallback chain, got %T", g)
+	}
+
+	cfg.Fallback = []string{"claude"}
+	if _, err := New(cfg); err == nil {
+		t.Error("expected an error when a backend is listed twice")
+	}
+
+	cfg.Fallback = []string{"ollama"}
+	cfg.Ollama.Model = ""
+	if _, err := New(cfg); err == nil {
+		t.Error("expected an error when a fallback backend is misconfigured")
+	}
+}
+
+func TestFallbackGenerate(t *testing.T) {
+	log := tempHome(t)
+	overloaded := &retry.Error{Kind: retry.Server, StatusCode: 529, Err: errors.New("Overloaded")}
+	primary := &scriptedGenerator{err: overloaded}
+	secondary := &scriptedGenerator{reply: "resumen"}
+	chain := &Fallback{names: []string{"claude", "ollama"}, generators: []Generator{primary, secondary}}
+
+	if Used(chain, "claude") != "" {
+		t.Errorf("expected no backends used yet, got %q", Used(chain, "claude"))
+	}
+
+	reply, err := chain.Generate(context.Background(), Prompt("prompt"))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if reply != "resumen" {
+		t.Errorf("expected the fallback's reply, got %q", reply)
+	}
+	if used := Used(chain, "claude"); used != "ollama" {
+		t.Errorf("expected ollama to be recorded, got %q", used)
+	}
+	if !strings.Contains(log(), `"event":"llm_fallback"`) || !strings.Contains(log(), `"next":"ollama"`) {
+		t.Errorf("expected the fallback logged, got %q", log())
+	}
+
+	primary.err = nil
+	primary.reply = "otro"
+	chain.Generate(context.Background(), Prompt("prompt"))
+	if used := Used(chain, "claude"); used != "ollama+claude" {
+		t.Errorf("expected both backends in order of first use, got %q", used)
+	}
+}
+
+func TestFallbackGenerateKeepsModelForPrimary(t *testing.T) {
+	primary := &scriptedGenerator{err: &retry.Error{Kind: retry.RateLimit, StatusCode: 429, Err: errors.New("slow down")}}
+	secondary := &scriptedGenerator{reply: "resumen"}
+	chain := &Fallback{names: []string{"claude", "ollama"}, generators: []Generator{primary, secondary}}
+
+	req := Request{System: "sistema", Prompt: "prompt", Options: Options{Model: "claude-opus-5", MaxTokens: 8000}}
+	if _, err := chain.Generate(context.Background(), req); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if primary.last.Options.Model != "claude-opus-5" {
+		t.Errorf("expected the primary to get the model, got %+v", primary.last)
+	}
+	if secondary.last.Options.Model != "" || secondary.last.Options.MaxTokens != 8000 || secondary.last.System != "sistema" {
+		t.Errorf("expected the fallback to keep its own model and everything else, got %+v", secondary.last)
+	}
+}
+
+func TestFallbackGenerateFallsBackOnAuthErrors(t *testing.T) {
+	primary := &scriptedGenerator{err: &retry.Error{Kind: retry.Auth, StatusCode: 401, Err: errors.New("invalid x-api-key")}}
+	secondary := &scriptedGenerator{reply: "resumen"}
+	chain := &Fallback{names: []string{"claude", "ollama"}, generators: []Generator{primary, secondary}}
+
+	reply, err := chain.Generate(context.Background(), Prompt("prompt"))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if reply != "resumen" || Used(chain, "claude") != "ollama" {
+		t.Errorf("expected ollama to answer after claude's 401, got %q from %q", reply, Used(chain, "claude"))
+	}
+}
+
+func TestFallbackGenerateStopsOnPermanentErrors(t *testing.T) {
+	primary := &scriptedGenerator{err: &retry.Error{Kind: retry.Client, StatusCode: 400, Err: errors.New("prompt is too long")}}
+	secondary := &scriptedGenerator{reply: "resumen"}
+	chain := &Fallback{names: []string{"claude", "ollama"}, generators: []Generator{primary, secondary}}
+
+	if _, err := chain.Generate(context.Background(), Prompt("prompt")); err == nil {
+		t.Fatal("expected the primary's permanent error")
+	}
+	if secondary.calls != 0 {
+		t.Error("the fallback shouldn't be tried after a permanent error")
+	}
+}
+
+func TestUsedWithoutFallback(t *testing.T) {
+	if used := Used(&scriptedGenerator{}, "claude"); used != "claude" {
+		t.Errorf("expected the configured backend, got %q", used)
+	}
+}
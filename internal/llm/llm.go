@@ -3,25 +3,73 @@ package llm
 import (
 	"context"
 	"fmt"
+	"slices"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
 type Generator interface {
-	Generate(ctx context.Context, prompt string) (string, error)
+	Generate(ctx context.Context, req Request) (string, error)
 }
 
+// Request is what to generate a reply to: a user prompt, with an optional
+// system message setting the model's role and overrides for the backend's
+// configured settings.
+type Request struct {
+	System  string
+	Prompt  string
+	Options Options
+}
+
+// Options override a backend's configured generation settings for one
+// request. Zero values keep the configured ones.
+type Options struct {
+	Model       string
+	MaxTokens   int
+	Temperature *float64
+}
+
+// Prompt is a Request for prompt alone, with the configured settings.
+func Prompt(prompt string) Request {
+	return Request{Prompt: prompt}
+}
+
+// New creates a Generator for the configured backend, or a Fallback chain
+// of it and the backends in cfg.Fallback.
 func New(cfg config.LLMConfig) (Generator, error) {
 	if cfg.Backend == "" {
 		return nil, fmt.Errorf("llm backend not configured")
 	}
+	if len(cfg.Fallback) == 0 {
+		return newBackend(cfg, cfg.Backend)
+	}
+
+	names := append([]string{cfg.Backend}, cfg.Fallback...)
+	generators := make([]Generator, 0, len(names))
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("llm backend %s listed twice in the fallback chain", name)
+		}
+		generator, err := newBackend(cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("fallback %s: %w", name, err)
+		}
+		generators = append(generators, generator)
+	}
+	return &Fallback{names: names, generators: generators}, nil
+}
 
-	switch cfg.Backend {
+func newBackend(cfg config.LLMConfig, backend string) (Generator, error) {
+	policy := retry.NewPolicy(cfg.Retry)
+	switch backend {
 	case "claude":
-		return NewClaude(cfg.Claude)
+		return NewClaude(cfg.Claude, policy)
 	case "ollama":
-		return NewOllama(cfg.Ollama)
+		return NewOllama(cfg.Ollama, policy)
+	case "openai_compatible":
+		return NewOpenAICompatible(cfg.OpenAICompatible, policy)
 	default:
-		return nil, fmt.Errorf("unknown llm backend: %s (supported: claude, ollama)", cfg.Backend)
+		return nil, fmt.Errorf("unknown llm backend: %s (supported: claude, ollama, openai_compatible)", backend)
 	}
 }
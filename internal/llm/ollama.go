@@ -10,15 +10,17 @@ import (
 	"strings"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
 type Ollama struct {
 	baseURL string
 	model   string
 	client  *http.Client
+	policy  retry.Policy
 }
 
-func NewOllama(cfg config.OllamaConfig) (Generator, error) {
+func NewOllama(cfg config.OllamaConfig, policy retry.Policy) (Generator, error) {
 	if cfg.Model == "" {
 		return nil, fmt.Errorf("ollama model not configured")
 	}
@@ -29,6 +31,7 @@ func NewOllama(cfg config.OllamaConfig) (Generator, error) {
 		baseURL: baseURL,
 		model:   cfg.Model,
 		client:  &http.Client{},
+		policy:  policy,
 	}, nil
 }
 
@@ -36,6 +39,14 @@ type ollamaRequest struct {
 	Model    string           `json:"model"`
 	Messages []ollamaMessage  `json:"messages"`
 	Stream   bool             `json:"stream"`
+	Options  *ollamaOptions   `json:"options,omitempty"`
+}
+
+// ollamaOptions are the model parameters a request overrides; num_predict
+// is Ollama's name for the output token limit.
+type ollamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
 }
 
 type ollamaMessage struct {
@@ -48,23 +59,43 @@ type ollamaResponse struct {
 	Error   string        `json:"error,omitempty"`
 }
 
-func (o *Ollama) Generate(ctx context.Context, prompt string) (string, error) {
+func (o *Ollama) Generate(ctx context.Context, r Request) (string, error) {
 	reqBody := ollamaRequest{
 		Model: o.model,
 		Messages: []ollamaMessage{
 			{
 				Role:    "user",
-				Content: prompt,
+				Content: r.Prompt,
 			},
 		},
 		Stream: false,
 	}
+	if r.System != "" {
+		reqBody.Messages = append([]ollamaMessage{{Role: "system", Content: r.System}}, reqBody.Messages...)
+	}
+	if r.Options.Model != "" {
+		reqBody.Model = r.Options.Model
+	}
+	if r.Options.Temperature != nil || r.Options.MaxTokens > 0 {
+		reqBody.Options = &ollamaOptions{Temperature: r.Options.Temperature, NumPredict: r.Options.MaxTokens}
+	}
 
 	data, err := json.Marshal(reqBody)
 	if err != nil {
 		return "", fmt.Errorf("failed to marshal request: %w", err)
 	}
 
+	var content string
+	err = retry.Do(ctx, o.policy, func(ctx context.Context) error {
+		var err error
+		content, err = o.send(ctx, data)
+		return err
+	})
+	return content, err
+}
+
+// send makes a single request to Ollama's chat API.
+func (o *Ollama) send(ctx context.Context, data []byte) (string, error) {
 	url := o.baseURL + "/api/chat"
 	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(data))
 	if err != nil {
@@ -75,17 +106,17 @@ func (o *Ollama) Generate(ctx context.Context, prompt string) (string, error) {
 
 	resp, err := o.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return "", retry.FromTransport(fmt.Errorf("failed to send request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", retry.FromTransport(fmt.Errorf("failed to read response: %w", err))
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body))
+		return "", retry.FromResponse(resp, fmt.Errorf("ollama API returned status %d: %s", resp.StatusCode, string(body)))
 	}
 
 	var result ollamaResponse
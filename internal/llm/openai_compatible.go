@@ -0,0 +1,168 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
+)
+
+// OpenAICompatible is a client for servers implementing the OpenAI chat
+// completions API, such as llama.cpp's llama-server, vLLM or LM Studio.
+type OpenAICompatible struct {
+	baseURL     string
+	model       string
+	apiKey      string
+	temperature *float64
+	maxTokens   int
+	client      *http.Client
+	policy      retry.Policy
+}
+
+func NewOpenAICompatible(cfg config.OpenAICompatibleConfig, policy retry.Policy) (Generator, error) {
+	if cfg.BaseURL == "" {
+		return nil, fmt.Errorf("openai_compatible base_url not configured")
+	}
+
+	var apiKey string
+	if cfg.APIKeyEnv != "" {
+		apiKey = os.Getenv(cfg.APIKeyEnv)
+		if apiKey == "" {
+			return nil, fmt.Errorf("%s environment variable not set", cfg.APIKeyEnv)
+		}
+	}
+
+	return &OpenAICompatible{
+		baseURL:     strings.TrimSuffix(cfg.BaseURL, "/"),
+		model:       cfg.Model,
+		apiKey:      apiKey,
+		temperature: cfg.Temperature,
+		maxTokens:   cfg.MaxTokens,
+		client:      &http.Client{},
+		policy:      policy,
+	}, nil
+}
+
+// chatRequest represents the request body for the chat completions API.
+// Model is optional for servers that only ever serve one (llama-server).
+type chatRequest struct {
+	Model       string        `json:"model,omitempty"`
+	Messages    []chatMessage `json:"messages"`
+	Temperature *float64      `json:"temperature,omitempty"`
+	MaxTokens   int           `json:"max_tokens,omitempty"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// chatMessages turns r into the system and user messages of a chat.
+func chatMessages(r Request) []chatMessage {
+	var messages []chatMessage
+	if r.System != "" {
+		messages = append(messages, chatMessage{Role: "system", Content: r.System})
+	}
+	return append(messages, chatMessage{Role: "user", Content: r.Prompt})
+}
+
+// chatResponse represents the response from the chat completions API.
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Generate sends a prompt as a single user message, after the system
+// message if there is one, and returns the reply.
+func (o *OpenAICompatible) Generate(ctx context.Context, r Request) (string, error) {
+	reqBody := chatRequest{
+		Model:       o.model,
+		Messages:    chatMessages(r),
+		Temperature: o.temperature,
+		MaxTokens:   o.maxTokens,
+	}
+	if r.Options.Model != "" {
+		reqBody.Model = r.Options.Model
+	}
+	if r.Options.MaxTokens > 0 {
+		reqBody.MaxTokens = r.Options.MaxTokens
+	}
+	if r.Options.Temperature != nil {
+		reqBody.Temperature = r.Options.Temperature
+	}
+
+	data, err := json.Marshal(reqBody)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	var content string
+	err = retry.Do(ctx, o.policy, func(ctx context.Context) error {
+		var err error
+		content, err = o.send(ctx, data)
+		return err
+	})
+	return content, err
+}
+
+// send makes a single request to the chat completions API.
+func (o *OpenAICompatible) send(ctx context.Context, data []byte) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", o.baseURL+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", retry.FromTransport(fmt.Errorf("failed to send request: %w", err))
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", retry.FromTransport(fmt.Errorf("failed to read response: %w", err))
+	}
+
+	var result chatResponse
+	if resp.StatusCode != http.StatusOK {
+		if json.Unmarshal(body, &result) == nil && result.Error != nil {
+			return "", retry.FromResponse(resp, fmt.Errorf("chat completions API error: %s", result.Error.Message))
+		}
+		return "", retry.FromResponse(resp, fmt.Errorf("chat completions API returned status %d: %s", resp.StatusCode, string(body)))
+	}
+
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if result.Error != nil {
+		return "", fmt.Errorf("chat completions API error: %s", result.Error.Message)
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("no choices in chat completions response")
+	}
+
+	// A reply cut off at max_tokens would be written as if it were the
+	// whole summary.
+	if result.Choices[0].FinishReason == "length" {
+		return "", fmt.Errorf("the reply was cut off by the output token limit; raise max_tokens")
+	}
+
+	return result.Choices[0].Message.Content, nil
+}
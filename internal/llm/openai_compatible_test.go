@@ -0,0 +1,151 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
+)
+
+func newTestOpenAICompatible(t *testing.T, cfg config.OpenAICompatibleConfig, handler http.HandlerFunc) *OpenAICompatible {
+	t.Helper()
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	cfg.BaseURL = server.URL + "/v1/"
+	g, err := NewOpenAICompatible(cfg, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewOpenAICompatible failed: %v", err)
+	}
+	client := g.(*OpenAICompatible)
+	client.client = server.Client()
+	return client
+}
+
+func TestOpenAICompatibleGenerate(t *testing.T) {
+	t.Setenv("TRANI_TEST_LLM_KEY", "secret")
+	temperature := 0.2
+
+	var got chatRequest
+	client := newTestOpenAICompatible(t, config.OpenAICompatibleConfig{
+		Model:       "qwen2.5-7b-instruct",
+		APIKeyEnv:   "TRANI_TEST_LLM_KEY",
+		Temperature: &temperature,
+		MaxTokens:   2000,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Bearer secret" {
+			t.Errorf("unexpected Authorization header %q", auth)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"choices": [{"message": {"role": "assistant", "content": "the summary"}, "finish_reason": "stop"}]}`))
+	})
+
+	reply, err := client.Generate(context.Background(), Prompt("prompt"))
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	if reply != "the summary" {
+		t.Errorf("expected %q, got %q", "the summary", reply)
+	}
+
+	if got.Model != "qwen2.5-7b-instruct" || got.MaxTokens != 2000 || got.Temperature == nil || *got.Temperature != 0.2 {
+		t.Errorf("unexpected request: %+v", got)
+	}
+	if len(got.Messages) != 1 || got.Messages[0].Role != "user" || got.Messages[0].Content != "prompt" {
+		t.Errorf("unexpected messages: %+v", got.Messages)
+	}
+}
+
+func TestOpenAICompatibleOmitsUnsetOptions(t *testing.T) {
+	var raw map[string]any
+	client := newTestOpenAICompatible(t, config.OpenAICompatibleConfig{}, func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			t.Errorf("expected no Authorization header, got %q", auth)
+		}
+		json.NewDecoder(r.Body).Decode(&raw)
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}]}`))
+	})
+
+	if _, err := client.Generate(context.Background(), Prompt("prompt")); err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+	for _, key := range []string{"model", "temperature", "max_tokens"} {
+		if _, ok := raw[key]; ok {
+			t.Errorf("expected %q to be left out of the request, got %v", key, raw[key])
+		}
+	}
+}
+
+func TestOpenAICompatibleRequestOverrides(t *testing.T) {
+	configured, override := 0.2, 0.7
+
+	var got chatRequest
+	client := newTestOpenAICompatible(t, config.OpenAICompatibleConfig{
+		Model:       "qwen2.5-7b-instruct",
+		Temperature: &configured,
+		MaxTokens:   2000,
+	}, func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&got)
+		w.Write([]byte(`{"choices": [{"message": {"content": "ok"}, "finish_reason": "stop"}]}`))
+	})
+
+	_, err := client.Generate(context.Background(), Request{
+		System:  "Eres un secretario de actas.",
+		Prompt:  "prompt",
+		Options: Options{Model: "qwen2.5-72b-instruct", MaxTokens: 8000, Temperature: &override},
+	})
+	if err != nil {
+		t.Fatalf("Generate failed: %v", err)
+	}
+
+	if got.Model != "qwen2.5-72b-instruct" || got.MaxTokens != 8000 || got.Temperature == nil || *got.Temperature != 0.7 {
+		t.Errorf("expected the request's options to win, got %+v", got)
+	}
+	if len(got.Messages) != 2 || got.Messages[0].Role != "system" || got.Messages[0].Content != "Eres un secretario de actas." || got.Messages[1].Role != "user" {
+		t.Errorf("expected a system message before the prompt, got %+v", got.Messages)
+	}
+}
+
+func TestOpenAICompatibleErrors(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"API error", http.StatusBadRequest, `{"error": {"message": "the request exceeds the available context size"}}`},
+		{"plain error status", http.StatusInternalServerError, `oops`},
+		{"no choices", http.StatusOK, `{"choices": []}`},
+		{"cut off at the token limit", http.StatusOK, `{"choices": [{"message": {"content": "half a summ"}, "finish_reason": "length"}]}`},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			client := newTestOpenAICompatible(t, config.OpenAICompatibleConfig{}, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(c.status)
+				w.Write([]byte(c.body))
+			})
+			if _, err := client.Generate(context.Background(), Prompt("prompt")); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestNewOpenAICompatibleMissingAPIKey(t *testing.T) {
+	t.Setenv("TRANI_TEST_LLM_KEY", "")
+	_, err := NewOpenAICompatible(config.OpenAICompatibleConfig{BaseURL: "http://localhost:8080/v1", APIKeyEnv: "TRANI_TEST_LLM_KEY"}, retry.Policy{})
+	if err == nil {
+		t.Error("expected an error when the API key variable is empty")
+	}
+}
@@ -0,0 +1,201 @@
+// Package retry classifies failed calls to transcription and LLM APIs and
+// retries the ones worth retrying, with exponential backoff.
+package retry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// Kind is what went wrong with an API call, as far as retrying goes.
+type Kind string
+
+const (
+	Network   Kind = "network"    // no response: refused, reset or timed out
+	RateLimit Kind = "rate_limit" // 429
+	Auth      Kind = "auth"       // 401, 403: a missing or wrong key, or no quota left
+	Quota     Kind = "quota"      // 402, or a 400 about billing: the account is out of credit
+	Server    Kind = "server"     // 5xx (Anthropic's 529 overloaded included), 408
+	Client    Kind = "client"     // any other 4xx: the request itself is wrong
+)
+
+// Error is a failed API call. It wraps the backend's own error, so its
+// message is unchanged, and adds what kind of failure it was.
+type Error struct {
+	Kind       Kind
+	StatusCode int           // 0 when there was no response
+	RetryAfter time.Duration // what the server asked for with Retry-After, if anything
+	Err        error
+}
+
+func (e *Error) Error() string { return e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorKind returns e.Kind as a string, for logging without importing this
+// package (see errlog).
+func (e *Error) ErrorKind() string { return string(e.Kind) }
+
+// Retryable reports whether the same call could succeed if made again.
+func (e *Error) Retryable() bool {
+	return e.Kind == Network || e.Kind == RateLimit || e.Kind == Server
+}
+
+// IsRetryable reports whether err is, or wraps, a retryable Error.
+func IsRetryable(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && apiErr.Retryable()
+}
+
+// CanFallBack reports whether another backend could succeed where the one
+// that failed with err couldn't: after anything retrying could fix, but
+// also after a failure that's down to that backend's account, such as a
+// rejected key or no credit left, which a local backend doesn't have.
+func CanFallBack(err error) bool {
+	var apiErr *Error
+	return errors.As(err, &apiErr) && (apiErr.Retryable() || apiErr.Kind == Auth || apiErr.Kind == Quota)
+}
+
+// FromResponse classifies err, describing a non-200 resp, by its status
+// code, and keeps the Retry-After the server sent with it. A 400 is only
+// told apart from a bad request by err's message (Anthropic's "Your credit
+// balance is too low").
+func FromResponse(resp *http.Response, err error) *Error {
+	kind := Client
+	switch code := resp.StatusCode; {
+	case code == http.StatusTooManyRequests:
+		kind = RateLimit
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		kind = Auth
+	case code == http.StatusPaymentRequired || code == http.StatusBadRequest && isBillingError(err):
+		kind = Quota
+	case code >= 500 || code == http.StatusRequestTimeout:
+		kind = Server
+	}
+	return &Error{
+		Kind:       kind,
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		Err:        err,
+	}
+}
+
+func isBillingError(err error) bool {
+	msg := strings.ToLower(err.Error())
+	return strings.Contains(msg, "credit balance") || strings.Contains(msg, "billing") || strings.Contains(msg, "quota")
+}
+
+// FromTransport classifies err, from sending a request or reading its
+// response, as a network failure.
+func FromTransport(err error) *Error {
+	return &Error{Kind: Network, Err: err}
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date. Returns 0 if there's none or it can't be parsed.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// Policy is how a call is retried. The zero Policy makes a single attempt
+// with no timeout.
+type Policy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Timeout        time.Duration // per attempt
+}
+
+// NewPolicy returns the Policy cfg describes.
+func NewPolicy(cfg config.RetryConfig) Policy {
+	return Policy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoffSeconds) * time.Second,
+		MaxBackoff:     time.Duration(cfg.MaxBackoffSeconds) * time.Second,
+		Timeout:        time.Duration(cfg.TimeoutSeconds) * time.Second,
+	}
+}
+
+// Do calls fn until it succeeds, fails with an error that isn't retryable,
+// or the policy's attempts run out, and returns its last error. An attempt
+// that runs past the policy's timeout counts as a network failure. It stops
+// early, without waiting, if ctx is done or the server asks to wait longer
+// (Retry-After) than the policy's longest backoff.
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := p.attempt(ctx, fn)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if attempt >= p.MaxAttempts || !IsRetryable(err) {
+			return err
+		}
+
+		wait := p.backoff(attempt)
+		var apiErr *Error
+		if errors.As(err, &apiErr) && apiErr.RetryAfter > wait {
+			if apiErr.RetryAfter > p.MaxBackoff {
+				return err
+			}
+			wait = apiErr.RetryAfter
+		}
+
+		errlog.Warn("retry", "", err, "wait", wait.Round(time.Second).String(), "attempt", attempt+1, "max_attempts", p.MaxAttempts)
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (p Policy) attempt(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Timeout <= 0 {
+		return fn(ctx)
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, p.Timeout)
+	defer cancel()
+	err := fn(attemptCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(attemptCtx.Err(), context.DeadlineExceeded) && !IsRetryable(err) {
+		err = &Error{Kind: Network, Err: fmt.Errorf("no response within %s: %w", p.Timeout, err)}
+	}
+	return err
+}
+
+// backoff is how long to wait before attempt+1: InitialBackoff doubled for
+// every attempt so far, capped at MaxBackoff, of which a random half is
+// taken off so that clients failing together don't retry together.
+func (p Policy) backoff(attempt int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < attempt && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 {
+		d = min(d, p.MaxBackoff)
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
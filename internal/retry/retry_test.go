@@ -0,0 +1,205 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestMain keeps every test's errlog lines out of the real log; tests that
+// check what's logged use tempHome.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "trani-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// tempHome points $HOME at a temp dir for the test, so that errlog writes
+// there rather than to the real log, and returns the log's contents so
+// far each time it's called.
+func tempHome(t *testing.T) func() string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return func() string {
+		log, _ := os.ReadFile(filepath.Join(home, ".config", "trani", "logs.jsonl"))
+		return string(log)
+	}
+}
+
+func testPolicy(attempts int) Policy {
+	return Policy{MaxAttempts: attempts, InitialBackoff: time.Millisecond, MaxBackoff: 10 * time.Millisecond}
+}
+
+func TestFromResponseKinds(t *testing.T) {
+	cases := []struct {
+		status    int
+		kind      Kind
+		retryable bool
+	}{
+		{http.StatusTooManyRequests, RateLimit, true},
+		{http.StatusUnauthorized, Auth, false},
+		{http.StatusForbidden, Auth, false},
+		{http.StatusInternalServerError, Server, true},
+		{529, Server, true},
+		{http.StatusRequestTimeout, Server, true},
+		{http.StatusBadRequest, Client, false},
+		{http.StatusPaymentRequired, Quota, false},
+		{http.StatusRequestEntityTooLarge, Client, false},
+	}
+
+	for _, c := range cases {
+		err := FromResponse(&http.Response{StatusCode: c.status, Header: http.Header{}}, errors.New("failed"))
+		if err.Kind != c.kind || err.Retryable() != c.retryable {
+			t.Errorf("status %d: expected %s (retryable %v), got %s (retryable %v)", c.status, c.kind, c.retryable, err.Kind, err.Retryable())
+		}
+	}
+}
+
+func TestFromResponseBillingErrors(t *testing.T) {
+	resp := &http.Response{StatusCode: http.StatusBadRequest, Header: http.Header{}}
+	err := FromResponse(resp, errors.New("Claude API error: Your credit balance is too low to access the Anthropic API."))
+	if err.Kind != Quota {
+		t.Errorf("expected a 400 about credit to be %s, got %s", Quota, err.Kind)
+	}
+	if !CanFallBack(err) || err.Retryable() {
+		t.Error("expected a quota error to fall back without being retried")
+	}
+
+	if err := FromResponse(resp, errors.New("prompt is too long")); CanFallBack(err) {
+		t.Error("expected a plain bad request not to fall back")
+	}
+	if !CanFallBack(&Error{Kind: Auth, StatusCode: http.StatusUnauthorized, Err: errors.New("invalid key")}) {
+		t.Error("expected an auth error to fall back")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 15, 14, 30, 0, 0, time.UTC)
+	cases := map[string]time.Duration{
+		"":                              0,
+		"30":                            30 * time.Second,
+		"soon":                          0,
+		"Thu, 15 Jan 2026 14:31:00 GMT": time.Minute,
+		"Thu, 15 Jan 2026 14:29:00 GMT": 0,
+	}
+	for value, expected := range cases {
+		if got := parseRetryAfter(value, now); got != expected {
+			t.Errorf("parseRetryAfter(%q): expected %s, got %s", value, expected, got)
+		}
+	}
+}
+
+func TestDoRetriesRetryableErrors(t *testing.T) {
+	log := tempHome(t)
+	calls := 0
+	err := Do(context.Background(), testPolicy(4), func(ctx context.Context) error {
+		calls++
+		if calls < 3 {
+			return &Error{Kind: Server, StatusCode: 529, Err: errors.New("overloaded")}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+	if n := strings.Count(log(), `"event":"retry"`); n != 2 {
+		t.Errorf("expected both retries logged, got %d", n)
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	calls := 0
+	err := Do(context.Background(), testPolicy(3), func(ctx context.Context) error {
+		calls++
+		return FromTransport(errors.New("connection refused"))
+	})
+	if !IsRetryable(err) {
+		t.Errorf("expected the last retryable error, got %v", err)
+	}
+	if calls != 3 {
+		t.Errorf("expected 3 calls, got %d", calls)
+	}
+}
+
+func TestDoStopsOnPermanentErrors(t *testing.T) {
+	for _, err := range []error{
+		&Error{Kind: Auth, StatusCode: 401, Err: errors.New("invalid key")},
+		errors.New("failed to parse response"),
+	} {
+		calls := 0
+		got := Do(context.Background(), testPolicy(4), func(ctx context.Context) error {
+			calls++
+			return err
+		})
+		if got != err || calls != 1 {
+			t.Errorf("%v: expected a single call returning it, got %d calls and %v", err, calls, got)
+		}
+	}
+}
+
+func TestDoRetryAfterPastMaxBackoff(t *testing.T) {
+	calls := 0
+	Do(context.Background(), testPolicy(4), func(ctx context.Context) error {
+		calls++
+		return &Error{Kind: RateLimit, StatusCode: 429, RetryAfter: time.Hour, Err: errors.New("slow down")}
+	})
+	if calls != 1 {
+		t.Errorf("expected no retry when Retry-After exceeds the longest backoff, got %d calls", calls)
+	}
+}
+
+func TestDoAttemptTimeout(t *testing.T) {
+	policy := testPolicy(2)
+	policy.Timeout = 10 * time.Millisecond
+
+	calls := 0
+	err := Do(context.Background(), policy, func(ctx context.Context) error {
+		calls++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if calls != 2 {
+		t.Errorf("expected a timed out attempt to be retried, got %d calls", calls)
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.Kind != Network {
+		t.Errorf("expected a network error, got %v", err)
+	}
+}
+
+func TestDoStopsWhenContextDone(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	Do(ctx, testPolicy(4), func(ctx context.Context) error {
+		calls++
+		cancel()
+		return FromTransport(context.Canceled)
+	})
+	if calls != 1 {
+		t.Errorf("expected no retry once the context is done, got %d calls", calls)
+	}
+}
+
+func TestBackoffGrowsUpToMax(t *testing.T) {
+	policy := Policy{InitialBackoff: time.Second, MaxBackoff: 8 * time.Second}
+	for attempt, limit := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 8 * time.Second} {
+		d := policy.backoff(attempt + 1)
+		if d < limit/2 || d > limit {
+			t.Errorf("attempt %d: expected a backoff between %s and %s, got %s", attempt+1, limit/2, limit, d)
+		}
+	}
+}
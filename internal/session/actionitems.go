@@ -0,0 +1,218 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/errlog"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// With postprocess.action_items, once a session's summary is written, the
+// model is asked for the session's action items as JSON, which is checked
+// against actionItem's schema. They're written to the note as Obsidian
+// tasks in a "## Tareas" section, and as structured data in its
+// frontmatter, and appended to postprocess.tasks_file, if set, with a link
+// back to the note.
+
+// actionItemsStep is what the "## Tareas" section's marker records as the
+// step that wrote it (see formatStepSection).
+const actionItemsStep = "action_items"
+
+// actionItem is one action item, as the model must return it:
+//
+//	{"items": [{"task": "Enviar el presupuesto", "owner": "Ana", "due": "2026-01-20"}]}
+//
+// task is required; owner and due may be empty or null, and due must be a
+// date as YYYY-MM-DD. Any other field is an error.
+type actionItem struct {
+	Task  string `json:"task" yaml:"task"`
+	Owner string `json:"owner" yaml:"owner,omitempty"`
+	Due   string `json:"due" yaml:"due,omitempty"`
+}
+
+// task formats the item as an Obsidian task, with link before the due
+// date (which the Tasks plugin expects last) if there's one.
+func (i actionItem) task(link string) string {
+	line := "- [ ] " + i.Task
+	if i.Owner != "" {
+		line += " — " + i.Owner
+	}
+	if link != "" {
+		line += " " + link
+	}
+	if i.Due != "" {
+		line += " 📅 " + i.Due
+	}
+	return line
+}
+
+// writeActionItems extracts the session's action items and writes them to
+// the note and the tasks file, if postprocess.action_items is on. It runs
+// after the summary, so the note it reads already has it; the section is
+// placed like the summary. A failure is notified and logged, leaving the
+// note as the summary left it.
+func writeActionItems(ctx context.Context, cfg *config.Config, llms *llmClients, notePath, transcription string, headStart *summaryHeadStart, promptTemplate, sessionTitle string, data promptData, placement summaryPlacement, notifier *notify.Notifier) error {
+	if !cfg.Postprocess.ActionItems {
+		return nil
+	}
+
+	err := func() error {
+		raw, err := os.ReadFile(notePath)
+		if err != nil {
+			return fmt.Errorf("failed to read note: %w", err)
+		}
+		content := string(raw)
+
+		data = data.withNote(strings.TrimSpace(stripResumenSections(content)))
+		items, err := extractActionItems(ctx, llms, cfg.Paths.PromptsDir, promptTemplate, transcription, headStart, data, cfg.LLM.MaxPromptTokens)
+		if err != nil {
+			return err
+		}
+
+		tasks := make([]string, len(items))
+		for i, item := range items {
+			tasks[i] = item.task("")
+		}
+		body := strings.Join(tasks, "\n")
+		if len(items) == 0 {
+			body = "No se identificaron tareas."
+		}
+		section := formatStepSection(sessionTitle, actionItemsStep, "Tareas", time.Now(), body)
+		content = placeStepSection(content, section, sessionTitle, actionItemsStep, placement)
+		if content, err = setFrontmatterField(content, "action_items", items); err != nil {
+			return err
+		}
+		if err := os.WriteFile(notePath, []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to update note: %w", err)
+		}
+
+		if path := tasksFilePath(cfg); path != "" {
+			link := "[[" + strings.TrimSuffix(filepath.Base(notePath), filepath.Ext(notePath)) + "]]"
+			return appendTasks(path, items, link)
+		}
+		return nil
+	}()
+	if err != nil {
+		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al extraer tareas (%s): %v", sessionTitle, err))
+		errlog.Error("action_items", sessionTitle, err)
+	}
+	return err
+}
+
+// extractActionItems asks for the action items with templateName's
+// _action_items.txt prompt (falling back to default_action_items.txt).
+func extractActionItems(ctx context.Context, llms *llmClients, promptsDir, templateName, transcription string, headStart *summaryHeadStart, data promptData, maxTokens int) ([]actionItem, error) {
+	prompt, err := loadPromptFile(promptsDir, templateName, "_action_items.txt")
+	if err != nil {
+		return nil, err
+	}
+	req, err := renderWithTranscript(ctx, llms, prompt, promptsDir, templateName, transcription, headStart, data, maxTokens)
+	if err != nil {
+		return nil, err
+	}
+
+	var items []actionItem
+	err = llms.generateValid(ctx, prompt.settings.Backend, req, func(reply string) (err error) {
+		items, err = parseActionItems(reply)
+		return err
+	})
+	return items, err
+}
+
+// parseActionItems parses and checks a reply against actionItem's schema.
+func parseActionItems(reply string) ([]actionItem, error) {
+	var parsed struct {
+		Items *[]actionItem `json:"items"`
+	}
+	if err := decodeReply(reply, &parsed); err != nil {
+		return nil, err
+	}
+	if parsed.Items == nil {
+		return nil, fmt.Errorf(`missing "items"`)
+	}
+
+	items := *parsed.Items
+	for i := range items {
+		item := &items[i]
+		item.Task = strings.Join(strings.Fields(item.Task), " ")
+		item.Owner = strings.Join(strings.Fields(item.Owner), " ")
+		item.Due = strings.TrimSpace(item.Due)
+		if item.Task == "" {
+			return nil, fmt.Errorf("item %d has no task", i+1)
+		}
+		if item.Due != "" {
+			if _, err := time.Parse("2006-01-02", item.Due); err != nil {
+				return nil, fmt.Errorf("item %d: due %q isn't a YYYY-MM-DD date", i+1, item.Due)
+			}
+		}
+	}
+	return items, nil
+}
+
+// tasksFilePath is where postprocess.tasks_file is, "" if it isn't set.
+// A relative path is relative to the vault, or to sessions_dir without
+// one.
+func tasksFilePath(cfg *config.Config) string {
+	path := cfg.Postprocess.TasksFile
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	if cfg.Obsidian.VaultPath != "" {
+		return filepath.Join(cfg.Obsidian.VaultPath, path)
+	}
+	return filepath.Join(cfg.Paths.SessionsDir, path)
+}
+
+// appendTasks appends items to the tasks file as tasks linking back to
+// their note, in a single write. Items the file already has for the note,
+// checked off or not, aren't added again, so postprocessing a session again
+// doesn't duplicate its tasks.
+func appendTasks(path string, items []actionItem, link string) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read tasks file: %w", err)
+	}
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(existing), "\n") {
+		if line = strings.TrimSpace(line); len(line) > len("- [ ] ") && strings.HasPrefix(line, "- [") {
+			have[line[len("- [ ] "):]] = true
+		}
+	}
+
+	var b strings.Builder
+	if len(existing) > 0 && !bytes.HasSuffix(existing, []byte("\n")) {
+		b.WriteString("\n")
+	}
+	added := false
+	for _, item := range items {
+		task := item.task(link)
+		if have[task[len("- [ ] "):]] {
+			continue
+		}
+		b.WriteString(task + "\n")
+		added = true
+	}
+	if !added {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create tasks file directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open tasks file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(b.String()); err != nil {
+		return fmt.Errorf("failed to append to tasks file: %w", err)
+	}
+	return nil
+}
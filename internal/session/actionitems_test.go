@@ -0,0 +1,150 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// replyingGenerator answers with replies in order, repeating the last one,
+// and keeps the prompts it got.
+type replyingGenerator struct {
+	replies []string
+	prompts []string
+}
+
+func (g *replyingGenerator) Generate(ctx context.Context, req llm.Request) (string, error) {
+	g.prompts = append(g.prompts, req.Prompt)
+	return g.replies[min(len(g.prompts), len(g.replies))-1], nil
+}
+
+func TestParseActionItems(t *testing.T) {
+	items, err := parseActionItems("```json\n{\"items\": [{\"task\": \"Enviar\\nel presupuesto\", \"owner\": null, \"due\": \"2026-01-20\"}, {\"task\": \"Revisar\"}]}\n```")
+	if err != nil {
+		t.Fatalf("parseActionItems failed: %v", err)
+	}
+	expected := []actionItem{{Task: "Enviar el presupuesto", Due: "2026-01-20"}, {Task: "Revisar"}}
+	if len(items) != len(expected) || items[0] != expected[0] || items[1] != expected[1] {
+		t.Errorf("expected %+v, got %+v", expected, items)
+	}
+
+	if items, err := parseActionItems(`{"items": []}`); err != nil || len(items) != 0 {
+		t.Errorf("expected no items, got %+v (%v)", items, err)
+	}
+
+	for name, reply := range map[string]string{
+		"not JSON":      "Estas son las tareas: ...",
+		"missing items": `{"tareas": []}`,
+		"no items key":  `{}`,
+		"unknown field": `{"items": [{"task": "a", "priority": "alta"}]}`,
+		"empty task":    `{"items": [{"task": " ", "owner": "Ana"}]}`,
+		"bad due":       `{"items": [{"task": "a", "due": "el viernes"}]}`,
+		"trailing text": `{"items": []} espero que sirva`,
+	} {
+		if _, err := parseActionItems(reply); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestWriteActionItems(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.Postprocess.ActionItems = true
+	cfg.Postprocess.TasksFile = "Tareas.md"
+	cfg.Obsidian.VaultPath = t.TempDir()
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+
+	notePath := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 1430.md")
+	original := "---\nasistentes: [Ana]\n---\nmis notas\n\n" + formatResumenSection("2026-01-15 1430", resumenTestTime, "El resumen.")
+	if err := os.WriteFile(notePath, []byte(original), 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+	tasksPath := filepath.Join(cfg.Obsidian.VaultPath, "Tareas.md")
+	if err := os.WriteFile(tasksPath, []byte("# Tareas"), 0644); err != nil {
+		t.Fatalf("failed to write tasks file: %v", err)
+	}
+
+	// The first reply isn't valid, so it's asked for again.
+	llmClient := &replyingGenerator{replies: []string{
+		"Aquí van las tareas",
+		`{"items": [{"task": "Enviar el presupuesto", "owner": "Ana", "due": "2026-01-20"}, {"task": "Revisar fechas", "owner": "", "due": ""}]}`,
+	}}
+	llms := newLLMClients(config.LLMConfig{}, llmClient)
+	if err := writeActionItems(context.Background(), cfg, llms, notePath, "la transcripción", nil, "default", "2026-01-15 1430", promptData{}, placeOwn, notify.New()); err != nil {
+		t.Fatalf("writeActionItems failed: %v", err)
+	}
+
+	if len(llmClient.prompts) != 2 || !strings.Contains(llmClient.prompts[1], "Aquí van las tareas") {
+		t.Fatalf("expected one retry quoting the invalid reply, got %q", llmClient.prompts)
+	}
+	if strings.Contains(llmClient.prompts[0], "El resumen.") {
+		t.Errorf("expected the summary left out of the notes, got %q", llmClient.prompts[0])
+	}
+
+	note, err := os.ReadFile(notePath)
+	if err != nil {
+		t.Fatalf("failed to read note: %v", err)
+	}
+	if !strings.Contains(string(note), "## Tareas\n\n- [ ] Enviar el presupuesto — Ana 📅 2026-01-20\n- [ ] Revisar fechas\n") {
+		t.Errorf("expected the tasks section, got %q", note)
+	}
+	if !strings.HasPrefix(string(note), "---\nasistentes: [Ana]\naction_items:\n    - task: Enviar el presupuesto\n      owner: Ana\n      due: \"2026-01-20\"\n    - task: Revisar fechas\n---\n") {
+		t.Errorf("expected the items in the frontmatter, got %q", note)
+	}
+
+	expectedTasks := "# Tareas\n- [ ] Enviar el presupuesto — Ana [[2026-01-15 1430]] 📅 2026-01-20\n- [ ] Revisar fechas [[2026-01-15 1430]]\n"
+	if tasks, _ := os.ReadFile(tasksPath); string(tasks) != expectedTasks {
+		t.Errorf("expected tasks file %q, got %q", expectedTasks, tasks)
+	}
+
+	// Again, with one of them checked off in the tasks file: the section is
+	// replaced, and nothing is added twice.
+	checked := strings.Replace(expectedTasks, "- [ ] Revisar", "- [x] Revisar", 1)
+	if err := os.WriteFile(tasksPath, []byte(checked), 0644); err != nil {
+		t.Fatalf("failed to write tasks file: %v", err)
+	}
+	if err := writeActionItems(context.Background(), cfg, llms, notePath, "la transcripción", nil, "default", "2026-01-15 1430", promptData{}, placeOwn, notify.New()); err != nil {
+		t.Fatalf("second writeActionItems failed: %v", err)
+	}
+	note, _ = os.ReadFile(notePath)
+	if strings.Count(string(note), "## Tareas") != 1 || strings.Count(string(note), "action_items:") != 1 {
+		t.Errorf("expected the section and field replaced, got %q", note)
+	}
+	if tasks, _ := os.ReadFile(tasksPath); string(tasks) != checked {
+		t.Errorf("expected the tasks file unchanged, got %q", tasks)
+	}
+}
+
+func TestWriteActionItemsInvalidTwice(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.Postprocess.ActionItems = true
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+	notePath := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 1430.md")
+	if err := os.WriteFile(notePath, []byte("mis notas\n"), 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+
+	llmClient := &replyingGenerator{replies: []string{"no sé"}}
+	llms := newLLMClients(config.LLMConfig{}, llmClient)
+	if err := writeActionItems(context.Background(), cfg, llms, notePath, "hola", nil, "default", "2026-01-15 1430", promptData{}, placeOwn, notify.New()); err == nil {
+		t.Fatal("expected an error after two invalid replies")
+	}
+	if len(llmClient.prompts) != 2 {
+		t.Errorf("expected exactly one retry, got %d prompts", len(llmClient.prompts))
+	}
+	if note, _ := os.ReadFile(notePath); string(note) != "mis notas\n" {
+		t.Errorf("expected the note untouched, got %q", note)
+	}
+}
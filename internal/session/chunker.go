@@ -5,12 +5,15 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
 	"github.com/sabhz/trani/internal/config"
 	"github.com/sabhz/trani/internal/transcribe"
+	"github.com/sabhz/trani/pkg/errlog"
 )
 
 // chunkPollInterval is how often the chunker checks for newly closed
@@ -19,19 +22,46 @@ const chunkPollInterval = 20 * time.Second
 
 // chunker watches a recorder's segmented chunk files as they close and
 // transcribes them progressively, appending results to the session's
-// .sources/<title>.txt and .wav files as it goes. This lets most of the
+// .sources/<title>.txt, .srt, .vtt and .wav files as it goes. This lets most of the
 // transcription work happen while the recording is still in progress
 // instead of all at once when the session stops.
 type chunker struct {
 	cfg         *config.Config
+	title       string
 	notePath    string
 	recorder    *audio.Recorder
 	transcriber transcribe.Transcriber
 
 	txtPath string
+	srtPath string
+	vttPath string
 	wavPath string
 
+	// queueDir holds chunks that failed, until a retry gets them through
+	// (see queueChunk).
+	queueDir string
+
 	processed int
+	closed    int // chunks ffmpeg has finished writing, processed or not
+	queued    int // chunks in queueDir, as of the last poll
+	srtCues   int // cues already in srtPath, to keep numbering in sequence
+
+	// chunkBackends are the backends that transcribed the chunk being
+	// processed, chunkSpeech how much of it was speech (the most of either
+	// stream's, with audio.vad) and chunkLines how many lines of the
+	// transcript its text takes, all recorded once it's done.
+	chunkBackends []string
+	chunkSpeech   float64
+	chunkLines    int
+
+	status  *statusPublisher   // nil outside a live session
+	rolling *rollingSummarizer // nil unless llm.rolling_summary_chunks is set
+
+	// The rolling summary update in flight, if any, and how many chunks
+	// were transcribed since the last one started (see updateRolling).
+	rollingCancel  context.CancelFunc
+	rollingDone    chan struct{}
+	rollingPending int
 }
 
 func newChunker(cfg *config.Config, sourcesTitle, notePath string, recorder *audio.Recorder, transcriber transcribe.Transcriber) (*chunker, error) {
@@ -40,13 +70,24 @@ func newChunker(cfg *config.Config, sourcesTitle, notePath string, recorder *aud
 		return nil, fmt.Errorf("failed to create sources directory: %w", err)
 	}
 
+	srtPath := filepath.Join(sourcesDir, sourcesTitle+".srt")
+	srtCues, err := countSRTCues(srtPath)
+	if err != nil {
+		return nil, err
+	}
+
 	return &chunker{
 		cfg:         cfg,
+		title:       sourcesTitle,
 		notePath:    notePath,
 		recorder:    recorder,
 		transcriber: transcriber,
 		txtPath:     filepath.Join(sourcesDir, sourcesTitle+".txt"),
+		srtPath:     srtPath,
+		vttPath:     filepath.Join(sourcesDir, sourcesTitle+".vtt"),
 		wavPath:     filepath.Join(sourcesDir, sourcesTitle+".wav"),
+		queueDir:    retryQueueDir(cfg, sourcesTitle),
+		srtCues:     srtCues,
 	}, nil
 }
 
@@ -68,53 +109,134 @@ func (c *chunker) transcriptionPrompt() string {
 func (c *chunker) run(ctx context.Context, stop <-chan struct{}) {
 	ticker := time.NewTicker(chunkPollInterval)
 	defer ticker.Stop()
+	defer c.stopRolling()
 
 	for {
 		select {
 		case <-ticker.C:
+			processed := c.processed
 			if err := c.pollOnce(ctx); err != nil {
 				fmt.Fprintf(os.Stderr, "trani: chunk processing error: %v\n", err)
 			}
+			c.updateRolling(ctx, c.processed-processed)
 		case <-stop:
 			return
 		}
 	}
 }
 
-// pollOnce processes any chunks that have closed (appeared in the segment
-// list) since the last call. Safe to call once more after the recorder has
-// stopped, to pick up the final partial chunk.
+// updateRolling hands newly transcribed chunks to the rolling summary,
+// publishing when it was last brought up to date. An update takes as long
+// as the model does, so it runs in the background: chunks transcribed
+// while one is still running are handed to the next. Only the polling
+// loop does this: once the session is stopped, the final summary is next
+// (see stopRolling).
+func (c *chunker) updateRolling(ctx context.Context, transcribed int) {
+	if c.rolling == nil {
+		return
+	}
+	c.rollingPending += transcribed
+	if c.rollingPending == 0 || c.rollingBusy() {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	c.rollingCancel, c.rollingDone = cancel, done
+	n := c.rollingPending
+	c.rollingPending = 0
+	go func() {
+		defer close(done)
+		defer cancel()
+		if !c.rolling.chunksTranscribed(ctx, n) {
+			return
+		}
+		c.status.update(func(s *JobStatus) {
+			s.RollingSummary = c.rolling.path
+			s.RollingSummaryAt = time.Now()
+		})
+	}()
+}
+
+// rollingBusy reports whether a rolling summary update is still running.
+func (c *chunker) rollingBusy() bool {
+	if c.rollingDone == nil {
+		return false
+	}
+	select {
+	case <-c.rollingDone:
+		return false
+	default:
+		return true
+	}
+}
+
+// stopRolling cancels the rolling summary update still running, if any,
+// and waits for it to return, so stopping a session never waits on the
+// model.
+func (c *chunker) stopRolling() {
+	if c.rollingDone == nil {
+		return
+	}
+	c.rollingCancel()
+	<-c.rollingDone
+}
+
+// pollOnce retries the chunks queued after failing in earlier polls, then
+// processes any chunks that have closed (appeared in the segment list)
+// since the last call. A chunk that fails now waits for the next poll to
+// be retried: it's only just been through every retry and fallback. Safe
+// to call once more after the recorder has stopped, to pick up the final
+// partial chunk.
 func (c *chunker) pollOnce(ctx context.Context) error {
+	c.queued = c.retryQueued(ctx)
+
+	var err error
 	if !c.recorder.HasSystemAudio() {
-		return c.pollMicOnly(ctx)
+		err = c.pollMicOnly(ctx)
+	} else {
+		err = c.pollMicSystem(ctx)
 	}
-	return c.pollMicSystem(ctx)
+
+	c.status.update(func(s *JobStatus) {
+		s.ChunksClosed = c.closed
+		s.ChunksTranscribed = max(c.processed-c.queued, 0)
+		s.ChunksQueued = c.queued
+		if err != nil {
+			s.LastChunkError = err.Error()
+			s.LastChunkErrorAt = time.Now()
+		}
+	})
+	return err
 }
 
 func (c *chunker) pollMicOnly(ctx context.Context) error {
-	segments, err := readSegmentList(c.recorder.MicSegmentList())
+	segments, err := readSegmentLists(c.recorder.MicSegmentLists())
 	if err != nil {
 		return err
 	}
 
+	c.closed = len(segments)
 	for c.processed < len(segments) {
 		chunkPath := segments[c.processed]
+		c.chunkBackends, c.chunkSpeech, c.chunkLines = nil, 0, 0
 		if err := c.processMicOnlyChunk(ctx, chunkPath); err != nil {
 			return fmt.Errorf("chunk %s: %w", filepath.Base(chunkPath), err)
 		}
 		c.processed++
+		c.recordChunk()
 	}
 
 	return nil
 }
 
 func (c *chunker) pollMicSystem(ctx context.Context) error {
-	micSegments, err := readSegmentList(c.recorder.MicSegmentList())
+	micSegments, err := readSegmentLists(c.recorder.MicSegmentLists())
 	if err != nil {
 		return err
 	}
 
-	systemSegments, err := readSegmentList(c.recorder.SystemSegmentList())
+	systemSegments, err := readSegmentLists(c.recorder.SystemSegmentLists())
 	if err != nil {
 		return err
 	}
@@ -123,30 +245,68 @@ func (c *chunker) pollMicSystem(ctx context.Context) error {
 	if len(systemSegments) < ready {
 		ready = len(systemSegments)
 	}
+	c.closed = ready
 
 	for c.processed < ready {
 		micPath := micSegments[c.processed]
 		systemPath := systemSegments[c.processed]
+		c.chunkBackends, c.chunkSpeech, c.chunkLines = nil, 0, 0
 		if err := c.processMicSystemChunk(ctx, micPath, systemPath); err != nil {
 			return fmt.Errorf("chunk %s: %w", filepath.Base(micPath), err)
 		}
 		c.processed++
+		c.recordChunk()
 	}
 
 	return nil
 }
 
+// skipProcessed moves past chunks already processed before this chunker
+// was created, for picking up a session whose recording process died.
+// Chunks are processed in order and deleted once done, so those are the
+// leading segment list entries whose chunk file (the mic one, in
+// mic_system mode) no longer exists, along with any whose text is already
+// in the transcript (see recordLines) even though the process died before
+// deleting it. Such a chunk's audio and subtitles may be missing from the
+// archive, which beats having its text twice.
+func (c *chunker) skipProcessed() error {
+	segments, err := readSegmentLists(c.recorder.MicSegmentLists())
+	if err != nil {
+		return err
+	}
+	chunkLines, err := readChunkLines(c.cfg, c.title)
+	if err != nil {
+		return err
+	}
+
+	c.processed = min(len(chunkLines), len(segments))
+	for c.processed < len(segments) {
+		if _, err := os.Stat(segments[c.processed]); err == nil {
+			break
+		}
+		c.processed++
+	}
+	return nil
+}
+
+// processMicOnlyChunk transcribes a chunk and archives it. A chunk that
+// fails to process or transcribe is queued for retry instead (see
+// queueChunk); only failing to write the session's own files is an error.
 func (c *chunker) processMicOnlyChunk(ctx context.Context, chunkPath string) error {
-	if err := postProcessAudio(chunkPath); err != nil {
-		return fmt.Errorf("failed to process audio: %w", err)
+	if err := c.processAudio(chunkPath, ""); err != nil {
+		return c.queueChunk(chunkPath, "", "", err)
 	}
 
-	text, err := c.transcriber.Transcribe(ctx, chunkPath, c.transcriptionPrompt())
+	result, err := c.transcribeChunk(ctx, chunkPath, c.transcriptionPrompt())
 	if err != nil {
-		return fmt.Errorf("transcription failed: %w", err)
+		return c.queueChunk(chunkPath, "", chunkPath, fmt.Errorf("transcription failed: %w", err))
 	}
 
-	if err := c.appendText(text); err != nil {
+	if err := c.appendText(result.Text); err != nil {
+		return err
+	}
+	c.recordLines(c.processed + 1)
+	if err := c.appendSegments(result.Segments); err != nil {
 		return err
 	}
 	if err := c.appendAudio(chunkPath); err != nil {
@@ -156,55 +316,164 @@ func (c *chunker) processMicOnlyChunk(ctx context.Context, chunkPath string) err
 	return os.Remove(chunkPath)
 }
 
+// processMicSystemChunk is processMicOnlyChunk for a pair of mic and system
+// chunks.
 func (c *chunker) processMicSystemChunk(ctx context.Context, micPath, systemPath string) error {
-	if err := postProcessAudio(micPath); err != nil {
-		return fmt.Errorf("failed to process microphone audio: %w", err)
-	}
-	if err := postProcessAudio(systemPath); err != nil {
-		return fmt.Errorf("failed to process system audio: %w", err)
+	if err := c.processAudio(micPath, systemPath); err != nil {
+		return c.queueChunk(micPath, systemPath, "", err)
 	}
 
 	// Always mix a combined chunk for the archived .sources/*.wav,
 	// regardless of mix_strategy, so the archive stays one coherent track.
 	combinedPath := systemPath + ".combined.wav"
 	if err := mixAudio(micPath, systemPath, combinedPath); err != nil {
-		return fmt.Errorf("failed to combine audio: %w", err)
+		return c.queueChunk(micPath, systemPath, "", fmt.Errorf("failed to combine audio: %w", err))
 	}
 	defer os.Remove(combinedPath)
 
-	prompt := c.transcriptionPrompt()
+	result, err := c.transcribeMicSystem(ctx, micPath, systemPath, combinedPath, c.transcriptionPrompt())
+	if err != nil {
+		return c.queueChunk(micPath, systemPath, combinedPath, err)
+	}
+
+	if err := c.appendText(result.Text); err != nil {
+		return err
+	}
+	c.recordLines(c.processed + 1)
+	if err := c.appendSegments(result.Segments); err != nil {
+		return err
+	}
+	if err := c.appendAudio(combinedPath); err != nil {
+		return err
+	}
+
+	os.Remove(micPath)
+	os.Remove(systemPath)
+	return nil
+}
+
+// processAudio post-processes a chunk's audio in place: the mic chunk, and
+// the system one in mic_system mode.
+func (c *chunker) processAudio(micPath, systemPath string) error {
+	if systemPath == "" {
+		if err := postProcessAudio(micPath); err != nil {
+			return fmt.Errorf("failed to process audio: %w", err)
+		}
+		return nil
+	}
+	if err := postProcessAudio(micPath); err != nil {
+		return fmt.Errorf("failed to process microphone audio: %w", err)
+	}
+	if err := postProcessAudio(systemPath); err != nil {
+		return fmt.Errorf("failed to process system audio: %w", err)
+	}
+	return nil
+}
 
-	var text string
-	if c.cfg.Audio.MixStrategy == config.MixStrategySeparateTranscribe {
-		micText, err := c.transcriber.Transcribe(ctx, micPath, prompt)
+// transcribeMicSystem transcribes a post-processed pair of mic and system
+// chunks as audio.mix_strategy says: each stream on its own, or the
+// combined one.
+func (c *chunker) transcribeMicSystem(ctx context.Context, micPath, systemPath, combinedPath, prompt string) (transcribe.Result, error) {
+	switch c.cfg.Audio.MixStrategy {
+	case config.MixStrategySeparateTranscribe, config.MixStrategySpeakerLabels:
+		micResult, err := c.transcribeChunk(ctx, micPath, prompt)
 		if err != nil {
-			return fmt.Errorf("microphone transcription failed: %w", err)
+			return transcribe.Result{}, fmt.Errorf("microphone transcription failed: %w", err)
 		}
-		systemText, err := c.transcriber.Transcribe(ctx, systemPath, prompt)
+		systemResult, err := c.transcribeChunk(ctx, systemPath, prompt)
 		if err != nil {
-			return fmt.Errorf("system audio transcription failed: %w", err)
+			return transcribe.Result{}, fmt.Errorf("system audio transcription failed: %w", err)
 		}
-		text = strings.TrimSpace(strings.TrimSpace(micText) + "\n" + strings.TrimSpace(systemText))
-	} else {
-		transcription, err := c.transcriber.Transcribe(ctx, combinedPath, prompt)
+		if c.cfg.Audio.MixStrategy == config.MixStrategySpeakerLabels {
+			return attributeSpeakers(micResult, systemResult, c.cfg.Audio.MicLabel, c.cfg.Audio.SystemLabel), nil
+		}
+		return transcribe.Result{
+			Text:     strings.TrimSpace(strings.TrimSpace(micResult.Text) + "\n" + strings.TrimSpace(systemResult.Text)),
+			Segments: mergeSegments(micResult.Segments, systemResult.Segments),
+		}, nil
+	default:
+		result, err := c.transcribeChunk(ctx, combinedPath, prompt)
 		if err != nil {
-			return fmt.Errorf("transcription failed: %w", err)
+			return transcribe.Result{}, fmt.Errorf("transcription failed: %w", err)
 		}
-		text = transcription
+		return result, nil
 	}
+}
 
-	if err := c.appendText(text); err != nil {
-		return err
+// transcribeChunk runs voice-activity detection on a post-processed chunk
+// (when audio.vad is on) and transcribes what's left. A chunk without
+// enough speech isn't sent to the transcriber at all and yields an empty
+// result. Segment times stay relative to the untrimmed chunk.
+func (c *chunker) transcribeChunk(ctx context.Context, chunkPath, prompt string) (transcribe.Result, error) {
+	vad, err := applyVAD(chunkPath, c.cfg.Audio)
+	if err != nil {
+		return transcribe.Result{}, err
 	}
-	if err := c.appendAudio(combinedPath); err != nil {
-		return err
+	defer vad.cleanup()
+
+	c.chunkSpeech = max(c.chunkSpeech, vad.ratio)
+	if vad.skip {
+		return transcribe.Result{}, nil
 	}
 
-	os.Remove(micPath)
-	os.Remove(systemPath)
-	return nil
+	result, err := c.transcriber.Transcribe(ctx, vad.path, prompt)
+	if err != nil {
+		return transcribe.Result{}, err
+	}
+	result.Segments = transcribe.Offset(result.Segments, vad.lead)
+
+	if backend := transcribedByBackend(c.cfg, result); !slices.Contains(c.chunkBackends, backend) {
+		c.chunkBackends = append(c.chunkBackends, backend)
+	}
+	return result, nil
+}
+
+// recordChunk adds which backends transcribed the chunk just processed to
+// the session index and, with audio.vad, how much of it was speech, which
+// is published as well.
+func (c *chunker) recordChunk() {
+	c.recordChunkAt(c.processed)
+	if c.cfg.Audio.VAD {
+		speech := c.chunkSpeech
+		c.status.update(func(s *JobStatus) { s.LastChunkSpeech = &speech })
+	}
+}
+
+// recordChunkAt records the chunk just transcribed as chunk index (from
+// 1) in the session index, the way recordChunk does.
+func (c *chunker) recordChunkAt(index int) {
+	record := chunkRecord{Title: c.title, Chunk: index, TranscribedBy: strings.Join(c.chunkBackends, "+")}
+	if c.cfg.Audio.VAD {
+		speech := c.chunkSpeech
+		record.SpeechRatio = &speech
+	}
+	logIndex(recordIndexChunk(c.cfg, record))
+}
+
+// recordLines records how many lines of the transcript chunk index's (from
+// 1) text takes (see recordChunkLines), right after it's written: from
+// then on the chunk's text is in, so a session picked up after its
+// recording process died must not transcribe it again (see skipProcessed).
+func (c *chunker) recordLines(index int) {
+	if err := recordChunkLines(c.cfg, c.title, index, c.chunkLines); err != nil {
+		// Only splitting a long transcript between chunks, and a recovery
+		// right after this chunk, suffer.
+		fmt.Fprintf(os.Stderr, "trani: %v\n", err)
+		errlog.Error("chunk_lines", c.title, err)
+	}
 }
 
+// transcribedByBackend names the backend that produced result: the one a
+// fallback chain reports, or else the only one configured.
+func transcribedByBackend(cfg *config.Config, result transcribe.Result) string {
+	if result.Backend != "" {
+		return result.Backend
+	}
+	return cfg.Transcription.Backend
+}
+
+// appendText appends a chunk's text to the transcript, counting the lines
+// it takes in chunkLines.
 func (c *chunker) appendText(text string) error {
 	text = strings.TrimSpace(text)
 	if text == "" {
@@ -220,42 +489,140 @@ func (c *chunker) appendText(text string) error {
 	if _, err := f.WriteString(text + "\n"); err != nil {
 		return fmt.Errorf("failed to append transcript: %w", err)
 	}
+	c.chunkLines += lineCount(text)
 
 	return nil
 }
 
+// appendSegments appends a chunk's timed segments to the .srt and .vtt
+// files. Segment times are relative to the chunk, so they're shifted by the
+// length of the audio archived so far, which is exactly where this chunk
+// will start in .sources/<title>.wav. Must be called before appendAudio.
+func (c *chunker) appendSegments(segments []transcribe.Segment) error {
+	if len(segments) == 0 {
+		return nil
+	}
+
+	offset, err := c.archivedDuration()
+	if err != nil {
+		return err
+	}
+	return c.appendSegmentsAt(segments, offset)
+}
+
+// appendSegmentsAt appends a chunk's timed segments to the .srt and .vtt
+// files, shifted to start at offset into the archived audio. Cues from a
+// chunk retried later (see retryChunk) end up out of order in the files,
+// but with the right times.
+func (c *chunker) appendSegmentsAt(segments []transcribe.Segment, offset time.Duration) error {
+	if len(segments) == 0 {
+		return nil
+	}
+	segments = transcribe.Offset(segments, offset)
+
+	vttExists := true
+	if _, err := os.Stat(c.vttPath); os.IsNotExist(err) {
+		vttExists = false
+	}
+
+	if err := appendToFile(c.srtPath, formatSRT(segments, c.srtCues+1)); err != nil {
+		return fmt.Errorf("failed to append SRT subtitles: %w", err)
+	}
+	c.srtCues += len(segments)
+
+	vtt := formatVTT(segments)
+	if !vttExists {
+		vtt = vttHeader + vtt
+	}
+	if err := appendToFile(c.vttPath, vtt); err != nil {
+		return fmt.Errorf("failed to append WebVTT subtitles: %w", err)
+	}
+
+	return nil
+}
+
+// archivedDuration is the length of the audio archived so far, zero before
+// the first chunk.
+func (c *chunker) archivedDuration() (time.Duration, error) {
+	if _, err := os.Stat(c.wavPath); os.IsNotExist(err) {
+		return 0, nil
+	}
+
+	d, err := wav.FileDuration(c.wavPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read archived audio length: %w", err)
+	}
+	return d, nil
+}
+
+func appendToFile(path, content string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(content)
+	return err
+}
+
+// appendAudio adds a chunk to the end of .sources/<title>.wav in place, so
+// archiving costs the same per chunk however long the session already is.
 func (c *chunker) appendAudio(chunkPath string) error {
 	if _, err := os.Stat(c.wavPath); os.IsNotExist(err) {
 		return copyFile(chunkPath, c.wavPath)
 	}
 
-	tempOut := c.wavPath + ".tmp.wav"
-	if err := runSox(c.wavPath, chunkPath, tempOut); err != nil {
-		return fmt.Errorf("failed to append audio chunk: %w", err)
+	chunk, err := wav.Read(chunkPath)
+	if err != nil {
+		return fmt.Errorf("failed to read audio chunk: %w", err)
 	}
 
-	return os.Rename(tempOut, c.wavPath)
+	if err := wav.Append(c.wavPath, chunk); err != nil {
+		return fmt.Errorf("failed to append audio chunk: %w", err)
+	}
+	return nil
 }
 
 // mixAudio sums two already normalized mono streams into one, then
 // normalizes the result again to guard against the combined signal
 // clipping or drifting too quiet.
 func mixAudio(a, b, out string) error {
-	tempMixed := out + ".tmp.wav"
+	first, err := wav.Read(a)
+	if err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
+	second, err := wav.Read(b)
+	if err != nil {
+		return fmt.Errorf("failed to read stream: %w", err)
+	}
 
-	if err := runSox("-m", a, b, tempMixed); err != nil {
+	mixed, err := wav.Mix(first, second)
+	if err != nil {
 		return fmt.Errorf("failed to combine streams: %w", err)
 	}
 
-	if err := runSox(tempMixed, out, "norm"); err != nil {
-		os.Remove(tempMixed)
-		return fmt.Errorf("failed to normalize mixed audio: %w", err)
+	if err := wav.Write(out, wav.Normalize(mixed)); err != nil {
+		return fmt.Errorf("failed to write mixed audio: %w", err)
 	}
-
-	os.Remove(tempMixed)
 	return nil
 }
 
+// readSegmentLists concatenates the chunks of several segment lists, one
+// per capture run (see audio.Recorder.MicSegmentLists), so that c.processed
+// keeps indexing the session's chunks in order across pauses.
+func readSegmentLists(paths []string) ([]string, error) {
+	var out []string
+	for _, path := range paths {
+		segments, err := readSegmentList(path)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, segments...)
+	}
+	return out, nil
+}
+
 // readSegmentList returns the chunk paths ffmpeg has appended to the given
 // segment list file. ffmpeg writes entries relative to its own working
 // directory (typically just the basename), not relative to the list file's
@@ -2,13 +2,20 @@ package session
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/transcribe"
 )
 
 // stubTranscriber returns canned text and records every path it was asked
@@ -19,23 +26,31 @@ type stubTranscriber struct {
 	texts []string // one per call, cycling through if exhausted
 }
 
-func (s *stubTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (string, error) {
+func (s *stubTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (transcribe.Result, error) {
 	s.calls = append(s.calls, audioPath)
 	if len(s.texts) == 0 {
-		return "", nil
+		return transcribe.Result{}, nil
 	}
-	return s.texts[(len(s.calls)-1)%len(s.texts)], nil
+	text := s.texts[(len(s.calls)-1)%len(s.texts)]
+	return transcribe.Result{
+		Text:     text,
+		Segments: []transcribe.Segment{{Start: 0, End: 250 * time.Millisecond, Text: text}},
+	}, nil
 }
 
-// writeTestChunk generates a short, real WAV file via sox so postProcessAudio
-// (which shells out to sox) has valid input to work with.
+// writeTestChunk writes a short 440 Hz tone in the format ffmpeg records
+// chunks in (48kHz stereo 16-bit PCM), so postProcessAudio has valid input
+// to work with.
 func writeTestChunk(t *testing.T, path string) {
 	t.Helper()
-	if _, err := exec.LookPath("sox"); err != nil {
-		t.Skip("sox not available")
-	}
-	cmd := exec.Command("sox", "-n", path, "synth", "0.3", "sine", "440")
-	if err := cmd.Run(); err != nil {
+	const rate, seconds = 48000, 0.3
+	frames := int(rate * seconds)
+	a := &wav.Audio{SampleRate: rate, Channels: 2, Samples: make([]int16, 2*frames)}
+	for i := 0; i < frames; i++ {
+		v := int16(0.5 * math.MaxInt16 * math.Sin(2*math.Pi*440*float64(i)/rate))
+		a.Samples[2*i], a.Samples[2*i+1] = v, v
+	}
+	if err := wav.Write(path, a); err != nil {
 		t.Fatalf("failed to generate test chunk: %v", err)
 	}
 }
@@ -125,6 +140,24 @@ func TestChunkerProcessesNewSegmentsProgressively(t *testing.T) {
 	if _, err := os.Stat(c.wavPath); err != nil {
 		t.Errorf("expected accumulated audio file to exist: %v", err)
 	}
+
+	// The second chunk's cue keeps SRT numbering going and starts where
+	// the first chunk's audio ends in the archive, not at zero.
+	srt, err := os.ReadFile(c.srtPath)
+	if err != nil {
+		t.Fatalf("failed to read subtitles: %v", err)
+	}
+	if !strings.Contains(string(srt), "2\n00:00:00,300 --> 00:00:00,550\nmundo\n") {
+		t.Errorf("expected second cue offset by the first chunk, got %q", string(srt))
+	}
+
+	vtt, err := os.ReadFile(c.vttPath)
+	if err != nil {
+		t.Fatalf("failed to read subtitles: %v", err)
+	}
+	if !strings.HasPrefix(string(vtt), vttHeader) || strings.Count(string(vtt), vttHeader) != 1 {
+		t.Errorf("expected exactly one WebVTT header, got %q", string(vtt))
+	}
 }
 
 func TestChunkerMicSystemWaitsForBothStreams(t *testing.T) {
@@ -175,6 +208,208 @@ func TestChunkerMicSystemWaitsForBothStreams(t *testing.T) {
 	}
 }
 
+// fallbackTranscriber answers like a fallback chain would, naming a
+// different backend for each call.
+type fallbackTranscriber struct {
+	backends []string
+	calls    int
+}
+
+func (f *fallbackTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (transcribe.Result, error) {
+	backend := f.backends[f.calls%len(f.backends)]
+	f.calls++
+	return transcribe.Result{Text: "texto de " + backend, Backend: backend}, nil
+}
+
+func TestChunkerRecordsTranscribingBackends(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Transcription.Backend = "openai"
+	cfg.Audio = config.AudioConfig{Mode: config.AudioModeMicSystem, MixStrategy: config.MixStrategySeparateTranscribe}
+
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+	transcriber := &fallbackTranscriber{backends: []string{"openai", "local", "local", "local"}}
+	c, err := newChunker(cfg, "2026-01-15 1430", "", recorder, transcriber)
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		mic := filepath.Join(cfg.Paths.TempDir, fmt.Sprintf("chunk-mic-%03d.wav", i))
+		system := filepath.Join(cfg.Paths.TempDir, fmt.Sprintf("chunk-system-%03d.wav", i))
+		writeTestChunk(t, mic)
+		writeTestChunk(t, system)
+		appendSegmentListLine(t, recorder.MicSegmentList(), mic)
+		appendSegmentListLine(t, recorder.SystemSegmentList(), system)
+	}
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one index entry, got %v (%v)", entries, err)
+	}
+	expected := []string{"openai+local", "local"}
+	if !slices.Equal(entries[0].TranscribedBy, expected) {
+		t.Errorf("expected transcribed_by %q, got %q", expected, entries[0].TranscribedBy)
+	}
+	// separate_transcribe writes the mic's and the system's text on lines
+	// of their own.
+	if chunkLines, err := readChunkLines(cfg, c.title); err != nil || !slices.Equal(chunkLines, []int{2, 2}) {
+		t.Errorf("expected chunk lines [2 2], got %v (%v)", chunkLines, err)
+	}
+}
+
+// flakyTranscriber fails every call while down, and otherwise answers like
+// stubTranscriber.
+type flakyTranscriber struct {
+	stubTranscriber
+	down bool
+}
+
+func (f *flakyTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (transcribe.Result, error) {
+	if f.down {
+		return transcribe.Result{}, errors.New("backend unavailable")
+	}
+	return f.stubTranscriber.Transcribe(ctx, audioPath, prompt)
+}
+
+func TestChunkerQueuesFailedChunksForRetry(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Transcription.Backend = "openai"
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+	transcriber := &flakyTranscriber{stubTranscriber: stubTranscriber{texts: []string{"hola", "mundo", "tarde"}}}
+	c, err := newChunker(cfg, "2026-01-15 1430", "", recorder, transcriber)
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+
+	addChunk := func(i int) {
+		chunk := filepath.Join(cfg.Paths.TempDir, fmt.Sprintf("chunk-mic-%03d.wav", i))
+		writeTestChunk(t, chunk)
+		appendSegmentListLine(t, recorder.MicSegmentList(), chunk)
+	}
+	readTranscript := func() string {
+		text, err := os.ReadFile(c.txtPath)
+		if err != nil {
+			t.Fatalf("failed to read transcript: %v", err)
+		}
+		return string(text)
+	}
+
+	addChunk(0)
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+
+	// The second chunk fails: it's queued with a marker in its place, and
+	// its audio still archived so the third lands where it should.
+	transcriber.down = true
+	addChunk(1)
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("expected a failed chunk to be queued, not returned: %v", err)
+	}
+	marker := gapMarker(2, 300*time.Millisecond, 600*time.Millisecond)
+	if text := readTranscript(); text != "hola\n"+marker+"\n" {
+		t.Errorf("expected a gap marker for the failed chunk, got %q", text)
+	}
+	if queued, _ := c.readQueued(); len(queued) != 1 || queued[0].Index != 2 || queued[0].Attempts != 1 {
+		t.Fatalf("expected chunk 2 queued and not retried in the same poll, got %+v", queued)
+	}
+	if entries, _ := ReadIndex(cfg); len(entries) != 1 || !slices.Equal(entries[0].TranscribedBy, []string{"openai", chunkFailedBackend}) {
+		t.Errorf("expected the queued chunk recorded as failed, got %+v", entries)
+	}
+
+	// The next poll retries it before processing the third.
+	transcriber.down = false
+	addChunk(2)
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+	if text := readTranscript(); text != "hola\nmundo\ntarde\n" {
+		t.Errorf("expected the retried chunk's text in place of its marker, got %q", text)
+	}
+	if files, _ := os.ReadDir(c.queueDir); len(files) != 0 {
+		t.Errorf("expected the retry queue to be empty, got %d files", len(files))
+	}
+
+	srt, err := os.ReadFile(c.srtPath)
+	if err != nil {
+		t.Fatalf("failed to read subtitles: %v", err)
+	}
+	if !strings.Contains(string(srt), "00:00:00,300 --> 00:00:00,550\nmundo\n") ||
+		!strings.Contains(string(srt), "00:00:00,600 --> 00:00:00,850\ntarde\n") {
+		t.Errorf("expected every cue at its chunk's place in the archive, got %q", string(srt))
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one index entry, got %v (%v)", entries, err)
+	}
+	if expected := []string{"openai", "openai", "openai"}; !slices.Equal(entries[0].TranscribedBy, expected) {
+		t.Errorf("expected transcribed_by %q, got %q", expected, entries[0].TranscribedBy)
+	}
+	if chunkLines, err := readChunkLines(cfg, c.title); err != nil || !slices.Equal(chunkLines, []int{1, 1, 1}) {
+		t.Errorf("expected chunk lines [1 1 1], got %v (%v)", chunkLines, err)
+	}
+
+	if log := testLog(t); !strings.Contains(log, `"event":"chunk_queued"`) || !strings.Contains(log, `"msg":"chunk 2 transcribed on retry 1"`) {
+		t.Errorf("expected the failure and the retry logged, got %q", log)
+	}
+}
+
+func TestChunkerKeepsChunksThatNeverSucceed(t *testing.T) {
+	cfg := testConfig(t)
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+	c, err := newChunker(cfg, "2026-01-15 1430", "", recorder, failingTranscriber{})
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+
+	chunk := filepath.Join(cfg.Paths.TempDir, "chunk-mic-000.wav")
+	writeTestChunk(t, chunk)
+	appendSegmentListLine(t, recorder.MicSegmentList(), chunk)
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+
+	if n := c.abandonQueued(); n != 1 {
+		t.Errorf("expected 1 chunk left in the queue, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(c.queueDir, "chunk-001-mic.wav")); err != nil {
+		t.Errorf("expected the failed chunk's audio to be kept: %v", err)
+	}
+	text, _ := os.ReadFile(c.txtPath)
+	if !strings.Contains(string(text), "[chunk 1 failed: 00:00:00–00:00:00]") {
+		t.Errorf("expected the gap marker to stay, got %q", string(text))
+	}
+	if log := testLog(t); !strings.Contains(log, `"event":"chunk_transcription"`) {
+		t.Errorf("expected the abandoned chunk logged, got %q", log)
+	}
+}
+
+func TestReplaceGapMarkerWithoutSpeech(t *testing.T) {
+	cfg := testConfig(t)
+	c, err := newChunker(cfg, "2026-01-15 1430", "", audio.New(cfg.Audio, cfg.Paths.TempDir), &stubTranscriber{})
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+
+	marker := gapMarker(2, 5*time.Minute, 10*time.Minute)
+	if err := os.WriteFile(c.txtPath, []byte("uno\n"+marker+"\ntres\n"), 0644); err != nil {
+		t.Fatalf("failed to write transcript: %v", err)
+	}
+	if err := c.replaceGapMarker(marker, " "); err != nil {
+		t.Fatalf("replaceGapMarker failed: %v", err)
+	}
+	if text, _ := os.ReadFile(c.txtPath); string(text) != "uno\ntres\n" {
+		t.Errorf("expected the marker's line removed, got %q", string(text))
+	}
+	if c.chunkLines != 0 {
+		t.Errorf("expected the chunk to take no lines, got %d", c.chunkLines)
+	}
+}
+
 func TestReadSegmentListMissingFile(t *testing.T) {
 	segments, err := readSegmentList(filepath.Join(t.TempDir(), "does-not-exist.txt"))
 	if err != nil {
@@ -232,3 +467,35 @@ func TestReadSegmentListKeepsAbsoluteEntries(t *testing.T) {
 		t.Errorf("expected [%s], got %v", absoluteEntry, segments)
 	}
 }
+
+func TestReadSegmentListsConcatenatesRunsInOrder(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "first.txt")
+	resumed := filepath.Join(dir, "resumed.txt")
+	if err := os.WriteFile(first, []byte("a.wav\nb.wav\n"), 0644); err != nil {
+		t.Fatalf("failed to write segment list: %v", err)
+	}
+	if err := os.WriteFile(resumed, []byte("c.wav\n"), 0644); err != nil {
+		t.Fatalf("failed to write segment list: %v", err)
+	}
+
+	// A run that hasn't closed any chunk yet has no list file at all.
+	segments, err := readSegmentLists([]string{first, filepath.Join(dir, "missing.txt"), resumed})
+	if err != nil {
+		t.Fatalf("readSegmentLists failed: %v", err)
+	}
+
+	expected := []string{
+		filepath.Join(dir, "a.wav"),
+		filepath.Join(dir, "b.wav"),
+		filepath.Join(dir, "c.wav"),
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("expected %d segments, got %d (%v)", len(expected), len(segments), segments)
+	}
+	for i, e := range expected {
+		if segments[i] != e {
+			t.Errorf("segment %d: expected %s, got %s", i, e, segments[i])
+		}
+	}
+}
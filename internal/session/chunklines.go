@@ -0,0 +1,63 @@
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sabhz/trani/internal/config"
+)
+
+// How many lines of .sources/<title>.txt each chunk's text takes is kept
+// next to it in .sources/<title>.chunks, so a long transcript can be split
+// between chunks (see splitTranscript) and a rolling summary knows which
+// text is new. It's part of the session's own state, written right after
+// the chunk's text, rather than of the best-effort session index. Each
+// chunk transcribed or retried appends a "<chunk> <lines>" line, chunks
+// counted from 1; the last line for a chunk wins.
+
+func chunkLinesPath(cfg *config.Config, title string) string {
+	return filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".chunks")
+}
+
+// recordChunkLines records that chunk index (from 1) of session title
+// takes lines lines of its transcript.
+func recordChunkLines(cfg *config.Config, title string, index, lines int) error {
+	if err := appendToFile(chunkLinesPath(cfg, title), fmt.Sprintf("%d %d\n", index, lines)); err != nil {
+		return fmt.Errorf("failed to record chunk lines: %w", err)
+	}
+	return nil
+}
+
+// readChunkLines returns how many lines each of session title's chunks
+// takes, in order, or nil for a session without any recorded (one from
+// `process`, or from before they were). Lines that can't be parsed (a
+// write cut short) are skipped.
+func readChunkLines(cfg *config.Config, title string) ([]int, error) {
+	f, err := os.Open(chunkLinesPath(cfg, title))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read chunk lines: %w", err)
+	}
+	defer f.Close()
+
+	var chunkLines []int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var index, lines int
+		if n, _ := fmt.Sscanf(scanner.Text(), "%d %d", &index, &lines); n != 2 || index < 1 || lines < 0 {
+			continue
+		}
+		for len(chunkLines) < index {
+			chunkLines = append(chunkLines, 0)
+		}
+		chunkLines[index-1] = lines
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read chunk lines: %w", err)
+	}
+	return chunkLines, nil
+}
@@ -20,3 +20,58 @@ func removeConsecutiveDuplicateLines(text string) string {
 
 	return strings.Join(out, "\n")
 }
+
+// lineCount is how many lines text takes in the transcript, where it's
+// written trimmed and followed by a newline.
+func lineCount(text string) int {
+	if text = strings.TrimSpace(text); text == "" {
+		return 0
+	}
+	return strings.Count(text, "\n") + 1
+}
+
+// chunksText returns the lines chunks from through to-1 (counting from 0)
+// wrote to raw, going by chunkLines (see readChunkLines). A to past the
+// recorded chunks takes the rest of raw, including any lines past them.
+func chunksText(raw []byte, chunkLines []int, from, to int) string {
+	lines := strings.SplitAfter(string(raw), "\n")
+	lineAt := func(chunk int) int {
+		if chunk > len(chunkLines) {
+			return len(lines)
+		}
+		n := 0
+		for _, l := range chunkLines[:chunk] {
+			n += l
+		}
+		return min(n, len(lines))
+	}
+	return strings.Join(lines[lineAt(from):lineAt(to)], "")
+}
+
+// cleanChunkLines maps chunkLines, how many lines each chunk wrote to raw
+// (see readChunkLines), to how many each keeps once raw is cleaned up
+// by removeConsecutiveDuplicateLines. Lines past the recorded chunks' (text
+// added by hand, say) count as one more chunk.
+func cleanChunkLines(raw string, chunkLines []int) []int {
+	lines := strings.Split(strings.TrimSpace(raw), "\n")
+	kept := make([]int, 0, len(chunkLines)+1)
+
+	line := 0
+	count := func(n int) int {
+		k := 0
+		for ; n > 0 && line < len(lines); n-- {
+			if line == 0 || lines[line] != lines[line-1] {
+				k++
+			}
+			line++
+		}
+		return k
+	}
+	for _, n := range chunkLines {
+		kept = append(kept, count(n))
+	}
+	if line < len(lines) {
+		kept = append(kept, count(len(lines)-line))
+	}
+	return kept
+}
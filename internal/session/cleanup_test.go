@@ -1,6 +1,11 @@
 package session
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
 
 func TestRemoveConsecutiveDuplicateLines(t *testing.T) {
 	cases := []struct {
@@ -44,3 +49,38 @@ func TestRemoveConsecutiveDuplicateLines(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanChunkLines(t *testing.T) {
+	// The second chunk starts by repeating the first one's last line, the
+	// third had no speech, and a line was added by hand after the last one.
+	raw := "hola\nhola\nhola\nmundo\nfin\n"
+	got := cleanChunkLines(raw, []int{2, 2, 0})
+	if expected := []int{1, 1, 0, 1}; !slices.Equal(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+}
+
+func TestReadChunkLines(t *testing.T) {
+	cfg := testConfig(t)
+	title := "2026-01-15 1430"
+	if chunkLines, err := readChunkLines(cfg, title); err != nil || chunkLines != nil {
+		t.Errorf("expected no chunk lines before any are recorded, got %v (%v)", chunkLines, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(chunkLinesPath(cfg, title)), 0755); err != nil {
+		t.Fatalf("failed to create sources directory: %v", err)
+	}
+	for _, chunk := range [][2]int{{1, 2}, {2, 1}, {3, 0}, {2, 4}} {
+		if err := recordChunkLines(cfg, title, chunk[0], chunk[1]); err != nil {
+			t.Fatalf("recordChunkLines failed: %v", err)
+		}
+	}
+	// A write cut short.
+	if err := appendToFile(chunkLinesPath(cfg, title), "4"); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if chunkLines, err := readChunkLines(cfg, title); err != nil || !slices.Equal(chunkLines, []int{2, 4, 0}) {
+		t.Errorf("expected the retried chunk's lines to win, got %v (%v)", chunkLines, err)
+	}
+}
@@ -1,6 +1,8 @@
 package session
 
 import (
+	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -85,16 +87,73 @@ func flattenValues(raw map[string]interface{}) []string {
 // line and the next line that is exactly "---". ok is false if content
 // doesn't start with a frontmatter block at all.
 func extractFrontmatter(content string) (string, bool) {
+	frontmatter, _, ok := splitFrontmatter(content)
+	return frontmatter, ok
+}
+
+// splitFrontmatter is extractFrontmatter, also returning what follows the
+// closing "---" line.
+func splitFrontmatter(content string) (frontmatter, body string, ok bool) {
 	lines := strings.Split(content, "\n")
 	if len(lines) == 0 || strings.TrimSpace(lines[0]) != "---" {
-		return "", false
+		return "", content, false
 	}
 
 	for i := 1; i < len(lines); i++ {
 		if strings.TrimSpace(lines[i]) == "---" {
-			return strings.Join(lines[1:i], "\n"), true
+			return strings.Join(lines[1:i], "\n"), strings.Join(lines[i+1:], "\n"), true
 		}
 	}
 
-	return "", false
+	return "", content, false
+}
+
+// setFrontmatterField sets a top-level field of content's frontmatter to
+// value, adding a frontmatter block if there's none. Only the field's own
+// lines change: the rest of the block keeps its formatting, order and
+// comments, as whatever template wrote it left them.
+func setFrontmatterField(content, key string, value any) (string, error) {
+	encoded, err := yaml.Marshal(map[string]any{key: value})
+	if err != nil {
+		return "", fmt.Errorf("failed to encode frontmatter field %s: %w", key, err)
+	}
+	field := strings.Split(strings.TrimRight(string(encoded), "\n"), "\n")
+
+	lines := strings.Split(content, "\n")
+	end := -1
+	if strings.TrimSpace(lines[0]) == "---" {
+		for i := 1; i < len(lines); i++ {
+			if strings.TrimSpace(lines[i]) == "---" {
+				end = i
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return "---\n" + strings.Join(field, "\n") + "\n---\n" + content, nil
+	}
+
+	for i := 1; i < end; i++ {
+		if !isFrontmatterKey(lines[i], key) {
+			continue
+		}
+		// The field's value goes on for as long as lines are indented or
+		// are items of a sequence.
+		j := i + 1
+		for j < end && (strings.HasPrefix(lines[j], " ") || strings.HasPrefix(lines[j], "\t") || strings.HasPrefix(lines[j], "-")) {
+			j++
+		}
+		return strings.Join(slices.Concat(lines[:i], field, lines[j:]), "\n"), nil
+	}
+	return strings.Join(slices.Concat(lines[:end], field, lines[end:]), "\n"), nil
+}
+
+// isFrontmatterKey reports whether a frontmatter line starts key's field.
+func isFrontmatterKey(line, key string) bool {
+	for _, k := range []string{key, `"` + key + `"`, "'" + key + "'"} {
+		if rest, ok := strings.CutPrefix(line, k); ok && strings.HasPrefix(strings.TrimLeft(rest, " "), ":") {
+			return true
+		}
+	}
+	return false
 }
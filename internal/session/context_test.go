@@ -86,3 +86,54 @@ func TestExtractFrontmatter(t *testing.T) {
 		})
 	}
 }
+
+func TestSetFrontmatterField(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		key      string
+		value    any
+		expected string
+	}{
+		{
+			name:     "new field keeps the rest as is",
+			content:  "---\n# de la plantilla\nasistentes:   [Ana]\n---\n\n## Notas",
+			key:      "slack",
+			value:    "Todo listo.",
+			expected: "---\n# de la plantilla\nasistentes:   [Ana]\nslack: Todo listo.\n---\n\n## Notas",
+		},
+		{
+			name:     "existing field replaced with its value lines",
+			content:  "---\ntags:\n  - a\n  - b\nproyecto: x\n---\n",
+			key:      "tags",
+			value:    []string{"c"},
+			expected: "---\ntags:\n    - c\nproyecto: x\n---\n",
+		},
+		{
+			name:     "multi-line value",
+			content:  "---\nslack: viejo\n---\n",
+			key:      "slack",
+			value:    "uno\ndos",
+			expected: "---\nslack: |-\n    uno\n    dos\n---\n",
+		},
+		{
+			name:     "no frontmatter",
+			content:  "## Notas",
+			key:      "slack",
+			value:    "hola",
+			expected: "---\nslack: hola\n---\n## Notas",
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := setFrontmatterField(c.content, c.key, c.value)
+			if err != nil {
+				t.Fatalf("setFrontmatterField failed: %v", err)
+			}
+			if got != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
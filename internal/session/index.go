@@ -0,0 +1,272 @@
+package session
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+)
+
+// Where an index entry came from.
+const (
+	SourceSession = "session"
+	SourceProcess = "process"
+)
+
+// Statuses a session goes through in the index. summarized and
+// summary_failed are final until the session is summarized again;
+// recovering means its recording process died and `trani recover` hasn't
+// finished it yet.
+const (
+	IndexRecording     = "recording"
+	IndexSummarizing   = "summarizing"
+	IndexSummarized    = "summarized"
+	IndexSummaryFailed = "summary_failed"
+	IndexRecovering    = "recovering"
+)
+
+// IndexEntry is one session's record in the session index.
+type IndexEntry struct {
+	Title                string    `json:"title"`
+	NotePath             string    `json:"note_path"`
+	Source               string    `json:"source"`
+	StartedAt            time.Time `json:"started_at"`
+	EndedAt              time.Time `json:"ended_at,omitzero"`
+	DurationSeconds      float64   `json:"duration_seconds,omitempty"` // recorded audio, not counting pauses
+	AudioMode            string    `json:"audio_mode,omitempty"`
+	TranscriptionBackend string    `json:"transcription_backend"`
+	LLMBackend           string    `json:"llm_backend"`
+	PromptTemplate       string    `json:"prompt_template"`
+	Status               string    `json:"status"`
+	UpdatedAt            time.Time `json:"updated_at"`
+
+	// Which backends actually did the work, which differs from the
+	// configured ones when a fallback took over: TranscribedBy has one
+	// entry per chunk, in order ("" for a chunk with no speech, "a+b" for
+	// one transcribed per stream by different backends, "failed" for one
+	// still in the retry queue), and SummarizedBy
+	// names those that produced the latest summary.
+	TranscribedBy []string `json:"transcribed_by,omitempty"`
+	SummarizedBy  string   `json:"summarized_by,omitempty"`
+
+	// SpeechRatios is, with audio.vad, how much of each chunk voice-activity
+	// detection found to be speech, from 0 to 1, in the same order as
+	// TranscribedBy (0 for a chunk that failed before it was analyzed).
+	SpeechRatios []float64 `json:"speech_ratios,omitempty"`
+}
+
+// chunkRecord is an index line about one chunk of a session: the
+// backends that transcribed it and, with audio.vad, how much of it was
+// speech. A live session records its chunks this way, rather than by
+// appending its full record with one more chunk in it, so that a long
+// session doesn't rewrite ever longer lines for every chunk; ReadIndex
+// folds them into the session's TranscribedBy and SpeechRatios.
+type chunkRecord struct {
+	Title         string    `json:"title"`
+	Chunk         int       `json:"chunk"` // from 1
+	TranscribedBy string    `json:"chunk_transcribed_by"`
+	SpeechRatio   *float64  `json:"chunk_speech_ratio,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// indexLine is any line of the index: a full record, or a chunkRecord if
+// Chunk is set.
+type indexLine struct {
+	IndexEntry
+	Chunk            int      `json:"chunk"`
+	ChunkBackends    string   `json:"chunk_transcribed_by"`
+	ChunkSpeechRatio *float64 `json:"chunk_speech_ratio"`
+}
+
+// indexPath is the session index, kept with the rest of trani's per-session
+// data so it always describes the notes in sessions_dir.
+func indexPath(cfg *config.Config) string {
+	return filepath.Join(cfg.Paths.SessionsDir, ".sources", "index.jsonl")
+}
+
+// newIndexEntry describes a session starting now with the current
+// configuration.
+func newIndexEntry(cfg *config.Config, title, notePath, source, promptTemplate string, startedAt time.Time) IndexEntry {
+	entry := IndexEntry{
+		Title:                title,
+		NotePath:             notePath,
+		Source:               source,
+		StartedAt:            startedAt,
+		TranscriptionBackend: cfg.Transcription.Backend,
+		LLMBackend:           cfg.LLM.Backend,
+		PromptTemplate:       promptTemplate,
+		Status:               IndexRecording,
+	}
+	if source == SourceSession {
+		entry.AudioMode = cfg.Audio.Mode
+	}
+	return entry
+}
+
+// recordIndex appends entry to the session index. The index is
+// append-only: every change to a session appends its full, updated record
+// and the last one for a title wins (see ReadIndex), so processes updating
+// different sessions at once never rewrite each other's lines.
+func recordIndex(cfg *config.Config, entry IndexEntry) error {
+	entry.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(indexPath(cfg)), 0755); err != nil {
+		return fmt.Errorf("failed to create sources directory: %w", err)
+	}
+	if err := appendToFile(indexPath(cfg), string(data)+"\n"); err != nil {
+		return fmt.Errorf("failed to update session index: %w", err)
+	}
+	return nil
+}
+
+// updateIndex applies change to title's latest record and appends the
+// result. A session with no record yet (one started before the index
+// existed) starts from an empty one with just its title.
+func updateIndex(cfg *config.Config, title string, change func(*IndexEntry)) error {
+	entries, err := ReadIndex(cfg)
+	if err != nil {
+		return err
+	}
+
+	entry := IndexEntry{Title: title}
+	for _, e := range entries {
+		if e.Title == title {
+			entry = e
+		}
+	}
+
+	change(&entry)
+	return recordIndex(cfg, entry)
+}
+
+// recordIndexChunk appends record to the session index. Unlike
+// updateIndex, it doesn't read the index first. A chunk a retry
+// transcribes is recorded again, and its last record wins.
+func recordIndexChunk(cfg *config.Config, record chunkRecord) error {
+	record.UpdatedAt = time.Now()
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal index entry: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(indexPath(cfg)), 0755); err != nil {
+		return fmt.Errorf("failed to create sources directory: %w", err)
+	}
+	if err := appendToFile(indexPath(cfg), string(data)+"\n"); err != nil {
+		return fmt.Errorf("failed to update session index: %w", err)
+	}
+	return nil
+}
+
+// addChunkRecord folds line, a chunkRecord, into entry.
+func (entry *IndexEntry) addChunkRecord(line indexLine) {
+	for len(entry.TranscribedBy) < line.Chunk {
+		entry.TranscribedBy = append(entry.TranscribedBy, "")
+	}
+	entry.TranscribedBy[line.Chunk-1] = line.ChunkBackends
+
+	if line.ChunkSpeechRatio != nil {
+		for len(entry.SpeechRatios) < line.Chunk {
+			entry.SpeechRatios = append(entry.SpeechRatios, 0)
+		}
+		entry.SpeechRatios[line.Chunk-1] = *line.ChunkSpeechRatio
+	}
+	entry.UpdatedAt = line.UpdatedAt
+}
+
+// logIndex reports a failed index update without failing the job that
+// made it: the index is a convenience, the note and its .sources/ files
+// are what matter.
+func logIndex(err error) {
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trani: %v\n", err)
+	}
+}
+
+// ReadIndex returns the latest record of every indexed session, with the
+// chunks recorded since folded in, oldest first. Lines that can't be
+// parsed (a write cut short) are skipped.
+func ReadIndex(cfg *config.Config) ([]IndexEntry, error) {
+	f, err := os.Open(indexPath(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+	defer f.Close()
+
+	latest := map[string]IndexEntry{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var line indexLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil || line.Title == "" {
+			continue
+		}
+		if line.Chunk <= 0 {
+			latest[line.Title] = line.IndexEntry
+			continue
+		}
+		// A chunk of a session with no record yet (one started before
+		// the index existed) starts it from an empty one, as in
+		// updateIndex.
+		entry, ok := latest[line.Title]
+		if !ok {
+			entry = IndexEntry{Title: line.Title}
+		}
+		entry.addChunkRecord(line)
+		latest[line.Title] = entry
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read session index: %w", err)
+	}
+
+	out := make([]IndexEntry, 0, len(latest))
+	for _, entry := range latest {
+		out = append(out, entry)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !out[i].StartedAt.Equal(out[j].StartedAt) {
+			return out[i].StartedAt.Before(out[j].StartedAt)
+		}
+		return out[i].Title < out[j].Title
+	})
+	return out, nil
+}
+
+// IndexFilter selects index entries for `trani list`. Zero fields match
+// everything; Until is inclusive of the whole day it falls on.
+type IndexFilter struct {
+	Since  time.Time
+	Until  time.Time
+	Status string
+	Prompt string
+}
+
+// Match reports whether entry passes the filter.
+func (f IndexFilter) Match(entry IndexEntry) bool {
+	if !f.Since.IsZero() && entry.StartedAt.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !entry.StartedAt.Before(f.Until.AddDate(0, 0, 1)) {
+		return false
+	}
+	if f.Status != "" && entry.Status != f.Status {
+		return false
+	}
+	if f.Prompt != "" && entry.PromptTemplate != f.Prompt {
+		return false
+	}
+	return true
+}
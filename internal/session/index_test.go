@@ -0,0 +1,140 @@
+package session
+
+import (
+	"os"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIndexLastRecordWins(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.LLM.Backend = "claude"
+	startedAt := time.Date(2026, 1, 15, 14, 30, 0, 0, time.Local)
+
+	entry := newIndexEntry(cfg, "2026-01-15 1430", "/notes/2026-01-15 1430.md", SourceSession, "default", startedAt)
+	if err := recordIndex(cfg, entry); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+	if err := recordIndex(cfg, newIndexEntry(cfg, "2026-01-14 0900", "/notes/2026-01-14 0900.md", SourceProcess, "default", startedAt.AddDate(0, 0, -1))); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+	if err := updateIndex(cfg, "2026-01-15 1430", func(e *IndexEntry) { e.Status = IndexSummarized }); err != nil {
+		t.Fatalf("updateIndex failed: %v", err)
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected one entry per session, got %+v", entries)
+	}
+	if entries[0].Title != "2026-01-14 0900" {
+		t.Errorf("expected entries oldest first, got %s first", entries[0].Title)
+	}
+	if entries[1].Status != IndexSummarized || entries[1].LLMBackend != "claude" || entries[1].NotePath != entry.NotePath {
+		t.Errorf("expected the update to keep the rest of the record, got %+v", entries[1])
+	}
+}
+
+func TestReadIndexFoldsInChunkRecords(t *testing.T) {
+	cfg := testConfig(t)
+	title := "2026-01-15 1430"
+	if err := recordIndex(cfg, IndexEntry{Title: title, Status: IndexRecording}); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+	speech := func(ratio float64) *float64 { return &ratio }
+	for _, record := range []chunkRecord{
+		{Title: title, Chunk: 1, TranscribedBy: "openai", SpeechRatio: speech(0.9)},
+		{Title: title, Chunk: 2, TranscribedBy: chunkFailedBackend, SpeechRatio: speech(0)},
+		{Title: title, Chunk: 3, TranscribedBy: "", SpeechRatio: speech(0.1)},
+		// Chunk 2 transcribed on retry.
+		{Title: title, Chunk: 2, TranscribedBy: "local", SpeechRatio: speech(0.6)},
+	} {
+		if err := recordIndexChunk(cfg, record); err != nil {
+			t.Fatalf("recordIndexChunk failed: %v", err)
+		}
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one entry, got %+v (%v)", entries, err)
+	}
+	if expected := []string{"openai", "local", ""}; !slices.Equal(entries[0].TranscribedBy, expected) {
+		t.Errorf("expected transcribed_by %q, got %q", expected, entries[0].TranscribedBy)
+	}
+	if expected := []float64{0.9, 0.6, 0.1}; !slices.Equal(entries[0].SpeechRatios, expected) {
+		t.Errorf("expected speech_ratios %v, got %v", expected, entries[0].SpeechRatios)
+	}
+
+	// A status update carries the chunks with it, and chunk records stay
+	// one short line each however many came before.
+	if err := updateIndex(cfg, title, func(e *IndexEntry) { e.Status = IndexSummarizing }); err != nil {
+		t.Fatalf("updateIndex failed: %v", err)
+	}
+	if entries, _ := ReadIndex(cfg); entries[0].Status != IndexSummarizing || len(entries[0].TranscribedBy) != 3 {
+		t.Errorf("expected the update to keep the chunks, got %+v", entries[0])
+	}
+	data, _ := os.ReadFile(indexPath(cfg))
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 6 || strings.Contains(lines[4], "openai") {
+		t.Errorf("expected one line per chunk record, each about its chunk only, got %q", lines)
+	}
+}
+
+func TestReadIndexSkipsTruncatedLines(t *testing.T) {
+	cfg := testConfig(t)
+	if err := recordIndex(cfg, IndexEntry{Title: "a", Status: IndexSummarized}); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+	if err := appendToFile(indexPath(cfg), `{"title":"b","sta`); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil {
+		t.Fatalf("ReadIndex failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Title != "a" {
+		t.Errorf("expected only the complete entry, got %+v", entries)
+	}
+}
+
+func TestReadIndexMissingFile(t *testing.T) {
+	cfg := testConfig(t)
+	entries, err := ReadIndex(cfg)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("expected no entries and no error, got %+v (%v)", entries, err)
+	}
+	if _, err := os.Stat(indexPath(cfg)); !os.IsNotExist(err) {
+		t.Error("reading must not create the index")
+	}
+}
+
+func TestIndexFilter(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 1, d, 10, 0, 0, 0, time.Local) }
+	entry := IndexEntry{StartedAt: day(15), Status: IndexSummaryFailed, PromptTemplate: "reunion"}
+
+	cases := []struct {
+		name   string
+		filter IndexFilter
+		match  bool
+	}{
+		{"empty filter", IndexFilter{}, true},
+		{"since same day", IndexFilter{Since: time.Date(2026, 1, 15, 0, 0, 0, 0, time.Local)}, true},
+		{"since later day", IndexFilter{Since: time.Date(2026, 1, 16, 0, 0, 0, 0, time.Local)}, false},
+		{"until same day", IndexFilter{Until: time.Date(2026, 1, 15, 0, 0, 0, 0, time.Local)}, true},
+		{"until earlier day", IndexFilter{Until: time.Date(2026, 1, 14, 0, 0, 0, 0, time.Local)}, false},
+		{"status", IndexFilter{Status: IndexSummaryFailed}, true},
+		{"other status", IndexFilter{Status: IndexSummarized}, false},
+		{"prompt", IndexFilter{Prompt: "reunion"}, true},
+		{"other prompt", IndexFilter{Prompt: "default"}, false},
+	}
+	for _, tc := range cases {
+		if got := tc.filter.Match(entry); got != tc.match {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.match, got)
+		}
+	}
+}
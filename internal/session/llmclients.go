@@ -0,0 +1,132 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+)
+
+// llmClients is the configured LLM, plus one for every other backend a
+// prompt file's header asks for (see promptSettings), made the first time
+// it's needed and kept for the rest of the job.
+type llmClients struct {
+	cfg config.LLMConfig
+
+	mu      sync.Mutex
+	clients map[string]llm.Generator // by backend, cfg.Backend's the configured one
+	used    []string                 // backends that answered, in order
+}
+
+func newLLMClients(cfg config.LLMConfig, configured llm.Generator) *llmClients {
+	return &llmClients{cfg: cfg, clients: map[string]llm.Generator{cfg.Backend: configured}}
+}
+
+// generate sends req to backend, the configured one if "".
+func (c *llmClients) generate(ctx context.Context, backend string, req llm.Request) (string, error) {
+	if backend == "" {
+		backend = c.cfg.Backend
+	}
+	client, err := c.client(backend)
+	if err != nil {
+		return "", err
+	}
+
+	reply, err := client.Generate(ctx, req)
+	if err == nil {
+		c.mu.Lock()
+		if !slices.Contains(c.used, backend) {
+			c.used = append(c.used, backend)
+		}
+		c.mu.Unlock()
+	}
+	return reply, err
+}
+
+// generateValid is generate for a reply that must parse: one that parse
+// rejects is asked for once more, quoting it and what was wrong with it.
+func (c *llmClients) generateValid(ctx context.Context, backend string, req llm.Request, parse func(reply string) error) error {
+	reply, err := c.generate(ctx, backend, req)
+	if err != nil {
+		return err
+	}
+	invalid := parse(reply)
+	if invalid == nil {
+		return nil
+	}
+
+	req.Prompt += fmt.Sprintf("\n\nTu respuesta anterior no es válida (%v):\n\n%s\n\nResponde de nuevo solo con el JSON pedido.", invalid, reply)
+	if reply, err = c.generate(ctx, backend, req); err != nil {
+		return err
+	}
+	if err := parse(reply); err != nil {
+		return fmt.Errorf("invalid reply, twice: %w", err)
+	}
+	return nil
+}
+
+// decodeReply decodes a reply that must be a single JSON object into v,
+// with no fields v doesn't have. It may be wrapped in a ```json code
+// fence, as models tend to do, but must otherwise be the object alone.
+func decodeReply(reply string, v any) error {
+	reply = strings.TrimSpace(reply)
+	if fenced, ok := strings.CutPrefix(reply, "```"); ok {
+		fenced = strings.TrimPrefix(fenced, "json")
+		reply = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(fenced), "```"))
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(reply))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		return fmt.Errorf("not the JSON object asked for: %w", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return fmt.Errorf("unexpected text after the JSON object")
+	}
+	return nil
+}
+
+// client returns backend's client, making it if it's not the configured
+// one. It keeps the configured fallback chain, minus backend itself.
+func (c *llmClients) client(backend string) (llm.Generator, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[backend]; ok {
+		return client, nil
+	}
+
+	cfg := c.cfg
+	cfg.Backend = backend
+	cfg.Fallback = slices.DeleteFunc(slices.Clone(c.cfg.Fallback), func(name string) bool { return name == backend })
+	client, err := llm.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize LLM %s: %w", backend, err)
+	}
+	c.clients[backend] = client
+	return client, nil
+}
+
+// usedBackends names the backends that have answered so far, as recorded
+// in the session index (see llm.Used): "claude", or "claude+ollama" when a
+// prompt file's header or a fallback brought in another.
+func (c *llmClients) usedBackends() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var names []string
+	for _, backend := range c.used {
+		for _, name := range strings.Split(llm.Used(c.clients[backend], backend), "+") {
+			if name != "" && !slices.Contains(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	return strings.Join(names, "+")
+}
@@ -0,0 +1,251 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sabhz/trani/internal/llm"
+)
+
+// charsPerToken is a deliberately low estimate of how many characters make
+// up a token, so prompt sizes are overestimated rather than under: Spanish
+// text runs at roughly 3.5 to 4 characters per token in current tokenizers.
+const charsPerToken = 3
+
+// estimateTokens estimates how many tokens s takes in a prompt. There's no
+// tokenizer for every backend, and the limit it's checked against is
+// approximate anyway.
+func estimateTokens(s string) int {
+	return (utf8.RuneCountInString(s) + charsPerToken - 1) / charsPerToken
+}
+
+// mapReducePrompts are the templates used to summarize a transcript in
+// parts: mapPrompt for each part, reducePrompt for the final document.
+type mapReducePrompts struct {
+	mapPrompt    promptFile
+	reducePrompt promptFile
+}
+
+// loadMapReducePrompts loads templateName's map and reduce prompts
+// (<name>_map.txt and <name>_reduce.txt, or <name>_reduce_no_notes.txt if
+// there's one and no notes), each falling back to the default template's.
+func loadMapReducePrompts(promptsDir, templateName string, hasNotes bool) (mapReducePrompts, error) {
+	mapPrompt, err := loadPromptFile(promptsDir, templateName, "_map.txt")
+	if err != nil {
+		return mapReducePrompts{}, err
+	}
+
+	suffixes := []string{"_reduce.txt"}
+	if !hasNotes {
+		suffixes = []string{"_reduce_no_notes.txt", "_reduce.txt"}
+	}
+	reducePrompt, err := loadPromptFile(promptsDir, templateName, suffixes...)
+	if err != nil {
+		return mapReducePrompts{}, err
+	}
+
+	return mapReducePrompts{mapPrompt: mapPrompt, reducePrompt: reducePrompt}, nil
+}
+
+// summaryHeadStart is a summary of a transcript's beginning that's already
+// been generated (a session's rolling summary), and the transcript text
+// after what it covers.
+type summaryHeadStart struct {
+	summary string
+	rest    string
+}
+
+// summarizeInParts summarizes a transcript too long for a single prompt of
+// at most maxTokens: every window of it is summarized on its own with the
+// map prompt, then the final document is generated from those partial
+// summaries and data's notes with the reduce prompt. Partial summaries that
+// are still too long together are summarized again, in groups, until they
+// fit. A non-empty earlier summary stands in as the first partial summary,
+// for text that precedes transcription.
+func summarizeInParts(ctx context.Context, llms *llmClients, prompts mapReducePrompts, earlier, transcription string, data promptData, maxTokens int) (string, error) {
+	budget := maxTokens - estimateTokens(prompts.mapPrompt.template) - estimateTokens(prompts.mapPrompt.settings.System)
+	if budget <= 0 {
+		return "", fmt.Errorf("max_prompt_tokens (%d) is too small to fit the map prompt", maxTokens)
+	}
+
+	parts := splitTranscript(transcription, data.chunkLines, budget)
+	var summaries []string
+	if earlier != "" {
+		summaries = append(summaries, earlier)
+	}
+	for {
+		partial, err := summarizeParts(ctx, llms, prompts.mapPrompt, parts, data)
+		if err != nil {
+			return "", err
+		}
+		summaries = append(summaries, partial...)
+
+		req, err := fillReducePrompt(prompts.reducePrompt, summaries, data)
+		if err != nil {
+			return "", err
+		}
+		if len(summaries) == 1 || requestTokens(req) <= maxTokens {
+			return llms.generate(ctx, prompts.reducePrompt.settings.Backend, req)
+		}
+
+		regrouped := packWindows(summaries, "\n\n", budget)
+		if len(regrouped) >= len(summaries) {
+			return "", fmt.Errorf("partial summaries don't fit in max_prompt_tokens (%d); raise it", maxTokens)
+		}
+		parts, summaries = regrouped, nil
+	}
+}
+
+// condenseTranscript summarizes a transcript in parts with templateName's
+// map prompt (falling back to default_map.txt), for a request that needs
+// what it says but can't fit it whole: the partial summaries, numbered like
+// a reduce prompt gets them, starting from headStart when there is one.
+func condenseTranscript(ctx context.Context, llms *llmClients, promptsDir, templateName, transcription string, headStart *summaryHeadStart, data promptData, maxTokens int) (string, error) {
+	mapPrompt, err := loadPromptFile(promptsDir, templateName, "_map.txt")
+	if err != nil {
+		return "", err
+	}
+	budget := maxTokens - estimateTokens(mapPrompt.template) - estimateTokens(mapPrompt.settings.System)
+	if budget <= 0 {
+		return "", fmt.Errorf("max_prompt_tokens (%d) is too small to fit the map prompt", maxTokens)
+	}
+
+	var summaries []string
+	if headStart != nil {
+		summaries = append(summaries, headStart.summary)
+		transcription = headStart.rest
+	}
+	partial, err := summarizeParts(ctx, llms, mapPrompt, splitTranscript(transcription, data.chunkLines, budget), data)
+	if err != nil {
+		return "", err
+	}
+	return numberSummaries(append(summaries, partial...)), nil
+}
+
+// renderWithTranscript renders prompt with the transcript, or if that
+// doesn't fit in maxTokens, with it condensed (see condenseTranscript).
+func renderWithTranscript(ctx context.Context, llms *llmClients, prompt promptFile, promptsDir, templateName, transcription string, headStart *summaryHeadStart, data promptData, maxTokens int) (llm.Request, error) {
+	data.Transcription = transcription
+	req, err := prompt.render(data)
+	if err != nil || maxTokens <= 0 || requestTokens(req) <= maxTokens {
+		return req, err
+	}
+	if data.Transcription, err = condenseTranscript(ctx, llms, promptsDir, templateName, transcription, headStart, data, maxTokens); err != nil {
+		return llm.Request{}, err
+	}
+	return prompt.render(data)
+}
+
+// summarizeParts summarizes every part on its own with the map prompt.
+func summarizeParts(ctx context.Context, llms *llmClients, mapPrompt promptFile, parts []string, data promptData) ([]string, error) {
+	summaries := make([]string, 0, len(parts))
+	for i, part := range parts {
+		req, err := fillMapPrompt(mapPrompt, part, i+1, len(parts), data)
+		if err != nil {
+			return nil, err
+		}
+		summary, err := llms.generate(ctx, mapPrompt.settings.Backend, req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to summarize part %d of %d: %w", i+1, len(parts), err)
+		}
+		if strings.TrimSpace(summary) == "" {
+			return nil, fmt.Errorf("the model returned an empty summary for part %d of %d", i+1, len(parts))
+		}
+		summaries = append(summaries, strings.TrimSpace(summary))
+	}
+	return summaries, nil
+}
+
+// splitTranscript splits transcription into windows of at most maxTokens
+// each. Windows end between chunks whenever chunks fit: chunkLines are how
+// many of its lines each chunk takes, counted back from its end so that
+// the tail of a transcript still lines up with its last chunks. A chunk
+// too long on its own, or a transcript with no chunks recorded (made in a
+// single pass), is split at lines, and a line at words.
+func splitTranscript(transcription string, chunkLines []int, maxTokens int) []string {
+	lines := strings.Split(transcription, "\n")
+	var chunks [][]string
+	end := len(lines)
+	for i := len(chunkLines) - 1; i > 0 && end > 0; i-- {
+		start := max(end-chunkLines[i], 0)
+		if start < end {
+			chunks = append(chunks, lines[start:end])
+		}
+		end = start
+	}
+	if end > 0 {
+		chunks = append(chunks, lines[:end])
+	}
+	slices.Reverse(chunks)
+
+	var pieces []string
+	for _, chunk := range chunks {
+		text := strings.TrimSpace(strings.Join(chunk, "\n"))
+		if text == "" {
+			continue
+		}
+		if estimateTokens(text) <= maxTokens {
+			pieces = append(pieces, text)
+			continue
+		}
+
+		var split []string
+		for _, line := range chunk {
+			if estimateTokens(line) <= maxTokens {
+				split = append(split, line)
+				continue
+			}
+			split = append(split, packWindows(strings.Fields(line), " ", maxTokens)...)
+		}
+		pieces = append(pieces, packWindows(split, "\n", maxTokens)...)
+	}
+	return packWindows(pieces, "\n", maxTokens)
+}
+
+// packWindows joins consecutive pieces with sep into as few windows of at
+// most maxTokens as it can, in order. A piece larger than maxTokens on its
+// own becomes a window by itself.
+func packWindows(pieces []string, sep string, maxTokens int) []string {
+	var windows []string
+	var current string
+	for _, piece := range pieces {
+		switch {
+		case current == "":
+			current = piece
+		case estimateTokens(current+sep+piece) <= maxTokens:
+			current += sep + piece
+		default:
+			windows = append(windows, current)
+			current = piece
+		}
+	}
+	if current != "" {
+		windows = append(windows, current)
+	}
+	return windows
+}
+
+// fillMapPrompt renders the map prompt for one part.
+func fillMapPrompt(prompt promptFile, part string, index, total int, data promptData) (llm.Request, error) {
+	data.Transcription, data.Part, data.Parts = part, index, total
+	return prompt.render(data)
+}
+
+// fillReducePrompt renders the reduce prompt, numbering the partial
+// summaries in order.
+func fillReducePrompt(prompt promptFile, summaries []string, data promptData) (llm.Request, error) {
+	data.Transcription, data.Summaries = "", numberSummaries(summaries)
+	return prompt.render(data)
+}
+
+// numberSummaries joins partial summaries under numbered headings.
+func numberSummaries(summaries []string) string {
+	numbered := make([]string, len(summaries))
+	for i, summary := range summaries {
+		numbered[i] = fmt.Sprintf("### Parte %d\n\n%s", i+1, summary)
+	}
+	return strings.Join(numbered, "\n\n")
+}
@@ -0,0 +1,165 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// recordingGenerator answers every prompt with a numbered reply and keeps
+// the requests it got.
+type recordingGenerator struct {
+	prompts  []string
+	requests []llm.Request
+}
+
+func (g *recordingGenerator) Generate(ctx context.Context, req llm.Request) (string, error) {
+	g.prompts = append(g.prompts, req.Prompt)
+	g.requests = append(g.requests, req)
+	return fmt.Sprintf("respuesta %d", len(g.prompts)), nil
+}
+
+// clients makes g the configured LLM.
+func (g *recordingGenerator) clients() *llmClients {
+	return newLLMClients(config.LLMConfig{}, g)
+}
+
+func TestSplitTranscriptAtChunkBoundaries(t *testing.T) {
+	first := strings.Repeat("a", 30)  // 10 tokens
+	second := strings.Repeat("b", 24) // two lines of 8 tokens
+	transcription := first + "\n" + second + "\n" + second
+
+	for name, chunkLines := range map[string][]int{
+		"whole transcript": {1, 2},
+		// Only the tail of a transcript whose first chunk took 3 lines.
+		"tail": {3, 1, 2},
+	} {
+		windows := splitTranscript(transcription, chunkLines, 22)
+		expected := []string{first, second + "\n" + second}
+		if !slices.Equal(windows, expected) {
+			t.Errorf("%s: expected %q, got %q", name, expected, windows)
+		}
+	}
+
+	// Without chunks it can only pack lines.
+	windows := splitTranscript(transcription, nil, 22)
+	if expected := []string{first + "\n" + second, second}; !slices.Equal(windows, expected) {
+		t.Errorf("no chunks: expected %q, got %q", expected, windows)
+	}
+}
+
+func TestSplitTranscriptOversizedChunk(t *testing.T) {
+	line := strings.Repeat("a", 30)
+	words := strings.TrimSpace(strings.Repeat(strings.Repeat("b", 8)+" ", 6)) // 6 words of 3 tokens
+	transcription := line + "\n" + line + "\n" + words
+
+	windows := splitTranscript(transcription, nil, 12)
+	for _, w := range windows {
+		if estimateTokens(w) > 12 {
+			t.Errorf("window over the limit: %q", w)
+		}
+	}
+	if got := strings.Join(windows, " "); strings.Join(strings.Fields(got), " ") != strings.Join(strings.Fields(transcription), " ") {
+		t.Errorf("windows lost or reordered text: %q", windows)
+	}
+}
+
+func TestSummarizeInParts(t *testing.T) {
+	prompts := mapReducePrompts{
+		mapPrompt:    promptFile{template: "MAP {{PART}}/{{PARTS}}: {{TRANSCRIPTION}}"},
+		reducePrompt: promptFile{template: "REDUCE {{SUMMARIES}} NOTAS {{NOTES}}"},
+	}
+	chunk := strings.Repeat("a", 60)
+	transcription := strings.Join([]string{chunk, chunk, chunk}, "\n")
+
+	llmClient := &recordingGenerator{}
+	resumen, err := summarizeInParts(context.Background(), llmClient.clients(), prompts, "", transcription, promptData{Notes: "mis notas"}, 40)
+	if err != nil {
+		t.Fatalf("summarizeInParts failed: %v", err)
+	}
+
+	if len(llmClient.prompts) != 4 {
+		t.Fatalf("expected 3 map calls and 1 reduce call, got %q", llmClient.prompts)
+	}
+	if llmClient.prompts[0] != "MAP 1/3: "+chunk {
+		t.Errorf("unexpected first map prompt: %q", llmClient.prompts[0])
+	}
+	expectedReduce := "REDUCE ### Parte 1\n\nrespuesta 1\n\n### Parte 2\n\nrespuesta 2\n\n### Parte 3\n\nrespuesta 3 NOTAS mis notas"
+	if llmClient.prompts[3] != expectedReduce {
+		t.Errorf("expected reduce prompt %q, got %q", expectedReduce, llmClient.prompts[3])
+	}
+	if resumen != "respuesta 4" {
+		t.Errorf("expected the reduce reply as the summary, got %q", resumen)
+	}
+}
+
+func TestSummarizeInPartsRegroupsLongSummaries(t *testing.T) {
+	prompts := mapReducePrompts{
+		mapPrompt:    promptFile{template: "{{TRANSCRIPTION}}"},
+		reducePrompt: promptFile{template: "{{SUMMARIES}}"},
+	}
+	chunk := strings.Repeat("a", 30)
+	transcription := strings.Join([]string{chunk, chunk, chunk, chunk}, "\n")
+
+	// Four partial summaries with their headings don't fit in 20 tokens, so
+	// they're summarized again, three at a time, before the reduce.
+	llmClient := &recordingGenerator{}
+	if _, err := summarizeInParts(context.Background(), llmClient.clients(), prompts, "", transcription, promptData{}, 20); err != nil {
+		t.Fatalf("summarizeInParts failed: %v", err)
+	}
+	if len(llmClient.prompts) != 4+2+1 {
+		t.Fatalf("expected 4 map calls, 2 regrouped map calls and 1 reduce call, got %q", llmClient.prompts)
+	}
+	if llmClient.prompts[4] != "respuesta 1\n\nrespuesta 2\n\nrespuesta 3" {
+		t.Errorf("unexpected regrouped prompt: %q", llmClient.prompts[4])
+	}
+}
+
+func TestSummarizeInPartsMapPromptTooLarge(t *testing.T) {
+	prompts := mapReducePrompts{mapPrompt: promptFile{template: strings.Repeat("x", 300)}, reducePrompt: promptFile{template: "{{SUMMARIES}}"}}
+	if _, err := summarizeInParts(context.Background(), (&recordingGenerator{}).clients(), prompts, "", "hola", promptData{}, 50); err == nil {
+		t.Error("expected an error when the map prompt alone exceeds the limit")
+	}
+}
+
+func TestWriteSummaryInPartsPastLimit(t *testing.T) {
+	promptsDir := t.TempDir()
+	if err := ensureDefaultPrompts(promptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+	notePath := filepath.Join(t.TempDir(), "2026-01-15 1430.md")
+
+	chunk := strings.Repeat("palabra ", 500)
+	transcription := strings.Join([]string{chunk, chunk, chunk}, "\n")
+
+	llmClient := &recordingGenerator{}
+	err := writeSummary(context.Background(), llmClient.clients(), notePath, transcription, nil, promptsDir, "default", "2026-01-15 1430", promptData{}, 2000, placeOwn, notify.New())
+	if err != nil {
+		t.Fatalf("writeSummary failed: %v", err)
+	}
+
+	if len(llmClient.prompts) < 3 {
+		t.Fatalf("expected the transcript to be summarized in parts, got %d prompts", len(llmClient.prompts))
+	}
+	for _, prompt := range llmClient.prompts {
+		if estimateTokens(prompt) > 2000 {
+			t.Errorf("prompt of %d tokens exceeds the limit", estimateTokens(prompt))
+		}
+	}
+
+	note, err := os.ReadFile(notePath)
+	if err != nil {
+		t.Fatalf("failed to read note: %v", err)
+	}
+	if last := fmt.Sprintf("respuesta %d", len(llmClient.prompts)); !strings.Contains(string(note), last) {
+		t.Errorf("expected the note to hold the reduce reply %q, got %q", last, note)
+	}
+}
@@ -0,0 +1,323 @@
+package session
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sabhz/trani/pkg/errlog"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// A prompt template can have a pipeline, <prompts_dir>/<name>.pipeline.yaml,
+// in which case postprocessing runs its steps in place of the single
+// summary: each step is one request built from its own prompt file, reading
+// the transcript, the notes and the output of earlier steps, and its output
+// goes to a section of the note, a file of its own or a frontmatter field.
+//
+//	steps:
+//	  - name: resumen
+//	    prompt: equipo_resumen.txt
+//	    target: section
+//	    heading: Resumen
+//	  - name: slack
+//	    prompt: equipo_slack.txt
+//	    inputs: [resumen]
+//	    target: frontmatter
+
+// Pipeline step inputs, besides the names of earlier steps.
+const (
+	inputTranscript = "transcript"
+	inputNotes      = "notes"
+)
+
+// Pipeline step targets. A step without one only feeds later steps.
+const (
+	targetSection     = "section"
+	targetFile        = "file"
+	targetFrontmatter = "frontmatter"
+)
+
+const pipelineSuffix = ".pipeline.yaml"
+
+var stepNamePattern = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
+type pipeline struct {
+	Steps []pipelineStep `yaml:"steps"`
+}
+
+type pipelineStep struct {
+	Name   string   `yaml:"name"`   // letters, digits and _, so templates can use {{.Steps.name}}
+	Prompt string   `yaml:"prompt"` // prompt file in prompts_dir, header included (see promptSettings)
+	Inputs []string `yaml:"inputs"` // transcript, notes, or earlier steps; both of the former by default
+	Target string   `yaml:"target"`
+
+	Heading string `yaml:"heading"` // section: its "## " heading, the step's name by default
+	Path    string `yaml:"path"`    // file: relative to the note's directory, rendered like a prompt
+	Key     string `yaml:"key"`     // frontmatter: the field, the step's name by default
+}
+
+// loadPipeline loads templateName's pipeline, nil if it has none. The
+// pipeline is checked as a whole, filling in defaults, so a mistake in
+// any step fails it before a single request is made.
+func loadPipeline(promptsDir, templateName string) (*pipeline, error) {
+	filename := templateName + pipelineSuffix
+	content, err := os.ReadFile(filepath.Join(promptsDir, filename))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pipeline: %w", err)
+	}
+
+	var p pipeline
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&p); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("%s: invalid pipeline: %w", filename, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+	return &p, nil
+}
+
+func (p *pipeline) validate() error {
+	if len(p.Steps) == 0 {
+		return fmt.Errorf("the pipeline has no steps")
+	}
+
+	seen := make(map[string]bool)
+	for i := range p.Steps {
+		step := &p.Steps[i]
+		switch {
+		case !stepNamePattern.MatchString(step.Name):
+			return fmt.Errorf("step %d: name %q must be letters, digits and _ only", i+1, step.Name)
+		case step.Name == inputTranscript || step.Name == inputNotes:
+			return fmt.Errorf("step %d: %q is reserved for an input", i+1, step.Name)
+		case step.Name == actionItemsStep:
+			return fmt.Errorf("step %d: %q is reserved for postprocess.action_items", i+1, step.Name)
+		case seen[step.Name]:
+			return fmt.Errorf("step %d: there's already a step named %q", i+1, step.Name)
+		case step.Prompt == "":
+			return fmt.Errorf("step %s has no prompt", step.Name)
+		}
+
+		if len(step.Inputs) == 0 {
+			step.Inputs = []string{inputTranscript, inputNotes}
+		}
+		for _, input := range step.Inputs {
+			if input != inputTranscript && input != inputNotes && !seen[input] {
+				return fmt.Errorf("step %s reads %q, which is neither transcript, notes nor an earlier step", step.Name, input)
+			}
+		}
+
+		switch step.Target {
+		case "":
+		case targetSection:
+			if step.Heading == "" {
+				step.Heading = step.Name
+			}
+		case targetFile:
+			if step.Path == "" {
+				step.Path = "{{.Title}} - " + step.Name + ".md"
+			}
+		case targetFrontmatter:
+			if step.Key == "" {
+				step.Key = step.Name
+			}
+		default:
+			return fmt.Errorf("step %s: unknown target %q (expected section, file or frontmatter)", step.Name, step.Target)
+		}
+		seen[step.Name] = true
+	}
+	return nil
+}
+
+// pipelineRun is what a pipeline's steps are run with.
+type pipelineRun struct {
+	llms            *llmClients
+	promptsDir      string
+	promptTemplate  string
+	transcription   string
+	headStart       *summaryHeadStart
+	data            promptData // with the note, without the transcript
+	maxPromptTokens int
+
+	condensed string
+}
+
+// runPipeline is writeSummary for a template with a pipeline. Every step
+// runs before anything is written, so a step that fails leaves the note,
+// and every file the pipeline writes, untouched. Sections are placed as
+// writeSummary places the summary, each one relative to the same step's
+// sections only; frontmatter fields are overwritten; files are rewritten.
+func runPipeline(ctx context.Context, llms *llmClients, p *pipeline, notePath, transcription string, headStart *summaryHeadStart, promptsDir, promptTemplate, sessionTitle string, data promptData, maxPromptTokens int, placement summaryPlacement, notifier *notify.Notifier) error {
+	raw, _ := os.ReadFile(notePath)
+	content := string(raw)
+
+	prompts := make([]promptFile, len(p.Steps))
+	for i, step := range p.Steps {
+		prompt, err := loadPipelinePrompt(promptsDir, step.Prompt)
+		if err != nil {
+			err = fmt.Errorf("step %s: %w", step.Name, err)
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al cargar plantilla de prompt (%s): %v", sessionTitle, err))
+			errlog.Error("prompt_template", sessionTitle, err)
+			return err
+		}
+		prompts[i] = prompt
+	}
+
+	run := &pipelineRun{
+		llms:            llms,
+		promptsDir:      promptsDir,
+		promptTemplate:  promptTemplate,
+		transcription:   transcription,
+		headStart:       headStart,
+		data:            data.withNote(strings.TrimSpace(stripResumenSections(content))),
+		maxPromptTokens: maxPromptTokens,
+	}
+	outputs := make(map[string]string, len(p.Steps))
+	for i, step := range p.Steps {
+		output, err := run.step(ctx, step, prompts[i], outputs)
+		if err != nil {
+			err = fmt.Errorf("step %s: %w", step.Name, err)
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al generar resumen (%s): %v", sessionTitle, err))
+			errlog.Error("summary", sessionTitle, err)
+			return err
+		}
+		outputs[step.Name] = output
+	}
+
+	now := time.Now()
+	for _, step := range p.Steps {
+		var err error
+		switch step.Target {
+		case targetSection:
+			section := formatStepSection(sessionTitle, step.Name, step.Heading, now, outputs[step.Name])
+			content = placeStepSection(content, section, sessionTitle, step.Name, placement)
+		case targetFrontmatter:
+			content, err = setFrontmatterField(content, step.Key, outputs[step.Name])
+		}
+		if err != nil {
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al guardar la nota (%s): %v", sessionTitle, err))
+			errlog.Error("note_write", sessionTitle, err)
+			return err
+		}
+	}
+	if err := os.WriteFile(notePath, []byte(content), 0644); err != nil {
+		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al guardar la nota (%s): %v", sessionTitle, err))
+		errlog.Error("note_write", sessionTitle, err)
+		return fmt.Errorf("failed to update note: %w", err)
+	}
+
+	for _, step := range p.Steps {
+		if step.Target != targetFile {
+			continue
+		}
+		if err := writeStepFile(filepath.Dir(notePath), step, outputs[step.Name], run.data); err != nil {
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al guardar la nota (%s): %v", sessionTitle, err))
+			errlog.Error("note_write", sessionTitle, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// loadPipelinePrompt reads a step's prompt file from promptsDir.
+func loadPipelinePrompt(promptsDir, filename string) (promptFile, error) {
+	content, err := os.ReadFile(filepath.Join(promptsDir, filename))
+	if err != nil {
+		return promptFile{}, fmt.Errorf("failed to read prompt: %w", err)
+	}
+	prompt, err := parsePromptFile(string(content))
+	if err != nil {
+		return promptFile{}, fmt.Errorf("%s: %w", filename, err)
+	}
+	return prompt, nil
+}
+
+// step runs one step, with only the inputs it reads filled in. A step that
+// reads the transcript and doesn't fit in maxPromptTokens with it gets the
+// transcript summarized in parts instead (see condensedTranscript).
+func (r *pipelineRun) step(ctx context.Context, step pipelineStep, prompt promptFile, outputs map[string]string) (string, error) {
+	data := r.data
+	data.Notes = ""
+	data.Steps = make(map[string]string)
+	for _, input := range step.Inputs {
+		switch input {
+		case inputTranscript:
+			data.Transcription = r.transcription
+		case inputNotes:
+			data.Notes = r.data.Notes
+		default:
+			data.Steps[input] = outputs[input]
+		}
+	}
+
+	req, err := prompt.render(data)
+	if err != nil {
+		return "", err
+	}
+	if r.maxPromptTokens > 0 && requestTokens(req) > r.maxPromptTokens && slices.Contains(step.Inputs, inputTranscript) {
+		if data.Transcription, err = r.condensedTranscript(ctx); err != nil {
+			return "", err
+		}
+		if req, err = prompt.render(data); err != nil {
+			return "", err
+		}
+	}
+	if r.maxPromptTokens > 0 && requestTokens(req) > r.maxPromptTokens {
+		return "", fmt.Errorf("the prompt is estimated at %d tokens, past max_prompt_tokens (%d)", requestTokens(req), r.maxPromptTokens)
+	}
+
+	output, err := r.llms.generate(ctx, prompt.settings.Backend, req)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(output) == "" {
+		return "", fmt.Errorf("the model returned an empty output")
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// condensedTranscript is condenseTranscript's, made the first time a step
+// needs it and shared by every step after that.
+func (r *pipelineRun) condensedTranscript(ctx context.Context) (string, error) {
+	if r.condensed != "" {
+		return r.condensed, nil
+	}
+	condensed, err := condenseTranscript(ctx, r.llms, r.promptsDir, r.promptTemplate, r.transcription, r.headStart, r.data, r.maxPromptTokens)
+	if err != nil {
+		return "", err
+	}
+	r.condensed = condensed
+	return r.condensed, nil
+}
+
+// writeStepFile writes a file step's output to its path, relative to dir.
+func writeStepFile(dir string, step pipelineStep, output string, data promptData) error {
+	path, err := renderPrompt(step.Path, data)
+	if err != nil {
+		return fmt.Errorf("step %s: invalid path: %w", step.Name, err)
+	}
+	if path = strings.TrimSpace(path); !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("step %s: failed to create directory: %w", step.Name, err)
+	}
+	if err := os.WriteFile(path, []byte(output+"\n"), 0644); err != nil {
+		return fmt.Errorf("step %s: failed to write %s: %w", step.Name, path, err)
+	}
+	return nil
+}
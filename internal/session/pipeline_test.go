@@ -0,0 +1,210 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// writePrompts writes files, by name, to a new prompts directory.
+func writePrompts(t *testing.T, files map[string]string) string {
+	t.Helper()
+	promptsDir := t.TempDir()
+	if err := ensureDefaultPrompts(promptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(promptsDir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return promptsDir
+}
+
+const testPipeline = `steps:
+  - name: resumen
+    prompt: resumen.txt
+    target: section
+    heading: Resumen
+  - name: acciones
+    prompt: acciones.txt
+    inputs: [resumen]
+    target: file
+  - name: slack
+    prompt: slack.txt
+    inputs: [notes, acciones]
+    target: frontmatter
+`
+
+func TestRunPipeline(t *testing.T) {
+	promptsDir := writePrompts(t, map[string]string{
+		"equipo.pipeline.yaml": testPipeline,
+		"resumen.txt":          "RESUMEN {{.Transcription}}",
+		"acciones.txt":         "ACCIONES {{.Steps.resumen}}{{.Transcription}}",
+		"slack.txt":            "SLACK {{.Notes}} {{.Steps.acciones}}",
+	})
+	notePath := filepath.Join(t.TempDir(), "2026-01-15 1430.md")
+	if err := os.WriteFile(notePath, []byte("---\nasistentes: [Ana]\n---\nmis notas\n"), 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+
+	llmClient := &recordingGenerator{}
+	err := writeSummary(context.Background(), llmClient.clients(), notePath, "la transcripción", nil, promptsDir, "equipo", "2026-01-15 1430", promptData{Title: "2026-01-15 1430"}, 0, placeOwn, notify.New())
+	if err != nil {
+		t.Fatalf("writeSummary failed: %v", err)
+	}
+
+	expected := []string{
+		"RESUMEN la transcripción",
+		"ACCIONES respuesta 1",
+		"SLACK ---\nasistentes: [Ana]\n---\nmis notas respuesta 2",
+	}
+	if len(llmClient.prompts) != len(expected) {
+		t.Fatalf("expected %d prompts, got %q", len(expected), llmClient.prompts)
+	}
+	for i := range expected {
+		if llmClient.prompts[i] != expected[i] {
+			t.Errorf("prompt %d: expected %q, got %q", i, expected[i], llmClient.prompts[i])
+		}
+	}
+
+	note, err := os.ReadFile(notePath)
+	if err != nil {
+		t.Fatalf("failed to read note: %v", err)
+	}
+	if !strings.HasPrefix(string(note), "---\nasistentes: [Ana]\nslack: respuesta 3\n---\nmis notas\n") {
+		t.Errorf("expected the frontmatter field added and the notes kept, got %q", note)
+	}
+	sections := findResumenSections(string(note))
+	if len(sections) != 1 || sections[0].step != "resumen" || !strings.Contains(string(note), "## Resumen\n\nrespuesta 1\n") {
+		t.Errorf("expected one resumen section, got %q", note)
+	}
+
+	actions, err := os.ReadFile(filepath.Join(filepath.Dir(notePath), "2026-01-15 1430 - acciones.md"))
+	if err != nil || string(actions) != "respuesta 2\n" {
+		t.Errorf("expected the acciones file, got %q (%v)", actions, err)
+	}
+
+	// Running it again replaces its own outputs, and never feeds them back
+	// in as notes.
+	if err := writeSummary(context.Background(), llmClient.clients(), notePath, "la transcripción", nil, promptsDir, "equipo", "2026-01-15 1430", promptData{}, 0, placeOwn, notify.New()); err != nil {
+		t.Fatalf("second writeSummary failed: %v", err)
+	}
+	note, _ = os.ReadFile(notePath)
+	if n := len(findResumenSections(string(note))); n != 1 || strings.Count(string(note), "slack:") != 1 {
+		t.Errorf("expected the outputs replaced, got %q", note)
+	}
+	if last := llmClient.prompts[len(llmClient.prompts)-1]; strings.Contains(last, "## Resumen") {
+		t.Errorf("expected the generated section left out of the notes, got %q", last)
+	}
+}
+
+// failingGenerator fails its nth request.
+type failingGenerator struct {
+	recordingGenerator
+	failAt int
+}
+
+func (g *failingGenerator) Generate(ctx context.Context, req llm.Request) (string, error) {
+	if len(g.prompts)+1 == g.failAt {
+		g.prompts = append(g.prompts, req.Prompt)
+		return "", errors.New("sin servicio")
+	}
+	return g.recordingGenerator.Generate(ctx, req)
+}
+
+func TestRunPipelineStepFailureWritesNothing(t *testing.T) {
+	promptsDir := writePrompts(t, map[string]string{
+		"equipo.pipeline.yaml": testPipeline,
+		"resumen.txt":          "RESUMEN {{.Transcription}}",
+		"acciones.txt":         "ACCIONES {{.Steps.resumen}}",
+		"slack.txt":            "SLACK {{.Steps.acciones}}",
+	})
+	notePath := filepath.Join(t.TempDir(), "2026-01-15 1430.md")
+	if err := os.WriteFile(notePath, []byte("mis notas\n"), 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+
+	llms := newLLMClients(config.LLMConfig{}, &failingGenerator{failAt: 3})
+	err := writeSummary(context.Background(), llms, notePath, "hola", nil, promptsDir, "equipo", "2026-01-15 1430", promptData{Title: "2026-01-15 1430"}, 0, placeOwn, notify.New())
+	if err == nil || !strings.Contains(err.Error(), "step slack") {
+		t.Fatalf("expected the slack step to fail, got %v", err)
+	}
+
+	if note, _ := os.ReadFile(notePath); string(note) != "mis notas\n" {
+		t.Errorf("expected the note untouched, got %q", note)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(notePath), "2026-01-15 1430 - acciones.md")); !os.IsNotExist(err) {
+		t.Errorf("expected no acciones file, got %v", err)
+	}
+}
+
+func TestRunPipelineCondensesLongTranscript(t *testing.T) {
+	promptsDir := writePrompts(t, map[string]string{
+		"equipo.pipeline.yaml": "steps:\n  - name: resumen\n    prompt: resumen.txt\n    target: section\n",
+		"resumen.txt":          "RESUMEN {{.Transcription}}",
+		"equipo_map.txt":       "MAP {{.Transcription}}",
+	})
+	notePath := filepath.Join(t.TempDir(), "2026-01-15 1430.md")
+
+	chunk := strings.Repeat("a", 60)
+	transcription := chunk + "\n" + chunk
+
+	llmClient := &recordingGenerator{}
+	if err := writeSummary(context.Background(), llmClient.clients(), notePath, transcription, nil, promptsDir, "equipo", "2026-01-15 1430", promptData{}, 30, placeOwn, notify.New()); err != nil {
+		t.Fatalf("writeSummary failed: %v", err)
+	}
+
+	expected := []string{"MAP " + chunk, "MAP " + chunk, "RESUMEN ### Parte 1\n\nrespuesta 1\n\n### Parte 2\n\nrespuesta 2"}
+	if strings.Join(llmClient.prompts, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, llmClient.prompts)
+	}
+}
+
+func TestLoadPipelineInvalid(t *testing.T) {
+	for name, content := range map[string]string{
+		"no steps":       "steps: []\n",
+		"unknown field":  "steps:\n  - name: a\n    prompt: a.txt\n    targte: section\n",
+		"later input":    "steps:\n  - name: a\n    prompt: a.txt\n    inputs: [b]\n  - name: b\n    prompt: b.txt\n",
+		"duplicate":      "steps:\n  - name: a\n    prompt: a.txt\n  - name: a\n    prompt: b.txt\n",
+		"reserved name":  "steps:\n  - name: notes\n    prompt: a.txt\n",
+		"bad name":       "steps:\n  - name: plan de acción\n    prompt: a.txt\n",
+		"unknown target": "steps:\n  - name: a\n    prompt: a.txt\n    target: slack\n",
+		"no prompt":      "steps:\n  - name: a\n",
+	} {
+		promptsDir := writePrompts(t, map[string]string{"equipo.pipeline.yaml": content})
+		if _, err := loadPipeline(promptsDir, "equipo"); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	if p, err := loadPipeline(t.TempDir(), "equipo"); p != nil || err != nil {
+		t.Errorf("expected no pipeline without a file, got %v, %v", p, err)
+	}
+}
+
+func TestLoadPipelineDefaults(t *testing.T) {
+	promptsDir := writePrompts(t, map[string]string{
+		"equipo.pipeline.yaml": "steps:\n  - name: a\n    prompt: a.txt\n    target: section\n  - name: b\n    prompt: b.txt\n    target: file\n  - name: c\n    prompt: c.txt\n    target: frontmatter\n",
+	})
+	p, err := loadPipeline(promptsDir, "equipo")
+	if err != nil {
+		t.Fatalf("loadPipeline failed: %v", err)
+	}
+	if s := p.Steps[0]; s.Heading != "a" || strings.Join(s.Inputs, ",") != "transcript,notes" {
+		t.Errorf("unexpected section defaults: %+v", s)
+	}
+	if s := p.Steps[1]; s.Path != "{{.Title}} - b.md" {
+		t.Errorf("unexpected file defaults: %+v", s)
+	}
+	if s := p.Steps[2]; s.Key != "c" {
+		t.Errorf("unexpected frontmatter defaults: %+v", s)
+	}
+}
@@ -6,7 +6,9 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/sabhz/trani/internal/audio"
 	"github.com/sabhz/trani/internal/config"
 	"github.com/sabhz/trani/internal/llm"
 	"github.com/sabhz/trani/pkg/errlog"
@@ -27,6 +29,7 @@ func RunPostprocessWorker(ctx context.Context, notePath, sourcesTitle, promptTem
 	if err != nil {
 		return fmt.Errorf("failed to initialize LLM: %w", err)
 	}
+	llms := newLLMClients(cfg.LLM, llmClient)
 
 	sourcesDir := filepath.Join(cfg.Paths.SessionsDir, ".sources")
 	txtPath := filepath.Join(sourcesDir, sourcesTitle+".txt")
@@ -39,19 +42,56 @@ func RunPostprocessWorker(ctx context.Context, notePath, sourcesTitle, promptTem
 
 	transcription := removeConsecutiveDuplicateLines(strings.TrimSpace(string(rawTranscription)))
 
+	// A rolling summary made while recording saves summarizing most of a
+	// long transcript in parts all over again.
+	headStart := rollingHeadStart(cfg, sourcesTitle, rawTranscription)
+
 	sessionTitle := strings.TrimSuffix(filepath.Base(notePath), filepath.Ext(notePath))
 
-	if err := writeSummary(ctx, llmClient, notePath, transcription, cfg.Paths.PromptsDir, promptTemplate, sessionTitle, notifier); err != nil {
+	status := newStatusPublisher(cfg, JobStatus{
+		Kind:      JobPostprocess,
+		Title:     sessionTitle,
+		Stage:     StageSummarizing,
+		StartedAt: time.Now(),
+	})
+	defer status.remove()
+	logIndex(updateIndex(cfg, sourcesTitle, func(e *IndexEntry) { e.Status = IndexSummarizing }))
+
+	data := newPromptData(cfg, sourcesTitle).withChunks(cfg, rawTranscription)
+	if err := writeSummary(ctx, llms, notePath, transcription, headStart, cfg.Paths.PromptsDir, promptTemplate, sessionTitle, data, cfg.LLM.MaxPromptTokens, placeOwn, notifier); err != nil {
+		logIndex(updateIndex(cfg, sourcesTitle, func(e *IndexEntry) { e.Status = IndexSummaryFailed }))
 		// writeSummary already notified and logged the failure; the caller
 		// (cmd/postprocess_worker.go) would otherwise fire a second, generic
 		// failure notification on top of this specific one.
 		return nil
 	}
+	// Failures past this point are already notified and logged, and the
+	// summary's written: not worth failing the session over.
+	if cfg.Postprocess.TitleAndTags {
+		status.setStage(StageTitleAndTags)
+		notePath, _ = writeTitleAndTags(ctx, cfg, llms, notePath, transcription, headStart, promptTemplate, sourcesTitle, data, notifier)
+	}
+	if cfg.Postprocess.ActionItems {
+		status.setStage(StageActionItems)
+		writeActionItems(ctx, cfg, llms, notePath, transcription, headStart, promptTemplate, sessionTitle, data, placeOwn, notifier)
+	}
+	logIndex(updateIndex(cfg, sourcesTitle, func(e *IndexEntry) {
+		e.Status = IndexSummarized
+		e.SummarizedBy = llms.usedBackends()
+	}))
 
 	if !cfg.Audio.Preserve {
 		if err := os.Remove(wavPath); err != nil && !os.IsNotExist(err) {
 			return fmt.Errorf("failed to remove archived audio: %w", err)
 		}
+	} else {
+		status.setStage(StageCompressingAudio)
+		if err := compressArchive(ctx, wavPath, cfg.Audio.ArchiveFormat); err != nil {
+			// The summary is already written and the .wav is still intact,
+			// so this isn't worth failing the session over.
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al comprimir el audio (%s): %v", sessionTitle, err))
+			errlog.Error("archive_compress", sessionTitle, err)
+		}
 	}
 
 	doneMessage := fmt.Sprintf("Sesión completada - %s", sessionTitle)
@@ -64,26 +104,95 @@ func RunPostprocessWorker(ctx context.Context, notePath, sourcesTitle, promptTem
 	return nil
 }
 
+// compressArchive replaces a preserved session's .wav with an encoded copy
+// in the configured audio.archive_format, next to it with the matching
+// extension. The .wav is only removed once the encoded file is complete;
+// "wav" leaves it as is.
+func compressArchive(ctx context.Context, wavPath, format string) error {
+	if format == config.ArchiveFormatWAV {
+		return nil
+	}
+	if _, err := os.Stat(wavPath); os.IsNotExist(err) {
+		return nil
+	}
+
+	archivePath := strings.TrimSuffix(wavPath, ".wav") + "." + format
+	if err := audio.Encode(ctx, wavPath, archivePath); err != nil {
+		os.Remove(archivePath)
+		return err
+	}
+
+	if err := os.Remove(wavPath); err != nil {
+		return fmt.Errorf("failed to remove uncompressed audio: %w", err)
+	}
+	return nil
+}
+
 // writeSummary generates the structured summary from transcription + the
-// note's existing content, then appends it under a "## Resumen" heading.
-// The existing content (frontmatter, a "## Notas" section, whatever the
-// user already put in notePath) is always preserved verbatim; a failure at
-// any stage leaves notePath untouched. Shared by the live-session worker
-// and the standalone `process` command so both postprocess identically.
-func writeSummary(ctx context.Context, llmClient llm.Generator, notePath, transcription, promptsDir, promptTemplate, sessionTitle string, notifier *notify.Notifier) error {
-	existingContent, _ := os.ReadFile(notePath)
-	notes := strings.TrimSpace(string(existingContent))
+// note's existing content, then writes it into the note as a marked
+// "## Resumen" section, placed as placement says. Everything outside the
+// section's markers (frontmatter, a "## Notas" section, whatever the user
+// already put in notePath) is always preserved verbatim; a failure at any
+// stage leaves notePath untouched. Summaries already in the note are never
+// sent to the model as notes. A prompt estimated past maxPromptTokens is
+// never sent: the transcript is summarized in parts instead (see
+// summarizeInParts), starting from headStart when there is one; zero
+// means no limit. Prompts are rendered with data, the session's details,
+// plus the transcript and notes. Shared by the live-session
+// worker, the standalone `process` command and `resummarize` so all of them
+// postprocess identically. A template with a pipeline runs that instead
+// (see runPipeline).
+func writeSummary(ctx context.Context, llms *llmClients, notePath, transcription string, headStart *summaryHeadStart, promptsDir, promptTemplate, sessionTitle string, data promptData, maxPromptTokens int, placement summaryPlacement, notifier *notify.Notifier) error {
+	pipeline, err := loadPipeline(promptsDir, promptTemplate)
+	if err != nil {
+		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al cargar plantilla de prompt (%s): %v", sessionTitle, err))
+		errlog.Error("prompt_template", sessionTitle, err)
+		return err
+	}
+	if pipeline != nil {
+		return runPipeline(ctx, llms, pipeline, notePath, transcription, headStart, promptsDir, promptTemplate, sessionTitle, data, maxPromptTokens, placement, notifier)
+	}
+
+	raw, _ := os.ReadFile(notePath)
+	existingContent := string(raw)
+	noteContent := existingContent
+	if placement == placeReplace && len(findResumenSections(existingContent)) == 0 {
+		// The summary being replaced isn't the user's notes.
+		noteContent = removeResumenSection(existingContent)
+	}
+	notes := strings.TrimSpace(stripResumenSections(noteContent))
 	hasNotes := len(notes) > 0
 
-	template, err := loadPromptTemplateStandalone(promptsDir, promptTemplate, hasNotes)
+	data = data.withNote(notes)
+	var req llm.Request
+	prompt, err := loadPromptTemplateStandalone(promptsDir, promptTemplate, hasNotes)
+	if err == nil {
+		whole := data
+		whole.Transcription = transcription
+		req, err = prompt.render(whole)
+	}
 	if err != nil {
 		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al cargar plantilla de prompt (%s): %v", sessionTitle, err))
 		errlog.Error("prompt_template", sessionTitle, err)
 		return err
 	}
-	prompt := fillPromptTemplate(template, transcription, notes)
 
-	resumen, err := llmClient.Generate(ctx, prompt)
+	var resumen string
+	if maxPromptTokens <= 0 || requestTokens(req) <= maxPromptTokens {
+		resumen, err = llms.generate(ctx, prompt.settings.Backend, req)
+	} else {
+		prompts, loadErr := loadMapReducePrompts(promptsDir, promptTemplate, hasNotes)
+		if loadErr != nil {
+			notifier.Error("⚠️ Trani", fmt.Sprintf("Error al cargar plantilla de prompt (%s): %v", sessionTitle, loadErr))
+			errlog.Error("prompt_template", sessionTitle, loadErr)
+			return loadErr
+		}
+		if headStart != nil {
+			resumen, err = summarizeInParts(ctx, llms, prompts, headStart.summary, headStart.rest, data, maxPromptTokens)
+		} else {
+			resumen, err = summarizeInParts(ctx, llms, prompts, "", transcription, data, maxPromptTokens)
+		}
+	}
 
 	if err == nil && strings.TrimSpace(resumen) == "" {
 		err = fmt.Errorf("the model returned an empty summary")
@@ -95,7 +204,8 @@ func writeSummary(ctx context.Context, llmClient llm.Generator, notePath, transc
 		return err
 	}
 
-	finalContent := appendResumenSection(string(existingContent), resumen)
+	section := formatResumenSection(sessionTitle, time.Now(), resumen)
+	finalContent := placeResumenSection(existingContent, section, sessionTitle, placement)
 	if err := os.WriteFile(notePath, []byte(finalContent), 0644); err != nil {
 		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al guardar la nota (%s): %v", sessionTitle, err))
 		errlog.Error("note_write", sessionTitle, err)
@@ -104,14 +214,3 @@ func writeSummary(ctx context.Context, llmClient llm.Generator, notePath, transc
 
 	return nil
 }
-
-// appendResumenSection preserves existingContent verbatim (frontmatter, a
-// "## Notas" section, anything else already there) and adds resumen below
-// it under a fixed "## Resumen" heading.
-func appendResumenSection(existingContent, resumen string) string {
-	existing := strings.TrimRight(existingContent, "\n")
-	if existing == "" {
-		return "## Resumen\n\n" + resumen
-	}
-	return existing + "\n\n## Resumen\n\n" + resumen
-}
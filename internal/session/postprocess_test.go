@@ -1,40 +1,69 @@
 package session
 
-import "testing"
-
-func TestAppendResumenSection(t *testing.T) {
-	cases := []struct {
-		name            string
-		existingContent string
-		resumen         string
-		expected        string
-	}{
-		{
-			name:            "empty note",
-			existingContent: "",
-			resumen:         "El resumen generado.",
-			expected:        "## Resumen\n\nEl resumen generado.",
-		},
-		{
-			name:            "preserves frontmatter and Notas section",
-			existingContent: "---\nasistentes: []\n---\n\n## Notas\n\nAlgo que anoté.",
-			resumen:         "El resumen generado.",
-			expected:        "---\nasistentes: []\n---\n\n## Notas\n\nAlgo que anoté.\n\n## Resumen\n\nEl resumen generado.",
-		},
-		{
-			name:            "trims trailing newlines before appending",
-			existingContent: "## Notas\n\nAlgo.\n\n\n",
-			resumen:         "El resumen generado.",
-			expected:        "## Notas\n\nAlgo.\n\n## Resumen\n\nEl resumen generado.",
-		},
-	}
-
-	for _, c := range cases {
-		t.Run(c.name, func(t *testing.T) {
-			got := appendResumenSection(c.existingContent, c.resumen)
-			if got != c.expected {
-				t.Errorf("expected %q, got %q", c.expected, got)
-			}
-		})
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/sabhz/trani/internal/config"
+)
+
+func TestCompressArchiveKeepsWAVFormat(t *testing.T) {
+	wavPath := filepath.Join(t.TempDir(), "2026-01-15 1430.wav")
+	if err := os.WriteFile(wavPath, []byte("RIFF"), 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	if err := compressArchive(context.Background(), wavPath, config.ArchiveFormatWAV); err != nil {
+		t.Fatalf("compressArchive failed: %v", err)
+	}
+	if _, err := os.Stat(wavPath); err != nil {
+		t.Errorf("expected the .wav to be left in place: %v", err)
+	}
+}
+
+func TestCompressArchiveUnknownFormatKeepsWAV(t *testing.T) {
+	wavPath := filepath.Join(t.TempDir(), "2026-01-15 1430.wav")
+	if err := os.WriteFile(wavPath, []byte("RIFF"), 0644); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+
+	if err := compressArchive(context.Background(), wavPath, "mp3"); err == nil {
+		t.Error("expected an error for an unsupported archive format")
+	}
+	if _, err := os.Stat(wavPath); err != nil {
+		t.Errorf("expected the .wav to survive a failed compression: %v", err)
+	}
+}
+
+func TestCompressArchiveWithoutAudio(t *testing.T) {
+	wavPath := filepath.Join(t.TempDir(), "2026-01-15 1430.wav")
+	if err := compressArchive(context.Background(), wavPath, config.ArchiveFormatOpus); err != nil {
+		t.Errorf("expected no error when there's no archived audio, got %v", err)
+	}
+}
+
+func TestCompressArchiveEncodes(t *testing.T) {
+	if _, err := exec.LookPath("ffmpeg"); err != nil {
+		t.Skip("ffmpeg not installed")
+	}
+
+	for format, magic := range map[string]string{config.ArchiveFormatFLAC: "fLaC", config.ArchiveFormatOpus: "OggS"} {
+		wavPath := filepath.Join(t.TempDir(), "2026-01-15 1430.wav")
+		writeTestChunk(t, wavPath)
+
+		if err := compressArchive(context.Background(), wavPath, format); err != nil {
+			t.Fatalf("compressArchive (%s) failed: %v", format, err)
+		}
+		encoded, err := os.ReadFile(strings.TrimSuffix(wavPath, ".wav") + "." + format)
+		if err != nil || !strings.HasPrefix(string(encoded), magic) {
+			t.Errorf("expected a %s file, got %d bytes (%v)", format, len(encoded), err)
+		}
+		if _, err := os.Stat(wavPath); !os.IsNotExist(err) {
+			t.Errorf("expected the .wav to be removed once encoded to %s", format)
+		}
 	}
 }
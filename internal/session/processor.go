@@ -5,8 +5,11 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
+	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
 	"github.com/sabhz/trani/internal/config"
 	"github.com/sabhz/trani/internal/llm"
 	"github.com/sabhz/trani/internal/transcribe"
@@ -18,7 +21,8 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 		return fmt.Errorf("audio file not found: %s", audioPath)
 	}
 
-	sourcesTitle := time.Now().Format("2006-01-02 1504")
+	startedAt := time.Now()
+	sourcesTitle := startedAt.Format("2006-01-02 1504")
 	notePath := filepath.Join(cfg.Paths.SessionsDir, sourcesTitle+".md")
 	sourcesDir := filepath.Join(cfg.Paths.SessionsDir, ".sources")
 
@@ -33,11 +37,13 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 	if err != nil {
 		return fmt.Errorf("failed to initialize transcriber: %w", err)
 	}
+	defer transcribe.Close(transcriber)
 
 	llmClient, err := llm.New(cfg.LLM)
 	if err != nil {
 		return fmt.Errorf("failed to initialize LLM: %w", err)
 	}
+	llms := newLLMClients(cfg.LLM, llmClient)
 
 	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
 		return fmt.Errorf("failed to initialize prompts: %w", err)
@@ -47,10 +53,10 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 	notifier.Info("🎙️ Trani", "Procesando audio...")
 
 	processedAudioPath := filepath.Join(cfg.Paths.TempDir, sourcesTitle+".wav")
-	if err := copyFile(audioPath, processedAudioPath); err != nil {
+	defer os.Remove(processedAudioPath)
+	if err := copyAsWAV(ctx, audioPath, processedAudioPath); err != nil {
 		return fmt.Errorf("failed to copy audio file: %w", err)
 	}
-	defer os.Remove(processedAudioPath)
 
 	if err := postProcessAudio(processedAudioPath); err != nil {
 		return fmt.Errorf("failed to process audio: %w", err)
@@ -68,9 +74,27 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 		prompt = buildTranscriptionPrompt(string(notesContent))
 	}
 
-	transcription, err := transcriber.Transcribe(ctx, processedAudioPath, prompt)
+	vad, err := applyVAD(processedAudioPath, cfg.Audio)
 	if err != nil {
-		return fmt.Errorf("transcription failed: %w", err)
+		return err
+	}
+	defer vad.cleanup()
+
+	var result transcribe.Result
+	if cfg.Audio.VAD {
+		fmt.Printf("Speech detected in %.0f%% of the audio\n", vad.ratio*100)
+	}
+	if !vad.skip {
+		result, err = transcriber.Transcribe(ctx, vad.path, prompt)
+		if err != nil {
+			return fmt.Errorf("transcription failed: %w", err)
+		}
+		result.Segments = transcribe.Offset(result.Segments, vad.lead)
+	}
+	transcription := result.Text
+	var transcribedBy []string
+	if !vad.skip {
+		transcribedBy = []string{transcribedByBackend(cfg, result)}
 	}
 
 	transcriptionPath := filepath.Join(sourcesDir, sourcesTitle+".txt")
@@ -78,7 +102,40 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 		return fmt.Errorf("failed to save transcription: %w", err)
 	}
 
-	if err := writeSummary(ctx, llmClient, notePath, transcription, cfg.Paths.PromptsDir, promptTemplate, sourcesTitle, notifier); err != nil {
+	srtPath := filepath.Join(sourcesDir, sourcesTitle+".srt")
+	vttPath := filepath.Join(sourcesDir, sourcesTitle+".vtt")
+	if err := writeSubtitles(srtPath, vttPath, result.Segments); err != nil {
+		return err
+	}
+
+	entry := newIndexEntry(cfg, sourcesTitle, notePath, SourceProcess, promptTemplate, startedAt)
+	if d, err := wav.FileDuration(processedAudioPath); err == nil {
+		entry.DurationSeconds = d.Seconds()
+	}
+	entry.TranscribedBy = transcribedBy
+	if cfg.Audio.VAD {
+		entry.SpeechRatios = []float64{vad.ratio}
+	}
+	entry.Status = IndexSummarizing
+	logIndex(recordIndex(cfg, entry))
+
+	data := newPromptData(cfg, sourcesTitle)
+	err = writeSummary(ctx, llms, notePath, transcription, nil, cfg.Paths.PromptsDir, promptTemplate, sourcesTitle, data, cfg.LLM.MaxPromptTokens, placeOwn, notifier)
+	if err == nil {
+		// Their failures are notified and logged, and don't undo the summary.
+		notePath, _ = writeTitleAndTags(ctx, cfg, llms, notePath, transcription, nil, promptTemplate, sourcesTitle, data, notifier)
+		entry.NotePath = notePath
+		writeActionItems(ctx, cfg, llms, notePath, transcription, nil, promptTemplate, sourcesTitle, data, placeOwn, notifier)
+	}
+	entry.EndedAt = time.Now()
+	entry.Status = IndexSummarized
+	entry.SummarizedBy = llms.usedBackends()
+	if err != nil {
+		entry.Status = IndexSummaryFailed
+		entry.SummarizedBy = ""
+	}
+	logIndex(recordIndex(cfg, entry))
+	if err != nil {
 		return err
 	}
 
@@ -86,26 +143,52 @@ func ProcessFile(ctx context.Context, audioPath, notesPath, promptTemplate strin
 	return nil
 }
 
-func loadPromptTemplateStandalone(promptsDir, templateName string, hasNotes bool) (string, error) {
-	suffix := ".txt"
-	if !hasNotes {
-		suffix = "_no_notes.txt"
+// loadPromptTemplateStandalone loads templateName's summary prompt. Without
+// notes, <name>_no_notes.txt is preferred, but a single <name>.txt that
+// handles missing notes itself ({{if .Notes}}) does too.
+func loadPromptTemplateStandalone(promptsDir, templateName string, hasNotes bool) (promptFile, error) {
+	if hasNotes {
+		return loadPromptFile(promptsDir, templateName, ".txt")
 	}
+	return loadPromptFile(promptsDir, templateName, "_no_notes.txt", ".txt")
+}
 
-	filename := templateName + suffix
-	promptPath := filepath.Join(promptsDir, filename)
+// loadPromptFile reads the first of templateName's files with the given
+// suffixes that exists in promptsDir, falling back to the default
+// template's the same way, and parses its header (see parsePromptFile).
+func loadPromptFile(promptsDir, templateName string, suffixes ...string) (promptFile, error) {
+	names := []string{templateName}
+	if templateName != "default" {
+		names = append(names, "default")
+	}
 
-	content, err := os.ReadFile(promptPath)
-	if err != nil {
-		defaultFilename := "default" + suffix
-		defaultPath := filepath.Join(promptsDir, defaultFilename)
-		content, err = os.ReadFile(defaultPath)
-		if err != nil {
-			return "", fmt.Errorf("neither %q nor %q exist in %s", filename, defaultFilename, promptsDir)
+	var tried []string
+	for _, name := range names {
+		for _, suffix := range suffixes {
+			filename := name + suffix
+			content, err := os.ReadFile(filepath.Join(promptsDir, filename))
+			if err != nil {
+				tried = append(tried, fmt.Sprintf("%q", filename))
+				continue
+			}
+			prompt, err := parsePromptFile(string(content))
+			if err != nil {
+				return promptFile{}, fmt.Errorf("%s: %w", filename, err)
+			}
+			return prompt, nil
 		}
 	}
 
-	return string(content), nil
+	return promptFile{}, fmt.Errorf("none of %s exist in %s", strings.Join(tried, ", "), promptsDir)
+}
+
+// copyAsWAV makes the working copy of an input file: a straight copy if
+// it's already a 16-bit PCM WAV, decoded through ffmpeg otherwise.
+func copyAsWAV(ctx context.Context, src, dst string) error {
+	if _, err := wav.FileDuration(src); err == nil {
+		return copyFile(src, dst)
+	}
+	return audio.Decode(ctx, src, dst)
 }
 
 func copyFile(src, dst string) error {
@@ -0,0 +1,268 @@
+package session
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// promptData is what prompt templates are rendered with, as Go
+// text/template: {{.Title}}, {{if .Notes}}...{{end}}, {{range .Attendees}}
+// and so on. Which fields are filled in depends on the prompt: the summary
+// prompt gets the session's details, transcript and notes; the map, reduce
+// and rolling prompts get the same details plus what they summarize.
+type promptData struct {
+	Title     string
+	Date      string // the session's start, "2006-01-02"
+	Time      string // "15:04"
+	Duration  string // recorded audio, not counting pauses, e.g. "1h5m"; "" if unknown
+	Minutes   int
+	AudioMode string
+	Language  string // the transcription backend's, "" if auto-detected
+	Chunks    int
+
+	// From the note's frontmatter: attendees and purpose, as a note-taking
+	// template would fill them in, and every field as parsed.
+	Attendees   []string
+	Purpose     string
+	Frontmatter map[string]any
+
+	Transcription string
+	Notes         string
+
+	Summary   string // rolling: the summary so far
+	Summaries string // reduce: the partial summaries, numbered
+	Part      int    // map: which part this is, of Parts
+	Parts     int
+
+	Steps map[string]string // pipeline: the earlier steps' outputs this step reads, by name
+
+	chunkLines []int // lines of the cleaned-up transcript each chunk takes (see withChunks)
+}
+
+// newPromptData fills in a session's details from its index entry and the
+// config. Anything that can't be found is left empty: prompt details are
+// never worth failing a summary over.
+func newPromptData(cfg *config.Config, title string) promptData {
+	data := promptData{
+		Title:    title,
+		Language: transcriptionLanguage(cfg.Transcription),
+	}
+
+	startedAt, err := time.ParseInLocation("2006-01-02 1504", title, time.Local)
+	if entries, _ := ReadIndex(cfg); entries != nil {
+		for _, e := range entries {
+			if e.Title != title {
+				continue
+			}
+			if !e.StartedAt.IsZero() {
+				startedAt, err = e.StartedAt.Local(), nil
+			}
+			if e.DurationSeconds > 0 {
+				d := time.Duration(e.DurationSeconds * float64(time.Second)).Round(time.Minute)
+				data.Duration = strings.TrimSuffix(d.String(), "0s")
+				data.Minutes = int(d.Minutes())
+			}
+			data.AudioMode = e.AudioMode
+			data.Chunks = len(e.TranscribedBy)
+		}
+	}
+	if err == nil {
+		data.Date, data.Time = startedAt.Format("2006-01-02"), startedAt.Format("15:04")
+	}
+	return data
+}
+
+// withChunks adds how many lines of the session's transcript each of its
+// chunks takes, from its .sources/<title>.chunks and raw, its
+// .sources/<title>.txt, so a transcript too long for one prompt is split
+// between chunks (see splitTranscript). Without them, it's split between
+// lines.
+func (d promptData) withChunks(cfg *config.Config, raw []byte) promptData {
+	chunkLines, err := readChunkLines(cfg, d.Title)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trani: %v\n", err)
+		errlog.Error("chunk_lines", d.Title, err)
+	}
+	d.chunkLines = cleanChunkLines(string(raw), chunkLines)
+	return d
+}
+
+// withNote adds a note's notes and frontmatter fields.
+func (d promptData) withNote(notes string) promptData {
+	d.Notes = notes
+	frontmatter, ok := extractFrontmatter(notes)
+	if !ok {
+		return d
+	}
+	if err := yaml.Unmarshal([]byte(frontmatter), &d.Frontmatter); err != nil {
+		return d
+	}
+
+	switch attendees := d.Frontmatter["attendees"].(type) {
+	case string:
+		for _, a := range strings.Split(attendees, ",") {
+			if a = strings.TrimSpace(a); a != "" {
+				d.Attendees = append(d.Attendees, a)
+			}
+		}
+	case []any:
+		for _, a := range attendees {
+			if s, ok := a.(string); ok && strings.TrimSpace(s) != "" {
+				d.Attendees = append(d.Attendees, strings.TrimSpace(s))
+			}
+		}
+	}
+	if purpose, ok := d.Frontmatter["purpose"].(string); ok {
+		d.Purpose = strings.TrimSpace(purpose)
+	}
+	return d
+}
+
+// transcriptionLanguage is the language the configured transcription
+// backend is set to.
+func transcriptionLanguage(cfg config.TranscriptionConfig) string {
+	switch cfg.Backend {
+	case "local":
+		return cfg.Local.Language
+	case "openai":
+		return cfg.OpenAI.Language
+	case "openai_compatible":
+		return cfg.OpenAICompatible.Language
+	case "whisper_server":
+		return cfg.WhisperServer.Language
+	}
+	return ""
+}
+
+// legacyPlaceholder matches the placeholders templates used before they
+// were rendered with text/template, which still work.
+var legacyPlaceholder = regexp.MustCompile(`\{\{\s*(TRANSCRIPTION|NOTES|SUMMARY|SUMMARIES|PART|PARTS)\s*\}\}`)
+
+var legacyFields = map[string]string{
+	"TRANSCRIPTION": "Transcription",
+	"NOTES":         "Notes",
+	"SUMMARY":       "Summary",
+	"SUMMARIES":     "Summaries",
+	"PART":          "Part",
+	"PARTS":         "Parts",
+}
+
+// templateAction matches the start of a text/template action: a field,
+// such as {{.Title}}, or a keyword, such as {{if or {{range.
+var templateAction = regexp.MustCompile(`\{\{-?\s*(\.|(if|else|end|range|with|template|block|define)\b)`)
+
+// renderPrompt renders a prompt template with data. A template without
+// any text/template action, written before prompts were rendered with
+// text/template, only has its placeholders filled in, as it did then, so
+// any other "{{" in it stays as written.
+func renderPrompt(text string, data promptData) (string, error) {
+	if !templateAction.MatchString(text) {
+		fields := reflect.ValueOf(data)
+		return legacyPlaceholder.ReplaceAllStringFunc(text, func(m string) string {
+			return fmt.Sprint(fields.FieldByName(legacyFields[legacyPlaceholder.FindStringSubmatch(m)[1]]).Interface())
+		}), nil
+	}
+
+	text = legacyPlaceholder.ReplaceAllStringFunc(text, func(m string) string {
+		return "{{." + legacyFields[legacyPlaceholder.FindStringSubmatch(m)[1]] + "}}"
+	})
+
+	tmpl, err := template.New("prompt").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("invalid prompt template: %w", err)
+	}
+	var out strings.Builder
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("failed to render prompt template: %w", err)
+	}
+	return out.String(), nil
+}
+
+// promptSettings are what a prompt file's YAML header can set for the
+// requests built from it, overriding the llm config for them alone:
+//
+//	---
+//	backend: claude
+//	model: claude-opus-4-5
+//	max_tokens: 16000
+//	temperature: 0.2
+//	system: Eres el secretario del consejo de administración.
+//	---
+//	{{.Transcription}}
+//
+// A model only applies to backend (or llm.backend, without one), not to
+// its fallbacks. The system prompt is rendered like the template.
+type promptSettings struct {
+	Backend     string   `yaml:"backend"`
+	Model       string   `yaml:"model"`
+	MaxTokens   int      `yaml:"max_tokens"`
+	Temperature *float64 `yaml:"temperature"`
+	System      string   `yaml:"system"`
+}
+
+// promptFile is a prompt template and the settings in its header, if any.
+type promptFile struct {
+	template string
+	settings promptSettings
+}
+
+// parsePromptFile splits a prompt file into its header's settings and the
+// template after it. A file without a header is all template. Unknown
+// header fields are an error, so a typo doesn't go unnoticed.
+func parsePromptFile(content string) (promptFile, error) {
+	header, body, ok := splitFrontmatter(content)
+	if !ok {
+		return promptFile{template: content}, nil
+	}
+
+	var settings promptSettings
+	decoder := yaml.NewDecoder(bytes.NewReader([]byte(header)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&settings); err != nil && err != io.EOF {
+		return promptFile{}, fmt.Errorf("invalid prompt header: %w", err)
+	}
+	if settings.MaxTokens < 0 {
+		return promptFile{}, fmt.Errorf("invalid prompt header: max_tokens must be positive")
+	}
+	return promptFile{template: body, settings: settings}, nil
+}
+
+// render renders the file's template and system prompt with data into a
+// request with the header's settings.
+func (p promptFile) render(data promptData) (llm.Request, error) {
+	prompt, err := renderPrompt(p.template, data)
+	if err != nil {
+		return llm.Request{}, err
+	}
+	system, err := renderPrompt(p.settings.System, data)
+	if err != nil {
+		return llm.Request{}, fmt.Errorf("system prompt: %w", err)
+	}
+	return llm.Request{
+		System: strings.TrimSpace(system),
+		Prompt: prompt,
+		Options: llm.Options{
+			Model:       p.settings.Model,
+			MaxTokens:   p.settings.MaxTokens,
+			Temperature: p.settings.Temperature,
+		},
+	}, nil
+}
+
+// requestTokens estimates how many tokens req takes in a prompt.
+func requestTokens(req llm.Request) int {
+	return estimateTokens(req.System) + estimateTokens(req.Prompt)
+}
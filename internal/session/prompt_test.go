@@ -0,0 +1,202 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+)
+
+func TestRenderPromptLegacyPlaceholders(t *testing.T) {
+	data := promptData{Transcription: "dijo {{.Notes}} tal cual", Notes: "mis notas"}
+	prompt, err := renderPrompt("T: {{TRANSCRIPTION}}\nN: {{ NOTES }}", data)
+	if err != nil {
+		t.Fatalf("renderPrompt failed: %v", err)
+	}
+	// Values are inserted as is, never rendered themselves.
+	if expected := "T: dijo {{.Notes}} tal cual\nN: mis notas"; prompt != expected {
+		t.Errorf("expected %q, got %q", expected, prompt)
+	}
+}
+
+func TestRenderPromptLegacyKeepsOtherBraces(t *testing.T) {
+	data := promptData{Transcription: "hola", Part: 2, Parts: 3}
+	prompt, err := renderPrompt("Parte {{PART}}/{{PARTS}}. Devuelve JSON como {{\"a\": 1}}:\n{{TRANSCRIPTION}}", data)
+	if err != nil {
+		t.Fatalf("renderPrompt failed: %v", err)
+	}
+	if expected := "Parte 2/3. Devuelve JSON como {{\"a\": 1}}:\nhola"; prompt != expected {
+		t.Errorf("expected %q, got %q", expected, prompt)
+	}
+}
+
+func TestRenderDefaultPrompts(t *testing.T) {
+	data := promptData{Transcription: "TEXTO", Notes: "NOTAS", Summary: "RESUMEN", Summaries: "PARCIALES", Part: 1, Parts: 2}
+	for name, template := range map[string]string{
+		"with notes":        defaultPromptWithNotes,
+		"no notes":          defaultPromptNoNotes,
+		"map":               defaultMapPrompt,
+		"reduce with notes": defaultReducePromptWithNotes,
+		"reduce no notes":   defaultReducePromptNoNotes,
+		"rolling":           defaultRollingPrompt,
+		"action items":      defaultActionItemsPrompt,
+		"title":             defaultTitlePrompt,
+	} {
+		prompt, err := renderPrompt(template, data)
+		if err != nil {
+			t.Errorf("%s: renderPrompt failed: %v", name, err)
+			continue
+		}
+		if strings.Contains(prompt, "{{") {
+			t.Errorf("%s: placeholder left unrendered in %q", name, prompt)
+		}
+	}
+}
+
+func TestRenderPromptConditionals(t *testing.T) {
+	template := `{{.Title}}{{with .Purpose}} ({{.}}){{end}}
+{{if .Notes}}NOTAS: {{.Notes}}{{else}}Sin notas.{{end}}
+{{range $i, $a := .Attendees}}{{if $i}}, {{end}}{{$a}}{{end}}`
+
+	data := promptData{Title: "Sync"}
+	prompt, err := renderPrompt(template, data)
+	if err != nil {
+		t.Fatalf("renderPrompt failed: %v", err)
+	}
+	if expected := "Sync\nSin notas.\n"; prompt != expected {
+		t.Errorf("without notes: expected %q, got %q", expected, prompt)
+	}
+
+	data = data.withNote("---\nattendees: [Ana, Luis]\npurpose: planificación\n---\nrevisar fechas")
+	prompt, err = renderPrompt(template, data)
+	if err != nil {
+		t.Fatalf("renderPrompt failed: %v", err)
+	}
+	if expected := "Sync (planificación)\nNOTAS: " + data.Notes + "\nAna, Luis"; prompt != expected {
+		t.Errorf("with notes: expected %q, got %q", expected, prompt)
+	}
+}
+
+func TestRenderPromptInvalidTemplate(t *testing.T) {
+	if _, err := renderPrompt("{{if .Notes}}sin cerrar", promptData{}); err == nil {
+		t.Error("expected an unclosed action to fail")
+	}
+	if _, err := renderPrompt("{{.Speakers}}", promptData{}); err == nil {
+		t.Error("expected an unknown field to fail")
+	}
+}
+
+func TestNewPromptDataFromIndex(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Transcription.Backend = "openai"
+	cfg.Transcription.OpenAI.Language = "es"
+
+	entry := newIndexEntry(cfg, "2026-01-15 1430", "", SourceSession, "default", time.Date(2026, 1, 15, 14, 30, 0, 0, time.Local))
+	entry.DurationSeconds = 3930
+	entry.AudioMode = "mic_system"
+	entry.TranscribedBy = []string{"openai", "openai", "openai"}
+	if err := recordIndex(cfg, entry); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+
+	data := newPromptData(cfg, "2026-01-15 1430")
+	if data.Date != "2026-01-15" || data.Time != "14:30" || data.Duration != "1h6m" || data.Minutes != 66 ||
+		data.AudioMode != "mic_system" || data.Chunks != 3 || data.Language != "es" {
+		t.Errorf("unexpected prompt data: %+v", data)
+	}
+
+	// A session the index doesn't know still gets its date from its title.
+	if data := newPromptData(cfg, "2026-02-01 0900"); data.Date != "2026-02-01" || data.Duration != "" {
+		t.Errorf("expected the date from the title alone, got %+v", data)
+	}
+}
+
+func TestSingleTemplateStandsInForNoNotesVariant(t *testing.T) {
+	promptsDir := t.TempDir()
+	if err := ensureDefaultPrompts(promptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(promptsDir, "1a1.txt"), []byte("{{if .Notes}}con{{else}}sin{{end}}"), 0644); err != nil {
+		t.Fatalf("failed to write template: %v", err)
+	}
+
+	prompt, err := loadPromptTemplateStandalone(promptsDir, "1a1", false)
+	if err != nil {
+		t.Fatalf("loadPromptTemplateStandalone failed: %v", err)
+	}
+	if prompt.template != "{{if .Notes}}con{{else}}sin{{end}}" {
+		t.Errorf("expected 1a1.txt without notes, got %q", prompt.template)
+	}
+
+	// A template with neither file still falls back to the default pair.
+	prompt, err = loadPromptTemplateStandalone(promptsDir, "missing", false)
+	if err != nil || prompt.template != defaultPromptNoNotes {
+		t.Errorf("expected default_no_notes.txt, got %q (%v)", prompt.template, err)
+	}
+}
+
+func TestParsePromptFileHeader(t *testing.T) {
+	prompt, err := parsePromptFile("---\nbackend: ollama\nmodel: llama3.1:70b\nmax_tokens: 800\ntemperature: 0.2\nsystem: Eres {{.Title}}.\n---\n{{.Transcription}}\n")
+	if err != nil {
+		t.Fatalf("parsePromptFile failed: %v", err)
+	}
+	if prompt.template != "{{.Transcription}}\n" {
+		t.Errorf("expected the template after the header, got %q", prompt.template)
+	}
+	if s := prompt.settings; s.Backend != "ollama" || s.Model != "llama3.1:70b" || s.MaxTokens != 800 || s.Temperature == nil || *s.Temperature != 0.2 {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+
+	req, err := prompt.render(promptData{Title: "Sync", Transcription: "hola"})
+	if err != nil {
+		t.Fatalf("render failed: %v", err)
+	}
+	if req.System != "Eres Sync." || req.Prompt != "hola\n" || req.Options.Model != "llama3.1:70b" || req.Options.MaxTokens != 800 {
+		t.Errorf("unexpected request: %+v", req)
+	}
+
+	// Without a header, the whole file is the template.
+	if prompt, err := parsePromptFile("{{.Transcription}}"); err != nil || prompt.template != "{{.Transcription}}" || prompt.settings != (promptSettings{}) {
+		t.Errorf("expected a plain template, got %+v (%v)", prompt, err)
+	}
+}
+
+func TestParsePromptFileInvalidHeader(t *testing.T) {
+	for _, content := range []string{
+		"---\ntemprature: 0.2\n---\n{{.Transcription}}",
+		"---\nmax_tokens: -1\n---\n{{.Transcription}}",
+		"---\nmax_tokens: muchos\n---\n{{.Transcription}}",
+	} {
+		if _, err := parsePromptFile(content); err == nil {
+			t.Errorf("expected an error for %q", content)
+		}
+	}
+}
+
+func TestPromptHeaderBackendOverride(t *testing.T) {
+	configured, other := &recordingGenerator{}, &recordingGenerator{}
+	llms := newLLMClients(config.LLMConfig{Backend: "claude"}, configured)
+	llms.clients["ollama"] = other
+
+	prompts := mapReducePrompts{
+		mapPrompt:    promptFile{template: "MAP {{.Transcription}}", settings: promptSettings{Backend: "ollama", Model: "llama3.1"}},
+		reducePrompt: promptFile{template: "REDUCE {{.Summaries}}", settings: promptSettings{System: "Sé breve."}},
+	}
+	if _, err := summarizeInParts(context.Background(), llms, prompts, "", "hola", promptData{}, 100); err != nil {
+		t.Fatalf("summarizeInParts failed: %v", err)
+	}
+
+	if len(other.requests) != 1 || other.requests[0].Options.Model != "llama3.1" {
+		t.Errorf("expected the map prompt on ollama with its model, got %+v", other.requests)
+	}
+	if len(configured.requests) != 1 || configured.requests[0].System != "Sé breve." {
+		t.Errorf("expected the reduce prompt on the configured backend with its system prompt, got %+v", configured.requests)
+	}
+	if used := llms.usedBackends(); used != "ollama+claude" {
+		t.Errorf("expected both backends recorded, got %q", used)
+	}
+}
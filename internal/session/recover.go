@@ -0,0 +1,380 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+// orphanedCaptureTimeout is how long to wait for ffmpeg captures left
+// behind by a dead recording process to finalize their open chunk.
+const orphanedCaptureTimeout = 5 * time.Second
+
+// orphanGracePeriod is how long chunks without a lock must have gone
+// untouched before StashOrphanedChunks takes them for a dead session's.
+const orphanGracePeriod = 2 * time.Minute
+
+// chunkFilePattern matches the chunk files the recorder writes (see
+// audio.runChunkPattern), but not the temporary files derived from them
+// while processing (.vad.wav, .combined.wav, .tmp.wav).
+var chunkFilePattern = regexp.MustCompile(`^chunk-(mic|system)-(run\d{3}-)?\d{3}\.wav$`)
+
+// Recoverable is a session whose recording process died before finishing
+// it. Its lock, segment lists and unprocessed chunks were moved out of
+// TempDir into Dir, so a new session can't overwrite them.
+type Recoverable struct {
+	Lock RecordingLock
+	Dir  string
+}
+
+func recoveryDir(cfg *config.Config) string {
+	return filepath.Join(cfg.Paths.TempDir, "recovery")
+}
+
+// ListRecoverable returns the sessions stashed for `trani recover`, oldest
+// first. A stale recording lock that hasn't been stashed yet isn't one of
+// them (see StaleLock), and neither is a stash still being written.
+func ListRecoverable(cfg *config.Config) ([]Recoverable, error) {
+	entries, err := os.ReadDir(recoveryDir(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read recovery directory: %w", err)
+	}
+
+	var out []Recoverable
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		dir := filepath.Join(recoveryDir(cfg), entry.Name())
+
+		data, err := os.ReadFile(filepath.Join(dir, "lock.json"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read stashed lock for %s: %w", entry.Name(), err)
+		}
+		var lock RecordingLock
+		if err := json.Unmarshal(data, &lock); err != nil {
+			return nil, fmt.Errorf("failed to parse stashed lock for %s: %w", entry.Name(), err)
+		}
+
+		out = append(out, Recoverable{Lock: lock, Dir: dir})
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].Lock.StartedAt.Before(out[j].Lock.StartedAt) })
+	return out, nil
+}
+
+// StashStaleSession stashes the session of a recording lock whose process
+// is no longer alive, if there is one, and removes the lock. Only starting
+// a session and `trani recover` do this. Reports whether anything was
+// stashed: not if another trani is already stashing the same session.
+func StashStaleSession(cfg *config.Config) (bool, error) {
+	lock, err := StaleLock(cfg)
+	if err != nil || lock == nil {
+		return false, err
+	}
+	stashed, err := stashSession(cfg, lock)
+	if err != nil || !stashed {
+		return false, err
+	}
+	return true, ClearLock(cfg)
+}
+
+// StashOrphanedChunks stashes chunks left in TempDir without any recording
+// lock, such as those of a session whose stale lock an older trani simply
+// deleted. With no lock to say which session they belong to, the title is
+// taken from when the oldest of them started recording, so they may end up
+// in a note of their own. Only meant for `trani recover`. A session that
+// was just stopped still has chunks but no lock while its recording worker
+// transcribes the last one, so nothing is stashed while a recording or
+// postprocess worker is running, or while any chunk was written less than
+// orphanGracePeriod ago. Reports whether anything was stashed.
+func StashOrphanedChunks(cfg *config.Config) (bool, error) {
+	lock, err := readLock(cfg)
+	if err != nil || lock != nil {
+		return false, err
+	}
+	if jobs, err := readJobStatuses(cfg); err != nil || len(jobs) > 0 {
+		return false, err
+	}
+
+	chunks, err := chunkFiles(cfg.Paths.TempDir)
+	if err != nil || len(chunks) == 0 {
+		return false, err
+	}
+
+	var startedAt time.Time
+	for _, chunk := range chunks {
+		info, err := os.Stat(chunk)
+		if err != nil {
+			continue
+		}
+		if time.Since(info.ModTime()) < orphanGracePeriod {
+			return false, nil
+		}
+		d, _ := wav.FileDuration(chunk)
+		if started := info.ModTime().Add(-d); startedAt.IsZero() || started.Before(startedAt) {
+			startedAt = started
+		}
+	}
+
+	title := startedAt.Format("2006-01-02 1504")
+	orphan := &RecordingLock{
+		Title:          title,
+		Path:           filepath.Join(cfg.Paths.SessionsDir, title+".md"),
+		StartedAt:      startedAt,
+		PromptTemplate: "default",
+	}
+	return stashSession(cfg, orphan)
+}
+
+// stashSession moves a dead recording process's lock, segment lists and
+// chunk files into recovery/<title>/. Its ffmpeg captures are stopped
+// first, if they survived it, so the chunk they had open is finalized and
+// listed like any other. A chunk that was still open and holds no readable
+// audio is dropped; one that can is added to its run's segment list, since
+// ffmpeg only lists chunks once it closes them. The recovery directory is
+// created exclusively, so of two tranis stashing the same session, only
+// the first one does, and the other reports nothing stashed. The lock is
+// written last, so a stash in progress isn't listed as recoverable.
+func stashSession(cfg *config.Config, lock *RecordingLock) (bool, error) {
+	if err := os.MkdirAll(recoveryDir(cfg), 0755); err != nil {
+		return false, fmt.Errorf("failed to create recovery directory: %w", err)
+	}
+	dir := filepath.Join(recoveryDir(cfg), lock.Title)
+	if err := os.Mkdir(dir, 0755); err != nil {
+		if os.IsExist(err) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create recovery directory: %w", err)
+	}
+
+	stopOrphanedCaptures(lock.RecorderPIDs)
+
+	tempDir := cfg.Paths.TempDir
+	recorder := audio.New(config.AudioConfig{}, tempDir)
+	for stream, lists := range map[string][]string{
+		"mic":    recorder.MicSegmentLists(),
+		"system": recorder.SystemSegmentLists(),
+	} {
+		if err := stashStream(tempDir, dir, stream, lists); err != nil {
+			return false, err
+		}
+	}
+
+	// Whatever is left (temporary files derived from a chunk mid-process)
+	// can be regenerated from the chunk itself.
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, "chunk-*"))
+	for _, path := range leftovers {
+		os.Remove(path)
+	}
+
+	data, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal recording lock: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "lock.json"), data, 0644); err != nil {
+		return false, fmt.Errorf("failed to stash recording lock: %w", err)
+	}
+
+	logIndex(updateIndex(cfg, lock.Title, func(e *IndexEntry) {
+		if e.NotePath == "" {
+			e.NotePath = lock.Path
+			e.Source = SourceSession
+			e.StartedAt = lock.StartedAt
+			e.PromptTemplate = lock.PromptTemplate
+		}
+		e.Status = IndexRecovering
+	}))
+
+	return true, nil
+}
+
+// stashStream moves one stream's segment lists and chunks from tempDir to
+// dir, rewriting each list with bare file names so it resolves against its
+// new location (see readSegmentList).
+func stashStream(tempDir, dir, stream string, lists []string) error {
+	type segmentList struct {
+		path  string
+		names []string
+	}
+
+	var stashed []segmentList
+	listed := map[string]bool{}
+	for _, list := range lists {
+		if _, err := os.Stat(list); os.IsNotExist(err) {
+			continue
+		}
+		segments, err := readSegmentList(list)
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(segments))
+		for _, segment := range segments {
+			names = append(names, filepath.Base(segment))
+			listed[filepath.Base(segment)] = true
+		}
+		stashed = append(stashed, segmentList{path: list, names: names})
+	}
+
+	chunks, err := chunkFiles(tempDir)
+	if err != nil {
+		return err
+	}
+
+	var unlisted []string
+	for _, chunk := range chunks {
+		name := filepath.Base(chunk)
+		if !strings.HasPrefix(name, "chunk-"+stream+"-") {
+			continue
+		}
+		if !listed[name] {
+			if d, err := wav.FileDuration(chunk); err != nil || d == 0 {
+				os.Remove(chunk)
+				continue
+			}
+			unlisted = append(unlisted, name)
+		}
+		if err := os.Rename(chunk, filepath.Join(dir, name)); err != nil {
+			return fmt.Errorf("failed to stash %s: %w", name, err)
+		}
+	}
+
+	// Chunks still open when capture died can only belong to the last run.
+	if len(unlisted) > 0 {
+		if len(stashed) == 0 {
+			stashed = append(stashed, segmentList{path: lists[0]})
+		}
+		last := &stashed[len(stashed)-1]
+		last.names = append(last.names, unlisted...)
+	}
+
+	for _, list := range stashed {
+		content := strings.Join(list.names, "\n") + "\n"
+		if err := os.WriteFile(filepath.Join(dir, filepath.Base(list.path)), []byte(content), 0644); err != nil {
+			return fmt.Errorf("failed to stash segment list: %w", err)
+		}
+		os.Remove(list.path)
+	}
+
+	return nil
+}
+
+// chunkFiles returns the recorder's chunk files in dir, in recording order.
+func chunkFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
+	}
+
+	var out []string
+	for _, entry := range entries {
+		if chunkFilePattern.MatchString(entry.Name()) {
+			out = append(out, filepath.Join(dir, entry.Name()))
+		}
+	}
+	return out, nil
+}
+
+// stopOrphanedCaptures asks ffmpeg captures that outlived their recording
+// process to finish, and waits briefly for them to do so. PIDs that are no
+// longer ffmpeg (the process exited and the PID was reused) are left alone.
+func stopOrphanedCaptures(pids []int) {
+	var stopping []int
+	for _, pid := range pids {
+		if !isProcessAlive(pid) || processName(pid) != "ffmpeg" {
+			continue
+		}
+		if err := syscall.Kill(pid, syscall.SIGTERM); err == nil {
+			stopping = append(stopping, pid)
+		}
+	}
+
+	deadline := time.Now().Add(orphanedCaptureTimeout)
+	for _, pid := range stopping {
+		for isProcessAlive(pid) && time.Now().Before(deadline) {
+			time.Sleep(100 * time.Millisecond)
+		}
+	}
+}
+
+func processName(pid int) string {
+	comm, err := os.ReadFile(fmt.Sprintf("/proc/%d/comm", pid))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// Recover transcribes a stashed session's unprocessed chunks into its
+// .sources/ files, exactly as the chunker would have while it was live,
+// then hands the session to the postprocess worker for its summary. The
+// stash is only removed once every chunk made it through or into the retry
+// queue; on error it's kept so recovery can be retried.
+func Recover(ctx context.Context, rec Recoverable, cfg *config.Config) error {
+	transcriber, err := transcribe.New(cfg.Transcription)
+	if err != nil {
+		return fmt.Errorf("failed to initialize transcriber: %w", err)
+	}
+	defer transcribe.Close(transcriber)
+
+	if err := recoverChunks(ctx, rec, cfg, transcriber); err != nil {
+		return err
+	}
+
+	if err := SpawnPostprocess(rec.Lock.Path, rec.Lock.Title, rec.Lock.PromptTemplate, ""); err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(rec.Dir); err != nil {
+		return fmt.Errorf("failed to remove recovery directory: %w", err)
+	}
+	return nil
+}
+
+func recoverChunks(ctx context.Context, rec Recoverable, cfg *config.Config, transcriber transcribe.Transcriber) error {
+	// The capture mode is whatever the session was recorded with, not
+	// whatever the config says now.
+	audioCfg := cfg.Audio
+	audioCfg.Mode = config.AudioModeMic
+	probe := audio.New(audioCfg, rec.Dir)
+	if systemSegments, _ := readSegmentLists(probe.SystemSegmentLists()); len(systemSegments) > 0 {
+		audioCfg.Mode = config.AudioModeMicSystem
+	}
+	recorder := audio.New(audioCfg, rec.Dir)
+
+	c, err := newChunker(cfg, rec.Lock.Title, rec.Lock.Path, recorder, transcriber)
+	if err != nil {
+		return err
+	}
+	if err := c.skipProcessed(); err != nil {
+		return err
+	}
+
+	if err := c.pollOnce(ctx); err != nil {
+		return err
+	}
+	c.abandonQueued()
+	return nil
+}
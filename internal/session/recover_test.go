@@ -0,0 +1,302 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio"
+)
+
+func TestStashStaleSession(t *testing.T) {
+	cfg := testConfig(t)
+	tempDir := cfg.Paths.TempDir
+	recorder := audio.New(cfg.Audio, tempDir)
+
+	// PID 0 is never a real process, so isProcessAlive treats it as dead.
+	stale := &RecordingLock{PID: 0, Title: "2026-01-15 1430", Path: "/vault/sessions/2026-01-15 1430.md"}
+	if err := stale.Acquire(cfg); err != nil {
+		t.Fatalf("failed to seed a stale lock: %v", err)
+	}
+
+	// Chunk 000 was already processed (and deleted), 001 was closed but not
+	// processed, 002 was still open when capture died, so it's unlisted.
+	appendSegmentListLine(t, recorder.MicSegmentList(), filepath.Join(tempDir, "chunk-mic-000.wav"))
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-001.wav"))
+	appendSegmentListLine(t, recorder.MicSegmentList(), filepath.Join(tempDir, "chunk-mic-001.wav"))
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-002.wav"))
+	os.WriteFile(filepath.Join(tempDir, "chunk-mic-001.wav.vad.wav"), nil, 0644)
+
+	lock, err := ReadLock(cfg)
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	if lock != nil {
+		t.Fatalf("expected a stale lock to read as no lock, got %+v", lock)
+	}
+	if stale, err := StaleLock(cfg); err != nil || stale == nil || stale.Title != "2026-01-15 1430" {
+		t.Fatalf("expected the stale lock to be reported, got %+v (%v)", stale, err)
+	}
+	if _, err := os.Stat(filepath.Join(tempDir, "chunk-mic-001.wav")); err != nil {
+		t.Fatalf("expected reading the lock to leave its chunks alone: %v", err)
+	}
+
+	if stashed, err := StashStaleSession(cfg); err != nil || !stashed {
+		t.Fatalf("expected the stale session to be stashed, got %v (%v)", stashed, err)
+	}
+	recoverable, err := ListRecoverable(cfg)
+	if err != nil {
+		t.Fatalf("ListRecoverable failed: %v", err)
+	}
+	if len(recoverable) != 1 || recoverable[0].Lock.Title != stale.Title || recoverable[0].Lock.Path != stale.Path {
+		t.Fatalf("expected the stale session to be recoverable, got %+v", recoverable)
+	}
+
+	stashedList, err := readSegmentList(filepath.Join(recoverable[0].Dir, "chunk-mic-segments.txt"))
+	if err != nil {
+		t.Fatalf("failed to read stashed segment list: %v", err)
+	}
+	want := []string{"chunk-mic-000.wav", "chunk-mic-001.wav", "chunk-mic-002.wav"}
+	if len(stashedList) != len(want) {
+		t.Fatalf("expected stashed list %v, got %v", want, stashedList)
+	}
+	for i, name := range want {
+		if stashedList[i] != filepath.Join(recoverable[0].Dir, name) {
+			t.Errorf("entry %d: expected %s in the recovery directory, got %s", i, name, stashedList[i])
+		}
+	}
+
+	leftovers, _ := filepath.Glob(filepath.Join(tempDir, "chunk-*"))
+	if len(leftovers) != 0 {
+		t.Errorf("expected TempDir to be clear of chunks, got %v", leftovers)
+	}
+	if _, err := os.Stat(lockPath(cfg)); !os.IsNotExist(err) {
+		t.Error("expected the stale lock to be removed")
+	}
+}
+
+func TestStashDropsUnreadableOpenChunk(t *testing.T) {
+	cfg := testConfig(t)
+	tempDir := cfg.Paths.TempDir
+
+	stale := &RecordingLock{PID: 0, Title: "2026-01-15 1430"}
+	if err := stale.Acquire(cfg); err != nil {
+		t.Fatalf("failed to seed a stale lock: %v", err)
+	}
+	// Capture died before ffmpeg even wrote a full header.
+	os.WriteFile(filepath.Join(tempDir, "chunk-mic-000.wav"), []byte("RIFF"), 0644)
+
+	if _, err := StashStaleSession(cfg); err != nil {
+		t.Fatalf("StashStaleSession failed: %v", err)
+	}
+	recoverable, err := ListRecoverable(cfg)
+	if err != nil {
+		t.Fatalf("ListRecoverable failed: %v", err)
+	}
+	if len(recoverable) != 1 {
+		t.Fatalf("expected the session to be recoverable for its summary, got %+v", recoverable)
+	}
+	if _, err := os.Stat(filepath.Join(recoverable[0].Dir, "chunk-mic-000.wav")); !os.IsNotExist(err) {
+		t.Error("expected the unreadable chunk to be dropped")
+	}
+}
+
+func TestRecoverChunksPicksUpWhereTheSessionLeftOff(t *testing.T) {
+	cfg := testConfig(t)
+	tempDir := cfg.Paths.TempDir
+	recorder := audio.New(cfg.Audio, tempDir)
+
+	stale := &RecordingLock{PID: 0, Title: "2026-01-15 1430"}
+	if err := stale.Acquire(cfg); err != nil {
+		t.Fatalf("failed to seed a stale lock: %v", err)
+	}
+	appendSegmentListLine(t, recorder.MicSegmentList(), "chunk-mic-000.wav")
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-001.wav"))
+	appendSegmentListLine(t, recorder.MicSegmentList(), "chunk-mic-001.wav")
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-002.wav"))
+
+	if _, err := StashStaleSession(cfg); err != nil {
+		t.Fatalf("StashStaleSession failed: %v", err)
+	}
+	recoverable, err := ListRecoverable(cfg)
+	if err != nil || len(recoverable) != 1 {
+		t.Fatalf("expected one recoverable session, got %+v (%v)", recoverable, err)
+	}
+
+	transcriber := &stubTranscriber{texts: []string{"uno", "dos"}}
+	if err := recoverChunks(context.Background(), recoverable[0], cfg, transcriber); err != nil {
+		t.Fatalf("recoverChunks failed: %v", err)
+	}
+
+	if len(transcriber.calls) != 2 {
+		t.Fatalf("expected only the 2 unprocessed chunks to be transcribed, got %v", transcriber.calls)
+	}
+	text, err := os.ReadFile(filepath.Join(cfg.Paths.SessionsDir, ".sources", "2026-01-15 1430.txt"))
+	if err != nil {
+		t.Fatalf("failed to read transcript: %v", err)
+	}
+	if string(text) != "uno\ndos\n" {
+		t.Errorf("expected %q, got %q", "uno\ndos\n", string(text))
+	}
+}
+
+func TestRecoverChunksSkipsChunkWhoseTextIsIn(t *testing.T) {
+	cfg := testConfig(t)
+	tempDir := cfg.Paths.TempDir
+	recorder := audio.New(cfg.Audio, tempDir)
+	title := "2026-01-15 1430"
+
+	stale := &RecordingLock{PID: 0, Title: title}
+	if err := stale.Acquire(cfg); err != nil {
+		t.Fatalf("failed to seed a stale lock: %v", err)
+	}
+	// The process died after appending chunk 001's text but before
+	// deleting its file.
+	appendSegmentListLine(t, recorder.MicSegmentList(), "chunk-mic-000.wav")
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-001.wav"))
+	appendSegmentListLine(t, recorder.MicSegmentList(), "chunk-mic-001.wav")
+	writeTestChunk(t, filepath.Join(tempDir, "chunk-mic-002.wav"))
+
+	txtPath := filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".txt")
+	if err := os.MkdirAll(filepath.Dir(txtPath), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(txtPath, []byte("cero\nuno\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for index := 1; index <= 2; index++ {
+		if err := recordChunkLines(cfg, title, index, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := StashStaleSession(cfg); err != nil {
+		t.Fatalf("StashStaleSession failed: %v", err)
+	}
+	recoverable, err := ListRecoverable(cfg)
+	if err != nil || len(recoverable) != 1 {
+		t.Fatalf("expected one recoverable session, got %+v (%v)", recoverable, err)
+	}
+
+	transcriber := &stubTranscriber{texts: []string{"dos"}}
+	if err := recoverChunks(context.Background(), recoverable[0], cfg, transcriber); err != nil {
+		t.Fatalf("recoverChunks failed: %v", err)
+	}
+
+	if len(transcriber.calls) != 1 {
+		t.Fatalf("expected only chunk 002 to be transcribed, got %v", transcriber.calls)
+	}
+	text, err := os.ReadFile(txtPath)
+	if err != nil {
+		t.Fatalf("failed to read transcript: %v", err)
+	}
+	if string(text) != "cero\nuno\ndos\n" {
+		t.Errorf("expected %q, got %q", "cero\nuno\ndos\n", string(text))
+	}
+	if chunkLines, err := readChunkLines(cfg, title); err != nil || len(chunkLines) != 3 {
+		t.Errorf("expected 3 chunks recorded, got %v (%v)", chunkLines, err)
+	}
+}
+
+func TestStashStaleSessionOnlyOnce(t *testing.T) {
+	cfg := testConfig(t)
+	stale := &RecordingLock{PID: 0, Title: "2026-01-15 1430"}
+	if err := stale.Acquire(cfg); err != nil {
+		t.Fatalf("failed to seed a stale lock: %v", err)
+	}
+	chunk := filepath.Join(cfg.Paths.TempDir, "chunk-mic-000.wav")
+	writeTestChunk(t, chunk)
+
+	// Another trani got there first and is still moving chunks.
+	if err := os.MkdirAll(filepath.Join(recoveryDir(cfg), stale.Title), 0755); err != nil {
+		t.Fatalf("failed to create recovery directory: %v", err)
+	}
+
+	stashed, err := StashStaleSession(cfg)
+	if err != nil || stashed {
+		t.Fatalf("expected nothing to be stashed twice, got %v (%v)", stashed, err)
+	}
+	if _, err := os.Stat(chunk); err != nil {
+		t.Errorf("expected the chunk to be left to the other stash: %v", err)
+	}
+	if recoverable, _ := ListRecoverable(cfg); len(recoverable) != 0 {
+		t.Errorf("expected a stash in progress not to be listed, got %+v", recoverable)
+	}
+}
+
+// writeOldChunk writes a test chunk last modified past orphanGracePeriod.
+func writeOldChunk(t *testing.T, path string) {
+	t.Helper()
+	writeTestChunk(t, path)
+	old := time.Now().Add(-2 * orphanGracePeriod)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("failed to age chunk: %v", err)
+	}
+}
+
+func TestStashOrphanedChunksWithoutLock(t *testing.T) {
+	cfg := testConfig(t)
+	writeOldChunk(t, filepath.Join(cfg.Paths.TempDir, "chunk-mic-004.wav"))
+
+	stashed, err := StashOrphanedChunks(cfg)
+	if err != nil {
+		t.Fatalf("StashOrphanedChunks failed: %v", err)
+	}
+	if !stashed {
+		t.Fatal("expected the orphaned chunk to be stashed")
+	}
+
+	recoverable, err := ListRecoverable(cfg)
+	if err != nil || len(recoverable) != 1 {
+		t.Fatalf("expected one recoverable session, got %+v (%v)", recoverable, err)
+	}
+	if recoverable[0].Lock.PromptTemplate != "default" || filepath.Dir(recoverable[0].Lock.Path) != cfg.Paths.SessionsDir {
+		t.Errorf("unexpected synthesized lock: %+v", recoverable[0].Lock)
+	}
+}
+
+func TestStashOrphanedChunksLeavesLiveSessionAlone(t *testing.T) {
+	cfg := testConfig(t)
+	live := &RecordingLock{PID: os.Getpid(), Title: "live"}
+	if err := live.Acquire(cfg); err != nil {
+		t.Fatalf("failed to acquire lock: %v", err)
+	}
+	chunk := filepath.Join(cfg.Paths.TempDir, "chunk-mic-000.wav")
+	writeTestChunk(t, chunk)
+
+	stashed, err := StashOrphanedChunks(cfg)
+	if err != nil {
+		t.Fatalf("StashOrphanedChunks failed: %v", err)
+	}
+	if stashed {
+		t.Error("a live session's chunks must not be stashed")
+	}
+	if _, err := os.Stat(chunk); err != nil {
+		t.Errorf("expected the live chunk to be left in place: %v", err)
+	}
+}
+
+func TestStashOrphanedChunksWaitsForTheLastChunk(t *testing.T) {
+	cfg := testConfig(t)
+
+	// Just written: a session stopped moments ago, whose worker hasn't
+	// published its status yet.
+	fresh := filepath.Join(cfg.Paths.TempDir, "chunk-mic-000.wav")
+	writeTestChunk(t, fresh)
+	if stashed, err := StashOrphanedChunks(cfg); err != nil || stashed {
+		t.Fatalf("expected a recent chunk to be left alone, got %v (%v)", stashed, err)
+	}
+
+	// Older, but the recording worker is still transcribing it.
+	writeOldChunk(t, fresh)
+	publisher := newStatusPublisher(cfg, JobStatus{Kind: JobRecording, Stage: StageFinalChunk})
+	defer publisher.remove()
+	if stashed, err := StashOrphanedChunks(cfg); err != nil || stashed {
+		t.Fatalf("expected a running worker's chunk to be left alone, got %v (%v)", stashed, err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("expected the chunk to be left in place: %v", err)
+	}
+}
@@ -0,0 +1,206 @@
+package session
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// summaryPlacement is where writeSummary puts a new summary relative to the
+// ones already in the note.
+type summaryPlacement int
+
+const (
+	// placeOwn replaces the session's own summary if the note already has
+	// one (a retried or recovered run) and appends otherwise, so running a
+	// session's postprocessing again never duplicates its summary.
+	placeOwn summaryPlacement = iota
+	// placeNewVersion keeps earlier summaries and adds the new one right
+	// after the latest, so versions stay together whatever the user wrote
+	// below them.
+	placeNewVersion
+	// placeReplace replaces the latest summary where it is: a marked one,
+	// or failing that, a "## Resumen" section written before summaries
+	// were marked (see legacyResumenSection).
+	placeReplace
+)
+
+// Every generated summary is wrapped in these HTML comments, which
+// Obsidian doesn't render. The start marker carries the session the
+// summary belongs to and when it was generated, and for a pipeline step's
+// section (see pipeline.go), which step wrote it.
+const (
+	resumenStartMarker     = `<!-- trani:resumen:start session="%s" generated="%s" -->`
+	resumenStepStartMarker = `<!-- trani:resumen:start session="%s" step="%s" generated="%s" -->`
+	resumenEndMarker       = `<!-- trani:resumen:end -->`
+)
+
+var resumenStartPattern = regexp.MustCompile(`<!-- trani:resumen:start session="([^"]*)"(?: step="([^"]*)")? generated="([^"]*)" -->`)
+
+// resumenSection is a marked summary in a note. start and end are byte
+// offsets; end is just past the end marker and its newline, if any. step
+// is "" for the summary written without a pipeline.
+type resumenSection struct {
+	start, end int
+	session    string
+	step       string
+	generated  string
+}
+
+// formatResumenSection wraps resumen in markers, under a fixed "## Resumen"
+// heading.
+func formatResumenSection(sessionID string, generatedAt time.Time, resumen string) string {
+	return formatStepSection(sessionID, "", "Resumen", generatedAt, resumen)
+}
+
+// formatStepSection wraps a pipeline step's output in markers, under
+// heading.
+func formatStepSection(sessionID, step, heading string, generatedAt time.Time, text string) string {
+	marker := fmt.Sprintf(resumenStartMarker, sessionID, generatedAt.Format(time.RFC3339))
+	if step != "" {
+		marker = fmt.Sprintf(resumenStepStartMarker, sessionID, step, generatedAt.Format(time.RFC3339))
+	}
+	return marker + "\n" +
+		"## " + heading + "\n\n" +
+		strings.TrimRight(text, "\n") + "\n" +
+		resumenEndMarker + "\n"
+}
+
+// findResumenSections returns the note's marked summaries in order. A start
+// marker without an end marker after it (mangled by hand) isn't a section,
+// so nothing around it is ever touched.
+func findResumenSections(content string) []resumenSection {
+	var out []resumenSection
+	for _, m := range resumenStartPattern.FindAllStringSubmatchIndex(content, -1) {
+		if n := len(out); n > 0 && m[0] < out[n-1].end {
+			continue
+		}
+
+		rel := strings.Index(content[m[1]:], resumenEndMarker)
+		if rel < 0 {
+			continue
+		}
+		end := m[1] + rel + len(resumenEndMarker)
+		if end < len(content) && content[end] == '\n' {
+			end++
+		}
+
+		out = append(out, resumenSection{
+			start:     m[0],
+			end:       end,
+			session:   content[m[2]:m[3]],
+			generated: content[m[6]:m[7]],
+		})
+		if m[4] >= 0 {
+			out[len(out)-1].step = content[m[4]:m[5]]
+		}
+	}
+	return out
+}
+
+// stripResumenSections removes every marked summary from content, leaving
+// what the user and any template wrote.
+func stripResumenSections(content string) string {
+	var b strings.Builder
+	prev := 0
+	for _, section := range findResumenSections(content) {
+		b.WriteString(content[prev:section.start])
+		prev = section.end
+	}
+	b.WriteString(content[prev:])
+	return b.String()
+}
+
+// placeResumenSection puts section into content according to placement.
+// Bytes outside the section being replaced are kept as they are; only when
+// appending at the end are trailing newlines normalized to one blank line.
+func placeResumenSection(content, section, sessionID string, placement summaryPlacement) string {
+	return placeStepSection(content, section, sessionID, "", placement)
+}
+
+// placeStepSection is placeResumenSection for a pipeline step's section,
+// which only ever takes the place of, or goes after, the same step's.
+func placeStepSection(content, section, sessionID, step string, placement summaryPlacement) string {
+	var sections []resumenSection
+	for _, s := range findResumenSections(content) {
+		if s.step == step {
+			sections = append(sections, s)
+		}
+	}
+
+	switch placement {
+	case placeOwn:
+		for i := len(sections) - 1; i >= 0; i-- {
+			if sections[i].session == sessionID {
+				return content[:sections[i].start] + section + content[sections[i].end:]
+			}
+		}
+
+	case placeNewVersion:
+		if n := len(sections); n > 0 {
+			before := content[:sections[n-1].end]
+			if !strings.HasSuffix(before, "\n") {
+				before += "\n"
+			}
+			return before + "\n" + section + content[sections[n-1].end:]
+		}
+
+	case placeReplace:
+		if n := len(sections); n > 0 {
+			return content[:sections[n-1].start] + section + content[sections[n-1].end:]
+		}
+		if start, end, ok := legacyResumenSection(content); ok && step == "" {
+			if rest := content[end:]; rest != "" {
+				return content[:start] + section + "\n" + rest
+			}
+			return content[:start] + section
+		}
+	}
+
+	return appendResumenSection(content, section)
+}
+
+// appendResumenSection preserves existingContent verbatim (frontmatter, a
+// "## Notas" section, anything else already there) and adds section below
+// it, separated by one blank line.
+func appendResumenSection(existingContent, section string) string {
+	existing := strings.TrimRight(existingContent, "\n")
+	if existing == "" {
+		return section
+	}
+	return existing + "\n\n" + section
+}
+
+// upperHeadingPattern matches a level 1 or 2 Markdown heading.
+var upperHeadingPattern = regexp.MustCompile(`(?m)^#{1,2} `)
+
+// legacyResumenSection finds a summary written before summaries were
+// marked: the last "## Resumen" heading, up to the next heading of the
+// same or a higher level or the end of the note. Such summaries were
+// always appended at the end of the note, but anything written below them
+// since under a heading of its own is left out. start and end are byte
+// offsets.
+func legacyResumenSection(content string) (start, end int, ok bool) {
+	// Prefixing a newline lets a heading on the note's very first line
+	// match too; the index then points at the heading in content itself.
+	start = strings.LastIndex("\n"+content, "\n## Resumen\n")
+	if start < 0 {
+		return 0, 0, false
+	}
+	body := start + len("## Resumen\n")
+	if loc := upperHeadingPattern.FindStringIndex(content[body:]); loc != nil {
+		return start, body + loc[0], true
+	}
+	return start, len(content), true
+}
+
+// removeResumenSection drops a summary written before summaries were
+// marked (see legacyResumenSection). A note without one is returned
+// unchanged.
+func removeResumenSection(content string) string {
+	if start, end, ok := legacyResumenSection(content); ok {
+		return content[:start] + content[end:]
+	}
+	return content
+}
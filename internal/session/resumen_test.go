@@ -0,0 +1,165 @@
+package session
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+var resumenTestTime = time.Date(2026, 1, 15, 15, 30, 0, 0, time.UTC)
+
+func resumenTestSection(sessionID, resumen string) string {
+	return formatResumenSection(sessionID, resumenTestTime, resumen)
+}
+
+func TestFormatResumenSection(t *testing.T) {
+	got := formatResumenSection("2026-01-15 1430", resumenTestTime, "El resumen generado.\n\n")
+	expected := `<!-- trani:resumen:start session="2026-01-15 1430" generated="2026-01-15T15:30:00Z" -->` + "\n" +
+		"## Resumen\n\nEl resumen generado.\n" +
+		"<!-- trani:resumen:end -->\n"
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	sections := findResumenSections("## Notas\n\n" + got)
+	if len(sections) != 1 {
+		t.Fatalf("expected 1 section, got %d", len(sections))
+	}
+	if sections[0].session != "2026-01-15 1430" || sections[0].generated != "2026-01-15T15:30:00Z" {
+		t.Errorf("unexpected section: %+v", sections[0])
+	}
+}
+
+func TestFindResumenSectionsIgnoresUnterminatedMarker(t *testing.T) {
+	content := "## Notas\n\n" + strings.TrimSuffix(resumenTestSection("a", "Uno."), resumenEndMarker+"\n")
+	if sections := findResumenSections(content); len(sections) != 0 {
+		t.Errorf("expected no sections, got %+v", sections)
+	}
+}
+
+func TestAppendResumenSection(t *testing.T) {
+	section := resumenTestSection("s", "El resumen generado.")
+	cases := []struct {
+		name            string
+		existingContent string
+		expected        string
+	}{
+		{
+			name:            "empty note",
+			existingContent: "",
+			expected:        section,
+		},
+		{
+			name:            "preserves frontmatter and Notas section",
+			existingContent: "---\nasistentes: []\n---\n\n## Notas\n\nAlgo que anoté.",
+			expected:        "---\nasistentes: []\n---\n\n## Notas\n\nAlgo que anoté.\n\n" + section,
+		},
+		{
+			name:            "trims trailing newlines before appending",
+			existingContent: "## Notas\n\nAlgo.\n\n\n",
+			expected:        "## Notas\n\nAlgo.\n\n" + section,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := appendResumenSection(c.existingContent, section)
+			if got != c.expected {
+				t.Errorf("expected %q, got %q", c.expected, got)
+			}
+		})
+	}
+}
+
+func TestPlaceResumenSectionOwnReplacesInPlace(t *testing.T) {
+	before := "## Notas\n\nAlgo.\n\n"
+	after := "\n## Después\n\nLo que el usuario escribió debajo.\n"
+	content := before + resumenTestSection("s", "Viejo.") + after
+
+	got := placeResumenSection(content, resumenTestSection("s", "Nuevo."), "s", placeOwn)
+	if expected := before + resumenTestSection("s", "Nuevo.") + after; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+
+	// Running it again (a retried worker) changes nothing else.
+	if again := placeResumenSection(got, resumenTestSection("s", "Nuevo."), "s", placeOwn); again != got {
+		t.Errorf("expected a second run to be idempotent, got %q", again)
+	}
+}
+
+func TestPlaceResumenSectionOwnAppendsForOtherSession(t *testing.T) {
+	content := "## Notas\n\n" + resumenTestSection("otra", "Viejo.")
+	got := placeResumenSection(content, resumenTestSection("s", "Nuevo."), "s", placeOwn)
+	if expected := content + "\n" + resumenTestSection("s", "Nuevo."); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestPlaceResumenSectionNewVersion(t *testing.T) {
+	first := resumenTestSection("s", "Uno.")
+	after := "\n## Después\n\nAlgo.\n"
+	content := "## Notas\n\n" + first + after
+
+	got := placeResumenSection(content, resumenTestSection("s", "Dos."), "s", placeNewVersion)
+	expected := "## Notas\n\n" + first + "\n" + resumenTestSection("s", "Dos.") + after
+	if got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+	if n := len(findResumenSections(got)); n != 2 {
+		t.Errorf("expected 2 versions, got %d", n)
+	}
+
+	// Without a newline after the end marker, the new version still starts
+	// on a line of its own.
+	noNewline := strings.TrimSuffix(first, "\n")
+	got = placeResumenSection(noNewline, resumenTestSection("s", "Dos."), "s", placeNewVersion)
+	if expected := first + "\n" + resumenTestSection("s", "Dos."); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestPlaceResumenSectionReplaceLatest(t *testing.T) {
+	first := resumenTestSection("s", "Uno.")
+	content := first + "\n" + resumenTestSection("s", "Dos.") + "\nDebajo.\n"
+
+	got := placeResumenSection(content, resumenTestSection("s", "Tres."), "s", placeReplace)
+	if expected := first + "\n" + resumenTestSection("s", "Tres.") + "\nDebajo.\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestPlaceResumenSectionReplaceLegacy(t *testing.T) {
+	content := "## Notas\n\nAlgo.\n\n## Resumen\n\nViejo.\n\n## Pendientes\n\nDebajo.\n"
+
+	got := placeResumenSection(content, resumenTestSection("s", "Nuevo."), "s", placeReplace)
+	if expected := "## Notas\n\nAlgo.\n\n" + resumenTestSection("s", "Nuevo.") + "\n## Pendientes\n\nDebajo.\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestStripResumenSections(t *testing.T) {
+	content := "## Notas\n\nAlgo.\n\n" + resumenTestSection("s", "Uno.") + "\nDebajo.\n" + resumenTestSection("s", "Dos.")
+	if got, expected := stripResumenSections(content), "## Notas\n\nAlgo.\n\n\nDebajo.\n"; got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestRemoveResumenSection(t *testing.T) {
+	cases := []struct {
+		name     string
+		content  string
+		expected string
+	}{
+		{"no summary", "## Notas\n\nAlgo.", "## Notas\n\nAlgo."},
+		{"summary only", "## Resumen\n\nViejo.", ""},
+		{"after notes", "## Notas\n\nAlgo.\n\n## Resumen\n\nViejo.", "## Notas\n\nAlgo.\n\n"},
+		{"second summary from a previous re-run", "## Notas\n\n## Resumen\n\nUno.\n\n## Resumen\n\nDos.", "## Notas\n\n## Resumen\n\nUno.\n\n"},
+		{"heading text in the notes", "Ver ## Resumen de ayer", "Ver ## Resumen de ayer"},
+		{"notes written below it", "## Resumen\n\nViejo.\n\n### Detalle\n\nMás.\n\n## Pendientes\n\nAlgo.\n\n# Otro\n", "## Pendientes\n\nAlgo.\n\n# Otro\n"},
+	}
+	for _, tc := range cases {
+		if got := removeResumenSection(tc.content); got != tc.expected {
+			t.Errorf("%s: expected %q, got %q", tc.name, tc.expected, got)
+		}
+	}
+}
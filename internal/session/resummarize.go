@@ -0,0 +1,122 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// Resummarize generates a session's summary again from its existing
+// transcript (.sources/<title>.txt) and the note's current content, without
+// recording or transcribing anything. noteOrTitle is either the path to the
+// note or just its title. An empty promptTemplate reuses the one the
+// session was summarized with. With replace, the summary a previous run
+// added is swapped for the new one instead of a second one being appended.
+func Resummarize(ctx context.Context, noteOrTitle, promptTemplate string, replace bool, cfg *config.Config) error {
+	notePath, title := resolveNote(noteOrTitle, cfg)
+	explicitPrompt := promptTemplate != ""
+	if !explicitPrompt {
+		promptTemplate = sessionPrompt(cfg, title)
+	}
+
+	if _, err := os.Stat(notePath); err != nil {
+		return fmt.Errorf("note not found: %s", notePath)
+	}
+
+	txtPath := filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".txt")
+	rawTranscription, err := os.ReadFile(txtPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("no transcript found for %s (expected %s)", title, txtPath)
+		}
+		return fmt.Errorf("failed to read transcription: %w", err)
+	}
+	transcription := removeConsecutiveDuplicateLines(strings.TrimSpace(string(rawTranscription)))
+
+	llmClient, err := llm.New(cfg.LLM)
+	if err != nil {
+		return fmt.Errorf("failed to initialize LLM: %w", err)
+	}
+	llms := newLLMClients(cfg.LLM, llmClient)
+
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		return fmt.Errorf("failed to initialize prompts: %w", err)
+	}
+
+	logIndex(updateIndex(cfg, title, func(e *IndexEntry) {
+		if e.NotePath == "" {
+			e.NotePath = notePath
+		}
+		e.LLMBackend = cfg.LLM.Backend
+		if explicitPrompt {
+			e.PromptTemplate = promptTemplate
+		}
+		e.Status = IndexSummarizing
+	}))
+
+	placement := placeNewVersion
+	if replace {
+		placement = placeReplace
+	}
+	notifier := notify.New()
+	data := newPromptData(cfg, title).withChunks(cfg, rawTranscription)
+	err = writeSummary(ctx, llms, notePath, transcription, nil, cfg.Paths.PromptsDir, promptTemplate, title, data, cfg.LLM.MaxPromptTokens, placement, notifier)
+	if err == nil {
+		// Their failures are notified and logged, and don't undo the summary.
+		notePath, _ = writeTitleAndTags(ctx, cfg, llms, notePath, transcription, nil, promptTemplate, title, data, notifier)
+		writeActionItems(ctx, cfg, llms, notePath, transcription, nil, promptTemplate, title, data, placement, notifier)
+	}
+
+	logIndex(updateIndex(cfg, title, func(e *IndexEntry) {
+		e.Status = IndexSummarized
+		if err != nil {
+			e.Status = IndexSummaryFailed
+			return
+		}
+		e.SummarizedBy = llms.usedBackends()
+	}))
+
+	return err
+}
+
+// sessionPrompt is the prompt template the index records for session
+// title, "default" if it has none.
+func sessionPrompt(cfg *config.Config, title string) string {
+	entries, _ := ReadIndex(cfg)
+	for _, e := range entries {
+		if e.Title == title && e.PromptTemplate != "" {
+			return e.PromptTemplate
+		}
+	}
+	return "default"
+}
+
+// resolveNote turns a `resummarize` argument into the note's path and its
+// session's title (the .sources/<title> basename). An existing file is
+// taken as the note itself; anything else as a note's name in
+// sessions_dir, or a session's title. A note renamed after its session
+// (see renameNote) is traced back to it through the session index, both
+// ways.
+func resolveNote(noteOrTitle string, cfg *config.Config) (notePath, title string) {
+	if info, err := os.Stat(noteOrTitle); err == nil && !info.IsDir() {
+		notePath = noteOrTitle
+	} else {
+		notePath = filepath.Join(cfg.Paths.SessionsDir, strings.TrimSuffix(noteOrTitle, ".md")+".md")
+		if _, err := os.Stat(notePath); os.IsNotExist(err) {
+			if renamed := noteForSession(cfg, strings.TrimSuffix(noteOrTitle, ".md")); renamed != "" {
+				return renamed, strings.TrimSuffix(noteOrTitle, ".md")
+			}
+		}
+	}
+
+	if entry, ok := sessionForNote(cfg, notePath); ok {
+		return notePath, entry.Title
+	}
+	return notePath, strings.TrimSuffix(filepath.Base(notePath), filepath.Ext(notePath))
+}
@@ -0,0 +1,45 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveNote(t *testing.T) {
+	cfg := testConfig(t)
+
+	notePath, title := resolveNote("2026-01-15 1430", cfg)
+	if notePath != filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 1430.md") || title != "2026-01-15 1430" {
+		t.Errorf("title: got %s, %s", notePath, title)
+	}
+
+	notePath, title = resolveNote("2026-01-15 1430.md", cfg)
+	if notePath != filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 1430.md") || title != "2026-01-15 1430" {
+		t.Errorf("title with extension: got %s, %s", notePath, title)
+	}
+
+	elsewhere := filepath.Join(t.TempDir(), "2026-01-15 1430.md")
+	if err := os.WriteFile(elsewhere, nil, 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+	notePath, title = resolveNote(elsewhere, cfg)
+	if notePath != elsewhere || title != "2026-01-15 1430" {
+		t.Errorf("existing path: got %s, %s", notePath, title)
+	}
+}
+
+func TestSessionPrompt(t *testing.T) {
+	cfg := testConfig(t)
+
+	if got := sessionPrompt(cfg, "2026-01-15 1430"); got != "default" {
+		t.Errorf("unindexed session: expected default, got %s", got)
+	}
+
+	if err := recordIndex(cfg, IndexEntry{Title: "2026-01-15 1430", PromptTemplate: "standup"}); err != nil {
+		t.Fatalf("failed to record index: %v", err)
+	}
+	if got := sessionPrompt(cfg, "2026-01-15 1430"); got != "standup" {
+		t.Errorf("expected the indexed prompt, got %s", got)
+	}
+}
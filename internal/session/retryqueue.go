@@ -0,0 +1,322 @@
+package session
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio/wav"
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/transcribe"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// A chunk that can't be processed or transcribed isn't dropped, and doesn't
+// hold up the chunks after it either: its audio is moved to the session's
+// retry queue, <temp_dir>/retry/<title>/, and a gap marker takes its place
+// in the transcript. The queue is retried at the start of every later poll,
+// the last time once recording stops, and a chunk that makes it through
+// then has its text put where its marker is.
+
+// chunkFailedBackend is what the session index records as having
+// transcribed a chunk that's queued, until a retry succeeds.
+const chunkFailedBackend = "failed"
+
+// queuedChunk is a queued chunk's metadata, kept next to its audio as
+// chunk-NNN.json.
+type queuedChunk struct {
+	Index        int     `json:"index"` // 1-based, in the session's recording order
+	StartSeconds float64 `json:"start_seconds"`
+	EndSeconds   float64 `json:"end_seconds"`
+	Marker       string  `json:"marker"`
+	Mic          string  `json:"mic"`
+	System       string  `json:"system,omitempty"` // mic_system mode only
+	Processed    bool    `json:"processed"`        // audio already post-processed
+	Attempts     int     `json:"attempts"`
+	LastError    string  `json:"last_error"`
+}
+
+func (q *queuedChunk) start() time.Duration {
+	return time.Duration(q.StartSeconds * float64(time.Second))
+}
+
+func (q *queuedChunk) end() time.Duration {
+	return time.Duration(q.EndSeconds * float64(time.Second))
+}
+
+func retryQueueDir(cfg *config.Config, title string) string {
+	return filepath.Join(cfg.Paths.TempDir, "retry", title)
+}
+
+// gapMarker is the transcript line standing in for a chunk that failed,
+// e.g. "[chunk 7 failed: 00:30:00–00:35:00]".
+func gapMarker(index int, start, end time.Duration) string {
+	return fmt.Sprintf("[chunk %d failed: %s–%s]", index, formatClock(start), formatClock(end))
+}
+
+func formatClock(d time.Duration) string {
+	s := int(d.Round(time.Second).Seconds())
+	return fmt.Sprintf("%02d:%02d:%02d", s/3600, s/60%60, s%60)
+}
+
+// queueChunk moves the chunk being processed to the retry queue after it
+// failed with cause, and writes its gap marker to the transcript. archive
+// is its post-processed audio, added to the archive now so that everything
+// after it keeps its place in the audio and subtitles; it's "" when the
+// audio itself couldn't be processed, and the chunk is then left out of
+// the archive. Returns an error only if the chunk couldn't be queued, in
+// which case it's processed again on the next poll like before.
+func (c *chunker) queueChunk(micPath, systemPath, archive string, cause error) error {
+	start, err := c.archivedDuration()
+	if err != nil {
+		return err
+	}
+	length := archive
+	if length == "" {
+		length = micPath
+	}
+	end := start
+	if d, err := wav.FileDuration(length); err == nil {
+		end += d
+	}
+
+	q := &queuedChunk{
+		Index:        c.processed + 1,
+		StartSeconds: start.Seconds(),
+		EndSeconds:   end.Seconds(),
+		Marker:       gapMarker(c.processed+1, start, end),
+		Processed:    archive != "",
+		Attempts:     1,
+		LastError:    cause.Error(),
+	}
+
+	if err := os.MkdirAll(c.queueDir, 0755); err != nil {
+		return fmt.Errorf("failed to create retry queue: %w", err)
+	}
+	if archive != "" {
+		if err := c.appendAudio(archive); err != nil {
+			return err
+		}
+	}
+
+	q.Mic = fmt.Sprintf("chunk-%03d-mic.wav", q.Index)
+	if err := os.Rename(micPath, filepath.Join(c.queueDir, q.Mic)); err != nil {
+		return fmt.Errorf("failed to queue chunk: %w", err)
+	}
+	if systemPath != "" {
+		q.System = fmt.Sprintf("chunk-%03d-system.wav", q.Index)
+		if err := os.Rename(systemPath, filepath.Join(c.queueDir, q.System)); err != nil {
+			return fmt.Errorf("failed to queue chunk: %w", err)
+		}
+	}
+
+	// The chunk is out of the recorder's directory now, so it counts as
+	// processed whatever happens next: returning an error would only have
+	// the next poll try to queue it again.
+	errlog.Warn("chunk_queued", c.title, fmt.Errorf("chunk %d: %w", q.Index, cause))
+	c.reportChunkError(q.Index, cause)
+	c.queued++
+	c.chunkBackends = []string{chunkFailedBackend}
+	for _, err := range []error{c.writeQueued(q), c.appendText(q.Marker)} {
+		if err != nil {
+			errlog.Error("retry_queue", c.title, err)
+		}
+	}
+	c.recordLines(q.Index)
+	return nil
+}
+
+// retryQueued retries every queued chunk, oldest first, and returns how
+// many are still queued.
+func (c *chunker) retryQueued(ctx context.Context) int {
+	queued, err := c.readQueued()
+	if err != nil {
+		errlog.Error("retry_queue", c.title, err)
+		return len(queued)
+	}
+
+	remaining := 0
+	for _, q := range queued {
+		err := c.retryChunk(ctx, q)
+		if err == nil {
+			continue
+		}
+		remaining++
+		q.Attempts++
+		q.LastError = err.Error()
+		errlog.Warn("chunk_retry", c.title, fmt.Errorf("chunk %d: %w", q.Index, err), "attempts", q.Attempts)
+		c.reportChunkError(q.Index, err)
+		if err := c.writeQueued(q); err != nil {
+			errlog.Error("retry_queue", c.title, err)
+		}
+	}
+	return remaining
+}
+
+// retryChunk processes a queued chunk again. Its text replaces its gap
+// marker, its subtitles go where its audio is in the archive and a rolling
+// summary that only saw the marker takes it in again, after which it
+// leaves the queue.
+func (c *chunker) retryChunk(ctx context.Context, q *queuedChunk) error {
+	micPath := filepath.Join(c.queueDir, q.Mic)
+	systemPath := ""
+	if q.System != "" {
+		systemPath = filepath.Join(c.queueDir, q.System)
+	}
+
+	if !q.Processed {
+		if err := c.processAudio(micPath, systemPath); err != nil {
+			return err
+		}
+		// Too late to archive it without shifting every chunk after it,
+		// but its text and subtitles are still worth having.
+		q.Processed = true
+	}
+
+	c.chunkBackends, c.chunkSpeech, c.chunkLines = nil, 0, 0
+	result, err := c.transcribeQueued(ctx, micPath, systemPath)
+	if err != nil {
+		return err
+	}
+
+	if err := c.replaceGapMarker(q.Marker, result.Text); err != nil {
+		return err
+	}
+	c.recordLines(q.Index)
+	if err := c.appendSegmentsAt(result.Segments, q.start()); err != nil {
+		return err
+	}
+
+	c.recordChunkAt(q.Index)
+	c.rolling.chunkRetried(q.Index)
+
+	errlog.Info("chunk_retry", c.title, fmt.Sprintf("chunk %d transcribed on retry %d", q.Index, q.Attempts))
+	os.Remove(micPath)
+	if systemPath != "" {
+		os.Remove(systemPath)
+	}
+	return os.Remove(c.queuedPath(q.Index))
+}
+
+// reportChunkError publishes why a chunk failed, as the last chunk error.
+func (c *chunker) reportChunkError(index int, err error) {
+	c.status.update(func(s *JobStatus) {
+		s.LastChunkError = fmt.Sprintf("chunk %d: %v", index, err)
+		s.LastChunkErrorAt = time.Now()
+	})
+}
+
+// transcribeQueued transcribes a queued chunk's post-processed audio the
+// way it would have been the first time round.
+func (c *chunker) transcribeQueued(ctx context.Context, micPath, systemPath string) (transcribe.Result, error) {
+	prompt := c.transcriptionPrompt()
+	if systemPath == "" {
+		return c.transcribeChunk(ctx, micPath, prompt)
+	}
+
+	combinedPath := systemPath + ".combined.wav"
+	if err := mixAudio(micPath, systemPath, combinedPath); err != nil {
+		return transcribe.Result{}, fmt.Errorf("failed to combine audio: %w", err)
+	}
+	defer os.Remove(combinedPath)
+	return c.transcribeMicSystem(ctx, micPath, systemPath, combinedPath, prompt)
+}
+
+// abandonQueued logs every chunk still queued once there's no retry left,
+// and returns how many there are.
+// Their audio stays in the queue.
+func (c *chunker) abandonQueued() int {
+	queued, err := c.readQueued()
+	if err != nil {
+		errlog.Error("retry_queue", c.title, err)
+	}
+	for _, q := range queued {
+		err := fmt.Errorf("chunk %d (%s–%s) failed after %d attempts, audio kept in %s: %s",
+			q.Index, formatClock(q.start()), formatClock(q.end()), q.Attempts, c.queueDir, q.LastError)
+		errlog.Error("chunk_transcription", c.title, err)
+	}
+	return len(queued)
+}
+
+func (c *chunker) queuedPath(index int) string {
+	return filepath.Join(c.queueDir, fmt.Sprintf("chunk-%03d.json", index))
+}
+
+func (c *chunker) writeQueued(q *queuedChunk) error {
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode queued chunk: %w", err)
+	}
+	if err := os.WriteFile(c.queuedPath(q.Index), data, 0644); err != nil {
+		return fmt.Errorf("failed to write queued chunk: %w", err)
+	}
+	return nil
+}
+
+// readQueued returns the queued chunks in order, none if there's no queue.
+func (c *chunker) readQueued() ([]*queuedChunk, error) {
+	paths, err := filepath.Glob(filepath.Join(c.queueDir, "chunk-*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	var queued []*queuedChunk
+	var errs []error
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to read queued chunk: %w", err))
+			continue
+		}
+		var q queuedChunk
+		if err := json.Unmarshal(data, &q); err != nil {
+			errs = append(errs, fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err))
+			continue
+		}
+		queued = append(queued, &q)
+	}
+	return queued, errors.Join(errs...)
+}
+
+// replaceGapMarker puts a retried chunk's text where its gap marker is in
+// the transcript, or drops the marker's line if the chunk turned out to
+// have no speech, counting the lines it takes in chunkLines. The
+// transcript is rewritten atomically. If the marker is gone (edited by
+// hand), the text is appended instead, so it isn't lost.
+func (c *chunker) replaceGapMarker(marker, text string) error {
+	data, err := os.ReadFile(c.txtPath)
+	if err != nil {
+		return fmt.Errorf("failed to read transcript: %w", err)
+	}
+	content := string(data)
+	text = strings.TrimSpace(text)
+
+	i := strings.Index(content, marker)
+	if i < 0 {
+		return c.appendText(text)
+	}
+
+	end := i + len(marker)
+	if text == "" && end < len(content) && content[end] == '\n' {
+		end++
+	}
+	content = content[:i] + text + content[end:]
+	c.chunkLines = lineCount(text)
+
+	tempPath := c.txtPath + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	if err := os.Rename(tempPath, c.txtPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write transcript: %w", err)
+	}
+	return nil
+}
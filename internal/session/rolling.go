@@ -0,0 +1,324 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// The rolling summary file starts with a header recording how many of the
+// session's chunks the summary covers, and which of those it only saw the
+// gap marker of, so the next update and the final summary know which text
+// is new. Chunks, not bytes of the transcript: a retried chunk's text
+// replacing its gap marker shifts everything after it (see
+// rollingSummarizer.chunkRetried).
+const rollingHeader = `<!-- trani:rolling session="%s" chunks="%d" missing="%s" updated="%s" -->`
+
+var rollingHeaderPattern = regexp.MustCompile(`^<!-- trani:rolling session="[^"]*" chunks="(\d+)"(?: missing="([\d,]*)")? updated="([^"]*)" -->\n`)
+
+// rollingSummary is the "summary so far" of a session still recording.
+type rollingSummary struct {
+	summary   string
+	covered   int   // chunks of the transcript the summary covers, from the first
+	missing   []int // chunks (from 1) among those retried since, in order
+	updatedAt time.Time
+}
+
+// uncovered returns the text of the chunks in raw the summary doesn't
+// cover, the missing ones followed by those from covered through to-1,
+// along with how many lines each of them takes (see chunksText).
+func (s *rollingSummary) uncovered(raw []byte, chunkLines []int, to int) (string, []int) {
+	var text strings.Builder
+	var lines []int
+	for _, index := range s.missing {
+		text.WriteString(chunksText(raw, chunkLines, index-1, index))
+		lines = append(lines, chunkLines[index-1])
+	}
+	text.WriteString(chunksText(raw, chunkLines, s.covered, to))
+	return text.String(), append(lines, chunkLines[s.covered:min(to, len(chunkLines))]...)
+}
+
+func rollingSummaryPath(cfg *config.Config, title string) string {
+	return filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".rolling.md")
+}
+
+// readRollingSummary reads a rolling summary file, returning nil if there
+// is none or it can't be parsed: it's only ever a head start.
+func readRollingSummary(path string) *rollingSummary {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	m := rollingHeaderPattern.FindSubmatchIndex(data)
+	if m == nil {
+		return nil
+	}
+
+	covered, err := strconv.Atoi(string(data[m[2]:m[3]]))
+	if err != nil {
+		return nil
+	}
+	var missing []int
+	if m[4] >= 0 && m[5] > m[4] {
+		for _, field := range strings.Split(string(data[m[4]:m[5]]), ",") {
+			index, err := strconv.Atoi(field)
+			if err != nil || index < 1 || index > covered {
+				return nil
+			}
+			missing = append(missing, index)
+		}
+	}
+	updatedAt, _ := time.Parse(time.RFC3339, string(data[m[6]:m[7]]))
+
+	summary := strings.TrimSpace(strings.TrimPrefix(string(data[m[1]:]), "## Resumen hasta ahora\n"))
+	if summary == "" {
+		return nil
+	}
+	return &rollingSummary{summary: summary, covered: covered, missing: missing, updatedAt: updatedAt}
+}
+
+// rollingHeadStart returns session title's rolling summary, along with
+// the text of the chunks of the transcript, raw, it doesn't cover, or nil
+// if there's none.
+func rollingHeadStart(cfg *config.Config, title string, raw []byte) *summaryHeadStart {
+	rolling := readRollingSummary(rollingSummaryPath(cfg, title))
+	chunkLines, err := readChunkLines(cfg, title)
+	if rolling == nil || err != nil || rolling.covered > len(chunkLines) {
+		return nil
+	}
+	rest, _ := rolling.uncovered(raw, chunkLines, len(chunkLines)+1)
+	return &summaryHeadStart{
+		summary: rolling.summary,
+		rest:    removeConsecutiveDuplicateLines(strings.TrimSpace(rest)),
+	}
+}
+
+// rollingSummarizer updates a live session's rolling summary every few
+// transcribed chunks (llm.rolling_summary_chunks), folding the text
+// transcribed since the last update into the previous summary. Failures
+// are logged and retried with the next chunks; they never affect the
+// recording. A nil rollingSummarizer does nothing.
+type rollingSummarizer struct {
+	cfg             *config.Config
+	llms            *llmClients
+	promptsDir      string
+	promptTemplate  string
+	maxPromptTokens int
+	every           int
+
+	title   string
+	txtPath string
+	path    string
+	data    promptData // the session's details, for the prompt
+
+	pending int // chunks transcribed since the last update
+
+	// mu guards current against a retried chunk being added to its
+	// missing chunks (see chunkRetried) while an update runs in the
+	// background. retried are the chunks retried since the running update
+	// started.
+	mu      sync.Mutex
+	current *rollingSummary
+	retried []int
+}
+
+// newRollingSummarizer returns nil unless rolling summaries are enabled.
+func newRollingSummarizer(cfg *config.Config, llms *llmClients, title, promptTemplate string) *rollingSummarizer {
+	if cfg.LLM.RollingSummaryChunks <= 0 {
+		return nil
+	}
+	path := rollingSummaryPath(cfg, title)
+	return &rollingSummarizer{
+		cfg:             cfg,
+		llms:            llms,
+		promptsDir:      cfg.Paths.PromptsDir,
+		promptTemplate:  promptTemplate,
+		maxPromptTokens: cfg.LLM.MaxPromptTokens,
+		every:           cfg.LLM.RollingSummaryChunks,
+		title:           title,
+		txtPath:         filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".txt"),
+		path:            path,
+		data:            newPromptData(cfg, title),
+		current:         readRollingSummary(path),
+	}
+}
+
+// chunksTranscribed counts n more transcribed chunks and updates the
+// rolling summary once enough have piled up since the last update.
+// Reports whether it was updated.
+func (r *rollingSummarizer) chunksTranscribed(ctx context.Context, n int) bool {
+	if r == nil || n <= 0 {
+		return false
+	}
+	r.pending += n
+	if r.pending < r.every {
+		return false
+	}
+
+	if err := r.update(ctx); err != nil {
+		// Cancelled because the session stopped: the final summary is next.
+		if ctx.Err() == nil {
+			fmt.Fprintf(os.Stderr, "trani: rolling summary error: %v\n", err)
+			errlog.Error("rolling_summary", r.title, err)
+		}
+		return false
+	}
+	r.pending = 0
+	return true
+}
+
+// update folds the text of the chunks transcribed since the last update,
+// and of the retried chunks the summary only saw the marker of, into the
+// rolling summary, in windows if it doesn't fit in one prompt, and
+// rewrites the rolling summary file.
+func (r *rollingSummarizer) update(ctx context.Context) error {
+	r.mu.Lock()
+	current := r.current
+	r.retried = nil
+	r.mu.Unlock()
+
+	// The chunk lines first: a chunk's are recorded right after its text
+	// is appended, so the transcript has at least the recorded chunks'.
+	chunkLines, err := readChunkLines(r.cfg, r.title)
+	if err != nil {
+		return err
+	}
+	raw, err := os.ReadFile(r.txtPath)
+	if err != nil {
+		return fmt.Errorf("failed to read transcription: %w", err)
+	}
+
+	from := &rollingSummary{}
+	if current != nil && current.covered <= len(chunkLines) {
+		from = current
+	}
+	summary := from.summary
+
+	newText, newLines := from.uncovered(raw, chunkLines, len(chunkLines))
+	text := removeConsecutiveDuplicateLines(strings.TrimSpace(newText))
+	if text == "" {
+		return nil
+	}
+
+	prompt, err := loadPromptFile(r.promptsDir, r.promptTemplate, "_rolling.txt")
+	if err != nil {
+		return err
+	}
+
+	for _, window := range r.windows(prompt, summary, text, cleanChunkLines(newText, newLines)) {
+		data := r.data
+		data.Summary, data.Transcription = summary, window
+		req, err := prompt.render(data)
+		if err != nil {
+			return err
+		}
+
+		updated, err := r.llms.generate(ctx, prompt.settings.Backend, req)
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(updated) == "" {
+			return fmt.Errorf("the model returned an empty summary")
+		}
+		summary = strings.TrimSpace(updated)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	next := &rollingSummary{summary: summary, covered: len(chunkLines), updatedAt: time.Now()}
+	for _, index := range r.retried {
+		// Retried while the update ran: missing if the transcript it read
+		// still had the chunk's marker rather than its text.
+		marker := fmt.Sprintf("[chunk %d failed:", index)
+		if index <= next.covered && strings.HasPrefix(strings.TrimSpace(chunksText(raw, chunkLines, index-1, index)), marker) {
+			next.missing = addChunk(next.missing, index)
+		}
+	}
+	if err := r.write(next); err != nil {
+		return err
+	}
+	r.current = next
+	return nil
+}
+
+// chunkRetried tells the rolling summary that chunk index's (from 1) text
+// just replaced its gap marker in the transcript. A summary covering the
+// chunk only saw the marker, so the chunk is recorded as missing from it:
+// the next update and the final summary take in its text along with the
+// new chunks', rather than miss it, and nothing they've already covered.
+func (r *rollingSummarizer) chunkRetried(index int) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.retried = append(r.retried, index)
+	if r.current == nil || index > r.current.covered || slices.Contains(r.current.missing, index) {
+		return
+	}
+	next := *r.current
+	next.missing = addChunk(slices.Clone(next.missing), index)
+	if err := r.write(&next); err != nil {
+		errlog.Error("rolling_summary", r.title, err)
+		return
+	}
+	r.current = &next
+}
+
+// addChunk adds index to chunks, kept in order, unless it's already there.
+func addChunk(chunks []int, index int) []int {
+	i, found := slices.BinarySearch(chunks, index)
+	if found {
+		return chunks
+	}
+	return slices.Insert(chunks, i, index)
+}
+
+// windows splits the new text, between chunks where it can (see
+// splitTranscript), so that each update prompt stays within
+// maxPromptTokens, leaving room for the summary so far (which the model is
+// asked to keep about the same length) next to it.
+func (r *rollingSummarizer) windows(prompt promptFile, summary, text string, chunkLines []int) []string {
+	if r.maxPromptTokens <= 0 {
+		return []string{text}
+	}
+	budget := r.maxPromptTokens - estimateTokens(prompt.template) - estimateTokens(prompt.settings.System) - estimateTokens(summary)
+	if budget <= 0 {
+		// The summary outgrew the limit on its own: keep folding text in,
+		// half a prompt at a time, rather than stop updating it.
+		budget = r.maxPromptTokens / 2
+	}
+	return splitTranscript(text, chunkLines, budget)
+}
+
+// write replaces the rolling summary file atomically, so someone catching
+// up mid-meeting never opens a half-written one.
+func (r *rollingSummarizer) write(s *rollingSummary) error {
+	missing := make([]string, len(s.missing))
+	for i, index := range s.missing {
+		missing[i] = strconv.Itoa(index)
+	}
+	content := fmt.Sprintf(rollingHeader, r.title, s.covered, strings.Join(missing, ","), s.updatedAt.Format(time.RFC3339)) + "\n" +
+		"## Resumen hasta ahora\n\n" + s.summary + "\n"
+
+	tempPath := r.path + ".tmp"
+	if err := os.WriteFile(tempPath, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write rolling summary: %w", err)
+	}
+	if err := os.Rename(tempPath, r.path); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write rolling summary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/llm"
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+func TestRollingSummarizerUpdatesEveryNChunks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.LLM.RollingSummaryChunks = 2
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+
+	title := "2026-01-15 1430"
+	txtPath := filepath.Join(cfg.Paths.SessionsDir, ".sources", title+".txt")
+	if err := os.MkdirAll(filepath.Dir(txtPath), 0755); err != nil {
+		t.Fatalf("failed to create sources directory: %v", err)
+	}
+	if err := os.WriteFile(txtPath, []byte("alfa\nbravo\n"), 0644); err != nil {
+		t.Fatalf("failed to write transcript: %v", err)
+	}
+	for chunk := 1; chunk <= 2; chunk++ {
+		if err := recordChunkLines(cfg, title, chunk, 1); err != nil {
+			t.Fatalf("recordChunkLines failed: %v", err)
+		}
+	}
+
+	llmClient := &recordingGenerator{}
+	r := newRollingSummarizer(cfg, llmClient.clients(), title, "default")
+
+	if r.chunksTranscribed(context.Background(), 1) {
+		t.Fatal("expected no update after 1 of 2 chunks")
+	}
+	if !r.chunksTranscribed(context.Background(), 1) {
+		t.Fatal("expected an update after 2 chunks")
+	}
+	if len(llmClient.prompts) != 1 || !strings.Contains(llmClient.prompts[0], "alfa\nbravo") {
+		t.Fatalf("expected one prompt with the transcript so far, got %q", llmClient.prompts)
+	}
+
+	rolling := readRollingSummary(rollingSummaryPath(cfg, title))
+	if rolling == nil {
+		t.Fatal("expected a rolling summary file")
+	}
+	if rolling.summary != "respuesta 1" || rolling.covered != 2 {
+		t.Errorf("unexpected rolling summary: %+v", rolling)
+	}
+
+	// The next update only sends the new text, along with the summary so far.
+	if err := appendToFile(txtPath, "charlie\n"); err != nil {
+		t.Fatalf("failed to append to transcript: %v", err)
+	}
+	if err := recordChunkLines(cfg, title, 3, 1); err != nil {
+		t.Fatalf("recordChunkLines failed: %v", err)
+	}
+	if !r.chunksTranscribed(context.Background(), 2) {
+		t.Fatal("expected a second update")
+	}
+	prompt := llmClient.prompts[1]
+	if !strings.Contains(prompt, "respuesta 1") || !strings.Contains(prompt, "charlie") || strings.Contains(prompt, "bravo") {
+		t.Errorf("expected the previous summary and only the new text, got %q", prompt)
+	}
+}
+
+// blockingGenerator blocks on every prompt until its context is
+// cancelled, like a model that takes longer than a whole session.
+type blockingGenerator struct {
+	started chan struct{}
+	calls   atomic.Int32
+}
+
+func (g *blockingGenerator) Generate(ctx context.Context, req llm.Request) (string, error) {
+	g.calls.Add(1)
+	g.started <- struct{}{}
+	<-ctx.Done()
+	return "", ctx.Err()
+}
+
+func TestChunkerUpdatesRollingSummaryInBackground(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.LLM.RollingSummaryChunks = 1
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+
+	title := "2026-01-15 1430"
+	c, err := newChunker(cfg, title, "", audio.New(cfg.Audio, cfg.Paths.TempDir), &stubTranscriber{})
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+	if err := os.WriteFile(c.txtPath, []byte("alfa\n"), 0644); err != nil {
+		t.Fatalf("failed to write transcript: %v", err)
+	}
+	if err := recordChunkLines(cfg, title, 1, 1); err != nil {
+		t.Fatalf("recordChunkLines failed: %v", err)
+	}
+	generator := &blockingGenerator{started: make(chan struct{}, 1)}
+	c.rolling = newRollingSummarizer(cfg, newLLMClients(cfg.LLM, generator), title, "default")
+
+	c.updateRolling(context.Background(), 1)
+	select {
+	case <-generator.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the rolling summary update to start")
+	}
+
+	// Polling goes on while the update runs, and doesn't start another.
+	c.updateRolling(context.Background(), 1)
+	if !c.rollingBusy() || c.rollingPending != 1 {
+		t.Errorf("expected the chunk kept for the next update, got busy=%v pending=%d", c.rollingBusy(), c.rollingPending)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		c.stopRolling()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected stopping to cancel the update instead of waiting for the model")
+	}
+	if n := generator.calls.Load(); n != 1 {
+		t.Errorf("expected a single update, got %d", n)
+	}
+}
+
+func TestRollingSummarizerDisabled(t *testing.T) {
+	cfg := testConfig(t)
+	r := newRollingSummarizer(cfg, (&recordingGenerator{}).clients(), "2026-01-15 1430", "default")
+	if r != nil {
+		t.Fatal("expected no rolling summarizer without llm.rolling_summary_chunks")
+	}
+	if r.chunksTranscribed(context.Background(), 10) {
+		t.Error("a nil rolling summarizer should never update")
+	}
+}
+
+func TestSummarizeInPartsWithEarlierSummary(t *testing.T) {
+	prompts := mapReducePrompts{
+		mapPrompt:    promptFile{template: "MAP {{TRANSCRIPTION}}"},
+		reducePrompt: promptFile{template: "REDUCE {{SUMMARIES}}"},
+	}
+
+	llmClient := &recordingGenerator{}
+	if _, err := summarizeInParts(context.Background(), llmClient.clients(), prompts, "lo de antes", "lo nuevo", promptData{}, 100); err != nil {
+		t.Fatalf("summarizeInParts failed: %v", err)
+	}
+
+	expected := []string{
+		"MAP lo nuevo",
+		"REDUCE ### Parte 1\n\nlo de antes\n\n### Parte 2\n\nrespuesta 1",
+	}
+	if len(llmClient.prompts) != len(expected) {
+		t.Fatalf("expected %d prompts, got %q", len(expected), llmClient.prompts)
+	}
+	for i := range expected {
+		if llmClient.prompts[i] != expected[i] {
+			t.Errorf("prompt %d: expected %q, got %q", i, expected[i], llmClient.prompts[i])
+		}
+	}
+}
+
+// queueFailingTranscriber fails to transcribe chunks retried from the
+// queue while failQueued is set.
+type queueFailingTranscriber struct {
+	flakyTranscriber
+	queueDir   string
+	failQueued bool
+}
+
+func (q *queueFailingTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (transcribe.Result, error) {
+	if q.failQueued && strings.HasPrefix(audioPath, q.queueDir) {
+		return transcribe.Result{}, errors.New("backend unavailable")
+	}
+	return q.flakyTranscriber.Transcribe(ctx, audioPath, prompt)
+}
+
+func TestRollingSummaryTakesInRetriedChunks(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Transcription.Backend = "openai"
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.LLM.RollingSummaryChunks = 1
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+
+	title := "2026-01-15 1430"
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+	transcriber := &queueFailingTranscriber{flakyTranscriber: flakyTranscriber{stubTranscriber: stubTranscriber{texts: []string{"hola", "mundo", "tarde", "noche"}}}}
+	c, err := newChunker(cfg, title, "", recorder, transcriber)
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+	transcriber.queueDir = c.queueDir
+	llmClient := &recordingGenerator{}
+	c.rolling = newRollingSummarizer(cfg, llmClient.clients(), title, "default")
+
+	poll := func(i int) {
+		t.Helper()
+		chunk := filepath.Join(cfg.Paths.TempDir, fmt.Sprintf("chunk-mic-%03d.wav", i))
+		writeTestChunk(t, chunk)
+		appendSegmentListLine(t, recorder.MicSegmentList(), chunk)
+		if err := c.pollOnce(context.Background()); err != nil {
+			t.Fatalf("pollOnce failed: %v", err)
+		}
+	}
+
+	// The second chunk fails, and keeps failing on retry while the third
+	// is transcribed: the rolling summary takes in its marker and the
+	// third chunk.
+	poll(0)
+	transcriber.down = true
+	poll(1)
+	transcriber.down, transcriber.failQueued = false, true
+	poll(2)
+	if !c.rolling.chunksTranscribed(context.Background(), 3) {
+		t.Fatal("expected a rolling summary update")
+	}
+	if rolling := readRollingSummary(c.rolling.path); rolling == nil || rolling.covered != 3 || len(rolling.missing) != 0 {
+		t.Fatalf("expected the rolling summary to cover 3 chunks, got %+v", rolling)
+	}
+
+	// Its retry puts its text where the marker was, and the summary is
+	// left missing just that chunk.
+	transcriber.failQueued = false
+	poll(3)
+	raw, err := os.ReadFile(c.txtPath)
+	if err != nil || string(raw) != "hola\ntarde\nmundo\nnoche\n" {
+		t.Fatalf("expected the retried chunk in place of its marker, got %q (%v)", raw, err)
+	}
+	if rolling := readRollingSummary(c.rolling.path); rolling == nil || rolling.covered != 3 || !slices.Equal(rolling.missing, []int{2}) {
+		t.Fatalf("expected the rolling summary to be missing the retried chunk, got %+v", rolling)
+	}
+
+	// The final summary and the next update both take in the retried
+	// chunk and the new one, and none of what's already covered.
+	headStart := rollingHeadStart(cfg, title, raw)
+	if headStart == nil || headStart.rest != "tarde\nnoche" {
+		t.Errorf("expected only the retried and the new chunk after the rolling summary, got %+v", headStart)
+	}
+	if !c.rolling.chunksTranscribed(context.Background(), 1) {
+		t.Fatal("expected a second rolling summary update")
+	}
+	prompt := llmClient.prompts[1]
+	if !strings.Contains(prompt, "tarde\nnoche") || strings.Contains(prompt, "hola") || strings.Contains(prompt, "mundo") {
+		t.Errorf("expected the update to fold in only the retried and the new chunk, got %q", prompt)
+	}
+	if rolling := readRollingSummary(c.rolling.path); rolling == nil || rolling.covered != 4 || len(rolling.missing) != 0 {
+		t.Errorf("expected the rolling summary to cover all 4 chunks, got %+v", rolling)
+	}
+}
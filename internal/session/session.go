@@ -4,17 +4,17 @@ import (
 	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"os/signal"
 	"path/filepath"
-	"strings"
 	"syscall"
 	"time"
 
 	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
 	"github.com/sabhz/trani/internal/config"
 	"github.com/sabhz/trani/internal/llm"
 	"github.com/sabhz/trani/internal/transcribe"
+	"github.com/sabhz/trani/pkg/errlog"
 	"github.com/sabhz/trani/pkg/notify"
 )
 
@@ -28,9 +28,10 @@ type Session struct {
 
 	recorder    *audio.Recorder
 	transcriber transcribe.Transcriber
-	llm         llm.Generator
+	llm         *llmClients
 	notifier    *notify.Notifier
 	cfg         *config.Config
+	status      *statusPublisher
 }
 
 // Title returns the session's timestamp-based title (also the .sources/<title> basename).
@@ -66,7 +67,7 @@ func New(promptTemplate string, cfg *config.Config) (*Session, error) {
 		startedAt:      time.Now(),
 		recorder:       recorder,
 		transcriber:    transcriber,
-		llm:            llmClient,
+		llm:            newLLMClients(cfg.LLM, llmClient),
 		notifier:       notifier,
 		cfg:            cfg,
 	}, nil
@@ -78,6 +79,10 @@ func New(promptTemplate string, cfg *config.Config) (*Session, error) {
 // detached worker so the recording lock clears the moment recording stops,
 // letting a new session start immediately.
 func (s *Session) Start(ctx context.Context) error {
+	// The record worker ends with Start, and whatever the transcriber holds
+	// on to (a whisper.cpp server it started) with it.
+	defer transcribe.Close(s.transcriber)
+
 	if err := os.MkdirAll(s.cfg.Paths.SessionsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create sessions directory: %w", err)
 	}
@@ -86,6 +91,16 @@ func (s *Session) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to create temp directory: %w", err)
 	}
 
+	// Registered before the lock is taken: once it is, `trani pause` and
+	// `trani resume` can signal this process, and an unhandled SIGUSR1 or
+	// SIGUSR2 would kill it before it got as far as waiting for them. Signals
+	// that arrive while recording is still starting wait here until it has.
+	// Buffered past one so a stop sent while a pause or resume is still
+	// being handled isn't dropped.
+	sigCh := make(chan os.Signal, 4)
+	signal.Notify(sigCh, syscall.SIGTERM, pauseSignal, resumeSignal)
+	defer signal.Stop(sigCh)
+
 	// Acquired atomically and as early as possible: a plain
 	// check-then-write has a race where two near-simultaneous invocations
 	// can both start recording, with the loser silently orphaned (unable
@@ -113,6 +128,20 @@ func (s *Session) Start(ctx context.Context) error {
 		return err
 	}
 
+	s.status = newStatusPublisher(s.cfg, JobStatus{
+		Kind:      JobRecording,
+		Title:     s.title,
+		Stage:     StageRecording,
+		StartedAt: s.startedAt,
+		Mode:      s.cfg.Audio.Mode,
+		Prompt:    s.promptTemplate,
+	})
+	defer s.status.remove()
+	chunker.status = s.status
+	chunker.rolling = newRollingSummarizer(s.cfg, s.llm, s.title, s.promptTemplate)
+
+	logIndex(recordIndex(s.cfg, newIndexEntry(s.cfg, s.title, s.notePath, SourceSession, s.promptTemplate, s.startedAt)))
+
 	message := fmt.Sprintf("Grabación iniciada - %s", s.title)
 	notifyID, err := s.notifier.Start("🎙️ Trani", message)
 	if err != nil {
@@ -121,6 +150,7 @@ func (s *Session) Start(ctx context.Context) error {
 	s.notifyID = notifyID
 
 	lock.NotifyID = notifyID
+	lock.RecorderPIDs = s.recorder.PIDs()
 	if err := lock.update(s.cfg); err != nil {
 		s.recorder.Stop()
 		ClearLock(s.cfg)
@@ -142,10 +172,6 @@ func (s *Session) Start(ctx context.Context) error {
 		os.WriteFile(s.notePath, nil, 0644)
 	}
 
-	sigCh := make(chan os.Signal, 1)
-	signal.Notify(sigCh, syscall.SIGTERM)
-	defer signal.Stop(sigCh)
-
 	if err := openNote(ctx, s.notePath, s.cfg); err != nil {
 		stopChunker()
 		s.recorder.Stop()
@@ -153,10 +179,68 @@ func (s *Session) Start(ctx context.Context) error {
 		return fmt.Errorf("failed to open note: %w", err)
 	}
 
-	<-sigCh
+	s.waitForStop(ctx, lock, sigCh)
 	stopChunker()
 
-	return s.finishRecording(ctx, chunker)
+	return s.finishRecording(ctx, chunker, lock)
+}
+
+// waitForStop handles pause and resume requests until a stop signal
+// arrives. Pausing only stops capture: the chunker keeps its place, so
+// audio recorded after resuming continues the same transcript and archive
+// instead of starting a new session. A failed pause or resume is reported
+// and leaves the session as it was, still stoppable.
+func (s *Session) waitForStop(ctx context.Context, lock *RecordingLock, sigCh <-chan os.Signal) {
+	for sig := range sigCh {
+		switch sig {
+		case pauseSignal:
+			if lock.Paused {
+				continue
+			}
+			if err := s.recorder.Pause(); err != nil {
+				s.notifier.Error("⚠️ Trani", fmt.Sprintf("Error al pausar la grabación: %v", err))
+				errlog.Error("session_pause", s.title, err)
+				continue
+			}
+			lock.markPaused(time.Now())
+			lock.RecorderPIDs = nil
+			if err := lock.update(s.cfg); err != nil {
+				errlog.Error("session_pause", s.title, err)
+			}
+			s.status.setStage(StagePaused)
+			s.notifyProgress("⏸️ Trani", fmt.Sprintf("Grabación en pausa - %s", s.title))
+
+		case resumeSignal:
+			if !lock.Paused {
+				continue
+			}
+			if err := s.recorder.Resume(ctx); err != nil {
+				s.notifier.Error("⚠️ Trani", fmt.Sprintf("Error al reanudar la grabación: %v", err))
+				errlog.Error("session_resume", s.title, err)
+				continue
+			}
+			lock.markResumed(time.Now())
+			lock.RecorderPIDs = s.recorder.PIDs()
+			if err := lock.update(s.cfg); err != nil {
+				errlog.Error("session_resume", s.title, err)
+			}
+			s.status.setStage(StageRecording)
+			s.notifyProgress("🎙️ Trani", fmt.Sprintf("Grabación reanudada - %s", s.title))
+
+		default:
+			return
+		}
+	}
+}
+
+// notifyProgress updates the session's notification in place, or sends a
+// new one if the initial notification didn't return an ID.
+func (s *Session) notifyProgress(title, message string) {
+	if s.notifyID != "" {
+		s.notifier.Update(s.notifyID, title, message)
+	} else {
+		s.notifier.Info(title, message)
+	}
 }
 
 // finishRecording stops the recorder and clears the recording lock right
@@ -165,35 +249,42 @@ func (s *Session) Start(ctx context.Context) error {
 // of waiting on a network call. It then does one last pass to pick up
 // whatever chunk was still open and hands off summarization to a detached
 // post-processing worker.
-func (s *Session) finishRecording(ctx context.Context, chunker *chunker) error {
+func (s *Session) finishRecording(ctx context.Context, chunker *chunker, lock *RecordingLock) error {
 	if err := s.recorder.Stop(); err != nil {
 		return fmt.Errorf("failed to stop recording: %w", err)
 	}
 
+	now := time.Now()
+	logIndex(updateIndex(s.cfg, s.title, func(e *IndexEntry) {
+		e.EndedAt = now
+		e.DurationSeconds = (now.Sub(lock.StartedAt) - lock.PausedDuration(now)).Seconds()
+		e.Status = IndexSummarizing
+	}))
+
 	if err := ClearLock(s.cfg); err != nil {
 		return err
 	}
 
+	s.status.setStage(StageFinalChunk)
 	if err := chunker.pollOnce(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "trani: chunk processing error: %v\n", err)
 	}
-
-	if s.notifyID != "" {
-		s.notifier.Update(s.notifyID, "⏸️ Trani", "Grabación detenida. Procesando...")
-	} else {
-		s.notifier.Info("⏸️ Trani", "Grabación detenida. Procesando...")
+	if failed := chunker.abandonQueued(); failed > 0 {
+		s.notifier.Error("⚠️ Trani", fmt.Sprintf("%d fragmento(s) sin transcribir en %s", failed, s.title))
 	}
 
+	s.notifyProgress("⏸️ Trani", "Grabación detenida. Procesando...")
+
 	return SpawnPostprocess(s.notePath, s.title, s.promptTemplate, s.notifyID)
 }
 
 const defaultPromptWithNotes = `Tienes una transcripción de una sesión y las notas tomadas por el usuario.
 
 TRANSCRIPCIÓN:
-{{TRANSCRIPTION}}
+{{.Transcription}}
 
 NOTAS DEL USUARIO:
-{{NOTES}}
+{{.Notes}}
 
 Genera un documento markdown estructurado con:
 
@@ -222,12 +313,104 @@ Genera un documento markdown estructurado con:
    - Nombres de personas referenciadas
    - Documentos, sistemas o herramientas mencionadas
 
+Si las líneas de la transcripción empiezan con una etiqueta de quién habla (por ejemplo "Yo:" u "Otros:"), úsala para atribuir decisiones y action items al lado correcto de la conversación.
+
 Mantén el formato limpio y profesional. Usa encabezados claros.`
 
 const defaultPromptNoNotes = `Tienes la transcripción de una sesión. Analízala y genera un documento estructurado.
 
 TRANSCRIPCIÓN:
-{{TRANSCRIPTION}}
+{{.Transcription}}
+
+Genera un documento markdown con:
+
+1. RESUMEN EJECUTIVO (2-3 párrafos)
+   - Tema principal de la sesión
+   - Puntos clave discutidos
+   - Conclusiones principales
+
+2. TEMAS PRINCIPALES
+   Identifica los temas principales discutidos y para cada uno incluye:
+   - Contexto y detalles
+   - Puntos específicos mencionados
+   - Decisiones o conclusiones
+
+3. ACCIONES Y PENDIENTES
+   - Action items identificados
+   - Responsables (si se mencionan)
+   - Fechas límite (si se mencionan)
+
+4. DATOS IMPORTANTES
+   - Fechas mencionadas
+   - Números, métricas
+   - Nombres de personas
+   - Referencias a documentos/sistemas
+
+Si las líneas de la transcripción empiezan con una etiqueta de quién habla (por ejemplo "Yo:" u "Otros:"), úsala para atribuir decisiones y action items al lado correcto de la conversación.
+
+Mantén el formato limpio y profesional.`
+
+// Prompts for summarizing a transcript too long for one request (see
+// summarizeInParts): each part is summarized with the map prompt, then the
+// final document is built from the partial summaries with a reduce prompt.
+const defaultMapPrompt = `Tienes un fragmento (parte {{.Part}} de {{.Parts}}) de una sesión larga: su transcripción, o resúmenes de partes anteriores de ella.
+
+FRAGMENTO:
+{{.Transcription}}
+
+Resume este fragmento para que luego pueda combinarse con los resúmenes de las demás partes. Conserva:
+- Temas tratados y lo dicho sobre cada uno
+- Decisiones tomadas
+- Action items, responsables y fechas límite
+- Fechas, números, nombres de personas, documentos y sistemas mencionados
+
+Si las líneas empiezan con una etiqueta de quién habla (por ejemplo "Yo:" u "Otros:"), consérvala al atribuir decisiones y action items.
+
+No agregues introducciones ni conclusiones propias: solo el contenido del fragmento, en markdown.`
+
+const defaultReducePromptWithNotes = `Tienes los resúmenes parciales, en orden, de una sesión larga y las notas tomadas por el usuario.
+
+RESÚMENES PARCIALES:
+{{.Summaries}}
+
+NOTAS DEL USUARIO:
+{{.Notes}}
+
+Genera un documento markdown estructurado con:
+
+1. RESUMEN EJECUTIVO (2-3 párrafos)
+   - Contexto general de la sesión
+   - Puntos clave discutidos
+   - Conclusiones principales
+
+2. DETALLES POR TEMA
+   Usa los temas de las notas del usuario como estructura.
+   Para cada tema identifica en los resúmenes parciales:
+   - Detalles específicos mencionados
+   - Datos, fechas, números relevantes
+   - Procesos o procedimientos descritos
+   - Decisiones tomadas
+   - Contexto adicional importante
+
+3. ACCIONES Y PENDIENTES
+   - Action items identificados
+   - Responsables (si se mencionan)
+   - Fechas límite (si se mencionan)
+
+4. DATOS IMPORTANTES
+   - Fechas clave mencionadas
+   - Números, métricas, estadísticas
+   - Nombres de personas referenciadas
+   - Documentos, sistemas o herramientas mencionadas
+
+Un mismo tema puede aparecer en varias partes: combínalo en una sola sección.
+
+Mantén el formato limpio y profesional. Usa encabezados claros.`
+
+const defaultReducePromptNoNotes = `Tienes los resúmenes parciales, en orden, de una sesión larga. Combínalos en un documento estructurado.
+
+RESÚMENES PARCIALES:
+{{.Summaries}}
 
 Genera un documento markdown con:
 
@@ -253,59 +436,127 @@ Genera un documento markdown con:
    - Nombres de personas
    - Referencias a documentos/sistemas
 
+Un mismo tema puede aparecer en varias partes: combínalo en una sola sección.
+
 Mantén el formato limpio y profesional.`
 
+// defaultRollingPrompt updates a live session's rolling summary (see
+// rollingSummarizer) with the text transcribed since its last update.
+const defaultRollingPrompt = `Estás resumiendo una sesión que todavía está en curso, para que alguien que llega tarde pueda ponerse al día.
+
+RESUMEN HASTA AHORA:
+{{.Summary}}
+
+NUEVA TRANSCRIPCIÓN:
+{{.Transcription}}
+
+Actualiza el resumen hasta ahora incorporando la nueva transcripción (si el resumen está vacío, créalo). Devuelve solo el resumen actualizado, en markdown, con:
+- Temas tratados hasta el momento y lo dicho sobre cada uno
+- Decisiones tomadas
+- Action items, con responsables y fechas límite si se mencionan
+- El tema que se está tratando ahora
+
+Si las líneas empiezan con una etiqueta de quién habla (por ejemplo "Yo:" u "Otros:"), úsala al atribuir decisiones y action items.
+
+Sé conciso: el resumen debe seguir siendo breve aunque la sesión sea larga.`
+
+// defaultActionItemsPrompt asks for a session's action items as the JSON
+// parseActionItems checks (see actionItem).
+const defaultActionItemsPrompt = `Extrae los action items de esta sesión del {{.Date}}: tareas concretas que alguien se comprometió a hacer o a las que se asignó a alguien.
+
+TRANSCRIPCIÓN:
+{{.Transcription}}
+{{if .Notes}}
+NOTAS DEL USUARIO:
+{{.Notes}}
+{{end}}
+Responde solo con un objeto JSON, sin texto antes ni después, con esta forma:
+
+{"items": [{"task": "Enviar el presupuesto revisado", "owner": "Ana", "due": "2026-01-20"}]}
+
+- "task": qué hay que hacer, en una frase breve que se entienda sin el contexto de la sesión
+- "owner": quién es responsable, tal como se lo nombra; "" si no se dijo
+- "due": la fecha límite como AAAA-MM-DD, calculada a partir de la fecha de la sesión si se dijo de forma relativa ("el viernes"); "" si no hay
+
+Si las líneas empiezan con una etiqueta de quién habla (por ejemplo "Yo:" u "Otros:"), úsala para el responsable. Si no hay action items, responde {"items": []}.`
+
+// defaultTitlePrompt asks for a session's title and tags as the JSON
+// parseTitleAndTags checks (see titleAndTags).
+const defaultTitlePrompt = `Ponle un título y etiquetas a esta sesión del {{.Date}}, para encontrarla luego entre muchas otras.
+
+TRANSCRIPCIÓN:
+{{.Transcription}}
+{{if .Notes}}
+NOTAS DEL USUARIO:
+{{.Notes}}
+{{end}}
+Responde solo con un objeto JSON, sin texto antes ni después, con esta forma:
+
+{"title": "Planificación del presupuesto del Q1", "tags": ["planificacion", "presupuesto"]}
+
+- "title": de qué trató la sesión, en pocas palabras (como mucho 60 caracteres), sin la fecha
+- "tags": entre 2 y 5 temas, proyectos o clientes principales, en minúsculas y con guiones en lugar de espacios`
+
+// ensureDefaultPrompts writes the default prompt templates into promptsDir,
+// leaving any the user already has (possibly edited) alone.
 func ensureDefaultPrompts(promptsDir string) error {
 	if err := os.MkdirAll(promptsDir, 0755); err != nil {
 		return fmt.Errorf("failed to create prompts directory: %w", err)
 	}
 
-	defaultPath := filepath.Join(promptsDir, "default.txt")
-	if _, err := os.Stat(defaultPath); os.IsNotExist(err) {
-		if err := os.WriteFile(defaultPath, []byte(defaultPromptWithNotes), 0644); err != nil {
-			return fmt.Errorf("failed to write default.txt: %w", err)
-		}
-	}
-
-	defaultNoNotesPath := filepath.Join(promptsDir, "default_no_notes.txt")
-	if _, err := os.Stat(defaultNoNotesPath); os.IsNotExist(err) {
-		if err := os.WriteFile(defaultNoNotesPath, []byte(defaultPromptNoNotes), 0644); err != nil {
-			return fmt.Errorf("failed to write default_no_notes.txt: %w", err)
+	for _, prompt := range []struct{ filename, content string }{
+		{"default.txt", defaultPromptWithNotes},
+		{"default_no_notes.txt", defaultPromptNoNotes},
+		{"default_map.txt", defaultMapPrompt},
+		{"default_reduce.txt", defaultReducePromptWithNotes},
+		{"default_reduce_no_notes.txt", defaultReducePromptNoNotes},
+		{"default_rolling.txt", defaultRollingPrompt},
+		{"default_action_items.txt", defaultActionItemsPrompt},
+		{"default_title.txt", defaultTitlePrompt},
+	} {
+		path := filepath.Join(promptsDir, prompt.filename)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := os.WriteFile(path, []byte(prompt.content), 0644); err != nil {
+				return fmt.Errorf("failed to write %s: %w", prompt.filename, err)
+			}
 		}
 	}
 
 	return nil
 }
 
-// fillPromptTemplate replaces {{TRANSCRIPTION}} and {{NOTES}} placeholders.
-func fillPromptTemplate(template, transcription, notes string) string {
-	result := strings.ReplaceAll(template, "{{TRANSCRIPTION}}", transcription)
-	result = strings.ReplaceAll(result, "{{NOTES}}", notes)
-	return result
-}
-
-// runSox invokes sox with the given arguments.
-func runSox(args ...string) error {
-	output, err := exec.CommandContext(context.Background(), "sox", args...).CombinedOutput()
+// postProcessAudio downsamples a raw chunk to 16kHz mono, filters out
+// low-frequency rumble and high-frequency noise, and normalizes it to full
+// scale, replacing the file in place.
+func postProcessAudio(audioPath string) error {
+	a, err := wav.Read(audioPath)
 	if err != nil {
-		return fmt.Errorf("sox failed: %w: %s", err, strings.TrimSpace(string(output)))
+		return fmt.Errorf("failed to read audio: %w", err)
 	}
-	return nil
+
+	a = wav.Downmix(a)
+	a = wav.HighPass(a, 80)
+	a = wav.LowPass(a, 8000)
+	a = wav.Resample(a, 16000)
+	a = wav.Normalize(a)
+
+	return writeAudioReplacing(audioPath, a)
 }
 
-// postProcessAudio downsample to 16kHz mono and normalize audio.
-func postProcessAudio(audioPath string) error {
-	tempPath := audioPath + ".tmp.wav"
+// writeAudioReplacing writes a to a temporary file next to path and then
+// renames it over path, so a failed write never leaves path half-written.
+func writeAudioReplacing(path string, a *wav.Audio) error {
+	tempPath := path + ".tmp.wav"
 
-	if err := runSox(audioPath, "-r", "16000", "-c", "1", tempPath, "norm", "highpass", "80", "lowpass", "8000"); err != nil {
-		return err
+	if err := wav.Write(tempPath, a); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("failed to write audio: %w", err)
 	}
 
-	if err := os.Rename(tempPath, audioPath); err != nil {
+	if err := os.Rename(tempPath, path); err != nil {
 		os.Remove(tempPath)
 		return fmt.Errorf("failed to replace audio file: %w", err)
 	}
 
 	return nil
 }
-
@@ -7,6 +7,7 @@ import (
 	"syscall"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/notify"
 )
 
 // spawnDetached launches trani with the given hidden-subcommand args as an
@@ -78,5 +79,18 @@ func Launch(promptTemplate string, cfg *config.Config) error {
 		return fmt.Errorf("session already active: %s", lock.Title)
 	}
 
+	// Recoverable sessions are kept out of TempDir, so starting a new one
+	// doesn't put them at risk; the user just needs to know they're there.
+	// A stale lock counts too: the new session stashes it as it starts.
+	recoverable, _ := ListRecoverable(cfg)
+	pending := len(recoverable)
+	if stale, _ := StaleLock(cfg); stale != nil {
+		pending++
+	}
+	if pending > 0 {
+		fmt.Fprintf(os.Stderr, "trani: %d unfinished session(s) can be recovered with `trani recover`\n", pending)
+		notify.New().Info("⚠️ Trani", fmt.Sprintf("Hay %d sesión(es) sin terminar. Ejecuta «trani recover» para recuperarlas.", pending))
+	}
+
 	return SpawnRecorder(promptTemplate)
 }
@@ -0,0 +1,84 @@
+package session
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+// attributeSpeakers combines the separately transcribed mic and system
+// streams of one chunk into a single speaker-labeled transcript: the mic
+// is always the local user, the system output everyone else on the call.
+// Segments from both streams are interleaved in time order, and each
+// segment's text is prefixed with its label, so the subtitles carry it too.
+// In the plain text, consecutive segments from the same side are joined
+// into one "<label>: ..." line per turn.
+//
+// A backend that returns no segment timing can't be interleaved, so its
+// streams fall back to one labeled block each, mic first.
+func attributeSpeakers(mic, system transcribe.Result, micLabel, systemLabel string) transcribe.Result {
+	if missingTiming(mic) || missingTiming(system) {
+		return transcribe.Result{Text: labeledBlocks(mic.Text, system.Text, micLabel, systemLabel)}
+	}
+
+	type turn struct {
+		label string
+		seg   transcribe.Segment
+	}
+
+	var turns []turn
+	for _, s := range mic.Segments {
+		turns = append(turns, turn{micLabel, s})
+	}
+	for _, s := range system.Segments {
+		turns = append(turns, turn{systemLabel, s})
+	}
+	sort.SliceStable(turns, func(i, j int) bool {
+		return turns[i].seg.Start < turns[j].seg.Start
+	})
+
+	var lines []string
+	var segments []transcribe.Segment
+	prevLabel := ""
+	for _, t := range turns {
+		text := strings.TrimSpace(t.seg.Text)
+		if text == "" {
+			continue
+		}
+
+		segments = append(segments, transcribe.Segment{
+			Start: t.seg.Start,
+			End:   t.seg.End,
+			Text:  t.label + ": " + text,
+		})
+
+		if t.label == prevLabel {
+			lines[len(lines)-1] += " " + text
+		} else {
+			lines = append(lines, t.label+": "+text)
+		}
+		prevLabel = t.label
+	}
+
+	return transcribe.Result{Text: strings.Join(lines, "\n"), Segments: segments}
+}
+
+// missingTiming reports whether a stream has speech but no segments to
+// place it in time.
+func missingTiming(r transcribe.Result) bool {
+	return strings.TrimSpace(r.Text) != "" && len(r.Segments) == 0
+}
+
+// labeledBlocks is attributeSpeakers' fallback without timing: each
+// stream's whole text as one labeled line, skipping an empty stream.
+func labeledBlocks(micText, systemText, micLabel, systemLabel string) string {
+	var lines []string
+	if t := strings.Join(strings.Fields(micText), " "); t != "" {
+		lines = append(lines, micLabel+": "+t)
+	}
+	if t := strings.Join(strings.Fields(systemText), " "); t != "" {
+		lines = append(lines, systemLabel+": "+t)
+	}
+	return strings.Join(lines, "\n")
+}
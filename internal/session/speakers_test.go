@@ -0,0 +1,84 @@
+package session
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+func seg(startSec, endSec float64, text string) transcribe.Segment {
+	return transcribe.Segment{
+		Start: time.Duration(startSec * float64(time.Second)),
+		End:   time.Duration(endSec * float64(time.Second)),
+		Text:  text,
+	}
+}
+
+func TestAttributeSpeakersInterleavesByTime(t *testing.T) {
+	mic := transcribe.Result{
+		Text:     "Hola. ¿Me escuchan? Perfecto.",
+		Segments: []transcribe.Segment{seg(0, 1, "Hola."), seg(1, 2, "¿Me escuchan?"), seg(5, 6, "Perfecto.")},
+	}
+	system := transcribe.Result{
+		Text:     "Sí, fuerte y claro.",
+		Segments: []transcribe.Segment{seg(2.5, 4, "Sí, fuerte y claro.")},
+	}
+
+	got := attributeSpeakers(mic, system, "Yo", "Otros")
+
+	expectedText := "Yo: Hola. ¿Me escuchan?\nOtros: Sí, fuerte y claro.\nYo: Perfecto."
+	if got.Text != expectedText {
+		t.Errorf("expected text %q, got %q", expectedText, got.Text)
+	}
+
+	if len(got.Segments) != 4 {
+		t.Fatalf("expected 4 labeled segments, got %d", len(got.Segments))
+	}
+	if got.Segments[2].Text != "Otros: Sí, fuerte y claro." || got.Segments[2].Start != 2500*time.Millisecond {
+		t.Errorf("unexpected third segment: %+v", got.Segments[2])
+	}
+}
+
+func TestAttributeSpeakersCustomLabels(t *testing.T) {
+	mic := transcribe.Result{Text: "a", Segments: []transcribe.Segment{seg(0, 1, "a")}}
+	system := transcribe.Result{Text: "b", Segments: []transcribe.Segment{seg(1, 2, "b")}}
+
+	got := attributeSpeakers(mic, system, "Abraham", "Cliente")
+
+	if got.Text != "Abraham: a\nCliente: b" {
+		t.Errorf("unexpected text %q", got.Text)
+	}
+}
+
+func TestAttributeSpeakersOneSilentStream(t *testing.T) {
+	mic := transcribe.Result{Text: "solo yo", Segments: []transcribe.Segment{seg(0, 1, "solo yo")}}
+
+	got := attributeSpeakers(mic, transcribe.Result{}, "Yo", "Otros")
+
+	if got.Text != "Yo: solo yo" {
+		t.Errorf("unexpected text %q", got.Text)
+	}
+}
+
+func TestAttributeSpeakersWithoutTimingFallsBackToBlocks(t *testing.T) {
+	// e.g. a backend that can't report segment timing at all.
+	mic := transcribe.Result{Text: "Hola.\n¿Me escuchan?"}
+	system := transcribe.Result{Text: "Sí."}
+
+	got := attributeSpeakers(mic, system, "Yo", "Otros")
+
+	if got.Text != "Yo: Hola. ¿Me escuchan?\nOtros: Sí." {
+		t.Errorf("unexpected text %q", got.Text)
+	}
+	if len(got.Segments) != 0 {
+		t.Errorf("expected no segments without timing, got %d", len(got.Segments))
+	}
+}
+
+func TestAttributeSpeakersBothSilent(t *testing.T) {
+	got := attributeSpeakers(transcribe.Result{}, transcribe.Result{}, "Yo", "Otros")
+	if got.Text != "" || len(got.Segments) != 0 {
+		t.Errorf("expected an empty result, got %+v", got)
+	}
+}
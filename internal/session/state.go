@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/errlog"
 )
 
 // RecordingLock is the on-disk marker for an in-progress recording. It only
@@ -22,6 +23,52 @@ type RecordingLock struct {
 	StartedAt      time.Time `json:"started_at"`
 	PromptTemplate string    `json:"prompt_template"`
 	NotifyID       string    `json:"notify_id"`
+
+	// Paused is set while capture is suspended by `trani pause`. Every
+	// pause, including the current one, is kept in PausedIntervals; the
+	// current one has no End yet.
+	Paused          bool            `json:"paused,omitempty"`
+	PausedIntervals []PauseInterval `json:"paused_intervals,omitempty"`
+
+	// RecorderPIDs are the ffmpeg captures of the current run. ffmpeg
+	// outlives this process if it's killed, so a stale lock's captures are
+	// stopped before its chunks are stashed for recovery.
+	RecorderPIDs []int `json:"recorder_pids,omitempty"`
+}
+
+// PauseInterval is one stretch of a session during which capture was
+// paused. End is zero while the pause is still ongoing.
+type PauseInterval struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end,omitzero"`
+}
+
+// markPaused records the start of a pause at now.
+func (l *RecordingLock) markPaused(now time.Time) {
+	l.Paused = true
+	l.PausedIntervals = append(l.PausedIntervals, PauseInterval{Start: now})
+}
+
+// markResumed closes the ongoing pause at now.
+func (l *RecordingLock) markResumed(now time.Time) {
+	l.Paused = false
+	if n := len(l.PausedIntervals); n > 0 && l.PausedIntervals[n-1].End.IsZero() {
+		l.PausedIntervals[n-1].End = now
+	}
+}
+
+// PausedDuration is the total time spent paused up to now, counting an
+// ongoing pause up to now.
+func (l *RecordingLock) PausedDuration(now time.Time) time.Duration {
+	var total time.Duration
+	for _, interval := range l.PausedIntervals {
+		end := interval.End
+		if end.IsZero() {
+			end = now
+		}
+		total += end.Sub(interval.Start)
+	}
+	return total
 }
 
 func lockPath(cfg *config.Config) string {
@@ -47,7 +94,8 @@ func (l *RecordingLock) Acquire(cfg *config.Config) error {
 	path := lockPath(cfg)
 
 	// Retry once: the first attempt may lose to a genuinely stale lock
-	// (owning process no longer alive), which ReadLock clears on read.
+	// (owning process no longer alive), which is stashed for recovery
+	// first.
 	for attempt := 0; attempt < 2; attempt++ {
 		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
 		if err == nil {
@@ -65,15 +113,24 @@ func (l *RecordingLock) Acquire(cfg *config.Config) error {
 			return fmt.Errorf("failed to create recording lock: %w", err)
 		}
 
-		existing, readErr := ReadLock(cfg)
+		existing, readErr := readLock(cfg)
 		if readErr != nil {
 			return readErr
 		}
-		if existing != nil {
+		if existing != nil && isProcessAlive(existing.PID) {
 			return fmt.Errorf("session already active: %s", existing.Title)
 		}
-		// existing == nil means ReadLock found the lock stale and removed
-		// it; loop around and try to create it again.
+		if existing != nil {
+			// The recording process died without finishing its session
+			// (OOM, logout, reboot). Keep what it left behind for `trani
+			// recover` rather than discarding it; failing that, the lock
+			// still has to go so a new session can start.
+			if _, err := StashStaleSession(cfg); err != nil {
+				errlog.Error("session_stash", existing.Title, err)
+				os.Remove(lockPath(cfg))
+			}
+		}
+		// Loop around and try to create it again.
 	}
 
 	return fmt.Errorf("failed to acquire recording lock")
@@ -95,8 +152,30 @@ func (l *RecordingLock) update(cfg *config.Config) error {
 }
 
 // ReadLock returns the active recording lock, or nil if there is none. A
-// lock whose PID is no longer alive is treated as stale and removed.
+// lock whose PID is no longer alive is stale and reads as no lock, but is
+// left in place: only starting a session or `trani recover` stash it (see
+// StashStaleSession), so that looking at the lock never has side effects.
 func ReadLock(cfg *config.Config) (*RecordingLock, error) {
+	lock, err := readLock(cfg)
+	if err != nil || lock == nil || !isProcessAlive(lock.PID) {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// StaleLock returns the recording lock if its process is no longer alive,
+// or nil if there's no lock or it's live.
+func StaleLock(cfg *config.Config) (*RecordingLock, error) {
+	lock, err := readLock(cfg)
+	if err != nil || lock == nil || isProcessAlive(lock.PID) {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// readLock reads the recording lock as it is, live or not, or nil if there
+// is none.
+func readLock(cfg *config.Config) (*RecordingLock, error) {
 	data, err := os.ReadFile(lockPath(cfg))
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -109,12 +188,6 @@ func ReadLock(cfg *config.Config) (*RecordingLock, error) {
 	if err := json.Unmarshal(data, &lock); err != nil {
 		return nil, fmt.Errorf("failed to parse recording lock: %w", err)
 	}
-
-	if !isProcessAlive(lock.PID) {
-		os.Remove(lockPath(cfg))
-		return nil, nil
-	}
-
 	return &lock, nil
 }
 
@@ -126,14 +199,42 @@ func ClearLock(cfg *config.Config) error {
 	return nil
 }
 
+// Signals the recording process listens for, besides SIGTERM (stop).
+const (
+	pauseSignal  = syscall.SIGUSR1
+	resumeSignal = syscall.SIGUSR2
+)
+
 // SignalStop asks the process holding the lock to stop recording.
 func SignalStop(lock *RecordingLock) error {
+	return signalRecorder(lock, syscall.SIGTERM)
+}
+
+// SignalPause asks the process holding the lock to pause capture without
+// ending the session.
+func SignalPause(lock *RecordingLock) error {
+	if lock.Paused {
+		return fmt.Errorf("session already paused: %s", lock.Title)
+	}
+	return signalRecorder(lock, pauseSignal)
+}
+
+// SignalResume asks the process holding the lock to resume a paused
+// capture.
+func SignalResume(lock *RecordingLock) error {
+	if !lock.Paused {
+		return fmt.Errorf("session is not paused: %s", lock.Title)
+	}
+	return signalRecorder(lock, resumeSignal)
+}
+
+func signalRecorder(lock *RecordingLock, sig os.Signal) error {
 	process, err := os.FindProcess(lock.PID)
 	if err != nil {
 		return fmt.Errorf("failed to find recording process: %w", err)
 	}
 
-	if err := process.Signal(syscall.SIGTERM); err != nil {
+	if err := process.Signal(sig); err != nil {
 		return fmt.Errorf("failed to signal recording process: %w", err)
 	}
 
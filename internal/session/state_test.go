@@ -2,20 +2,47 @@ package session
 
 import (
 	"os"
+	"path/filepath"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/sabhz/trani/internal/config"
 )
 
+// TestMain keeps the errlog lines of tests that don't use testConfig out
+// of the real log.
+func TestMain(m *testing.M) {
+	home, err := os.MkdirTemp("", "trani-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
 func testConfig(t *testing.T) *config.Config {
 	t.Helper()
+	t.Setenv("HOME", t.TempDir())
 	return &config.Config{
-		Paths: config.PathsConfig{TempDir: t.TempDir()},
+		Paths: config.PathsConfig{TempDir: t.TempDir(), SessionsDir: t.TempDir()},
 	}
 }
 
+// testLog returns what was logged through errlog under the $HOME
+// testConfig set.
+func testLog(t *testing.T) string {
+	t.Helper()
+	log, err := os.ReadFile(filepath.Join(os.Getenv("HOME"), ".config", "trani", "logs.jsonl"))
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatalf("failed to read the log: %v", err)
+	}
+	return string(log)
+}
+
 func TestAcquireOnlyOneWinnerUnderConcurrency(t *testing.T) {
 	cfg := testConfig(t)
 
@@ -94,3 +121,60 @@ func TestAcquireReplacesStaleLock(t *testing.T) {
 		t.Errorf("expected the fresh lock to be in place, got: %+v", lock)
 	}
 }
+
+func TestPauseIntervalsAccumulate(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	lock := &RecordingLock{StartedAt: start}
+
+	lock.markPaused(start.Add(10 * time.Minute))
+	lock.markResumed(start.Add(15 * time.Minute))
+	lock.markPaused(start.Add(30 * time.Minute))
+
+	if !lock.Paused {
+		t.Error("lock should be paused")
+	}
+	if len(lock.PausedIntervals) != 2 {
+		t.Fatalf("expected 2 pause intervals, got %d", len(lock.PausedIntervals))
+	}
+	if !lock.PausedIntervals[1].End.IsZero() {
+		t.Error("ongoing pause should have no end yet")
+	}
+
+	// 5 minutes of the first pause plus 3 of the ongoing one.
+	if got := lock.PausedDuration(start.Add(33 * time.Minute)); got != 8*time.Minute {
+		t.Errorf("expected 8m paused, got %v", got)
+	}
+
+	lock.markResumed(start.Add(40 * time.Minute))
+	if lock.Paused {
+		t.Error("lock should no longer be paused")
+	}
+	if got := lock.PausedDuration(start.Add(time.Hour)); got != 15*time.Minute {
+		t.Errorf("expected 15m paused, got %v", got)
+	}
+}
+
+func TestPauseStateSurvivesLockRoundTrip(t *testing.T) {
+	cfg := testConfig(t)
+
+	lock := &RecordingLock{PID: os.Getpid(), Title: "paused"}
+	if err := lock.Acquire(cfg); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	lock.markPaused(time.Now())
+	if err := lock.update(cfg); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	read, err := ReadLock(cfg)
+	if err != nil {
+		t.Fatalf("ReadLock failed: %v", err)
+	}
+	if read == nil || !read.Paused || len(read.PausedIntervals) != 1 {
+		t.Errorf("expected the paused state to be read back, got: %+v", read)
+	}
+
+	if err := SignalPause(read); err == nil {
+		t.Error("SignalPause should refuse an already paused session")
+	}
+}
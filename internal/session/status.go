@@ -0,0 +1,251 @@
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+)
+
+// Kinds of background job that publish a status file.
+const (
+	JobRecording   = "recording"
+	JobPostprocess = "postprocess"
+)
+
+// Stages a job reports while it runs.
+const (
+	StageRecording        = "recording"
+	StagePaused           = "paused"
+	StageFinalChunk       = "transcribing_final_chunk"
+	StageSummarizing      = "summarizing"
+	StageTitleAndTags     = "generating_title"
+	StageActionItems      = "extracting_action_items"
+	StageCompressingAudio = "compressing_audio"
+)
+
+// JobStatus is what a detached trani process publishes about itself, so
+// `trani status` can show what's going on in processes that otherwise have
+// no visible output.
+type JobStatus struct {
+	PID       int       `json:"pid"`
+	Kind      string    `json:"kind"`
+	Title     string    `json:"title"`
+	Stage     string    `json:"stage"`
+	StartedAt time.Time `json:"started_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// Recording only.
+	Mode              string    `json:"mode,omitempty"`
+	Prompt            string    `json:"prompt,omitempty"`
+	ChunksClosed      int       `json:"chunks_closed,omitempty"`
+	ChunksTranscribed int       `json:"chunks_transcribed,omitempty"`
+	ChunksQueued      int       `json:"chunks_queued,omitempty"` // failed, awaiting retry
+	LastChunkError    string    `json:"last_chunk_error,omitempty"`
+	LastChunkErrorAt  time.Time `json:"last_chunk_error_at,omitzero"`
+	RollingSummary    string    `json:"rolling_summary,omitempty"`
+	RollingSummaryAt  time.Time `json:"rolling_summary_at,omitzero"`
+	LastChunkSpeech   *float64  `json:"last_chunk_speech_ratio,omitempty"` // with audio.vad, from 0 to 1
+
+	// Filled in by ReadStatus from the recording lock, never published.
+	Paused         bool    `json:"paused,omitempty"`
+	ElapsedSeconds float64 `json:"elapsed_seconds,omitempty"`
+}
+
+// Status is everything trani is doing right now.
+type Status struct {
+	Recording *JobStatus `json:"recording"`
+
+	// Postprocess lists what's still running in the background once
+	// recording has stopped: postprocess workers, and a recording worker
+	// that has cleared its lock but is still transcribing its final chunk
+	// (Kind JobRecording, Stage StageFinalChunk).
+	Postprocess []JobStatus `json:"postprocess"`
+}
+
+func statusDir(cfg *config.Config) string {
+	return filepath.Join(cfg.Paths.TempDir, "status")
+}
+
+// statusPublisher keeps one process's status file up to date. Methods are
+// safe to call concurrently (the chunker publishes from its own goroutine)
+// and on a nil publisher, which publishes nothing.
+type statusPublisher struct {
+	mu     sync.Mutex
+	path   string
+	status JobStatus
+}
+
+// newStatusPublisher writes the initial status for the current process,
+// first removing the status files left behind by processes that are no
+// longer alive. Failing to publish is never fatal to the job itself, so
+// errors are only reported on stderr.
+func newStatusPublisher(cfg *config.Config, status JobStatus) *statusPublisher {
+	status.PID = os.Getpid()
+	p := &statusPublisher{
+		path:   filepath.Join(statusDir(cfg), fmt.Sprintf("%d.json", status.PID)),
+		status: status,
+	}
+
+	if err := os.MkdirAll(statusDir(cfg), 0755); err != nil {
+		fmt.Fprintf(os.Stderr, "trani: failed to create status directory: %v\n", err)
+	}
+	removeDeadStatuses(cfg)
+	p.update(func(*JobStatus) {})
+	return p
+}
+
+// removeDeadStatuses deletes the status files of processes that died
+// without removing their own.
+func removeDeadStatuses(cfg *config.Config) {
+	entries, err := os.ReadDir(statusDir(cfg))
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if pid, ok := statusPID(entry.Name()); ok && !isProcessAlive(pid) {
+			os.Remove(filepath.Join(statusDir(cfg), entry.Name()))
+		}
+	}
+}
+
+// statusPID returns the PID a status file is named after.
+func statusPID(name string) (int, bool) {
+	if !strings.HasSuffix(name, ".json") {
+		return 0, false
+	}
+	pid, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+	return pid, err == nil
+}
+
+// update applies change to the status and rewrites the status file.
+func (p *statusPublisher) update(change func(*JobStatus)) {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	change(&p.status)
+	p.status.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(p.status, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "trani: failed to marshal status: %v\n", err)
+		return
+	}
+
+	// Written to a temporary file and renamed, so a concurrent `trani
+	// status` never reads a half-written file.
+	tempPath := p.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "trani: failed to write status: %v\n", err)
+		return
+	}
+	if err := os.Rename(tempPath, p.path); err != nil {
+		fmt.Fprintf(os.Stderr, "trani: failed to write status: %v\n", err)
+	}
+}
+
+// setStage publishes the job's current stage.
+func (p *statusPublisher) setStage(stage string) {
+	p.update(func(s *JobStatus) { s.Stage = stage })
+}
+
+// remove deletes the status file once the job is done.
+func (p *statusPublisher) remove() {
+	if p == nil {
+		return
+	}
+	os.Remove(p.path)
+}
+
+// ReadStatus collects the status of the active recording and of every
+// job still running in the background. Status files left behind by
+// processes that are no longer alive are skipped; ReadStatus only reads.
+func ReadStatus(cfg *config.Config) (*Status, error) {
+	lock, err := ReadLock(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	jobs, err := readJobStatuses(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &Status{Postprocess: []JobStatus{}}
+	for _, job := range jobs {
+		switch {
+		case job.Kind == JobRecording && lock != nil && job.PID == lock.PID:
+			status.Recording = &job
+		case job.Kind == JobRecording, job.Kind == JobPostprocess:
+			// A recording worker without the lock has stopped recording
+			// and is finishing up, while the next session may already
+			// have started.
+			job.ElapsedSeconds = time.Since(job.StartedAt).Seconds()
+			status.Postprocess = append(status.Postprocess, job)
+		}
+	}
+
+	if lock != nil {
+		if status.Recording == nil {
+			// A recording started before status files existed, or one
+			// whose status couldn't be written: the lock still has most of
+			// what's worth showing.
+			status.Recording = &JobStatus{
+				PID:       lock.PID,
+				Kind:      JobRecording,
+				Title:     lock.Title,
+				Stage:     StageRecording,
+				StartedAt: lock.StartedAt,
+				Prompt:    lock.PromptTemplate,
+			}
+		}
+		now := time.Now()
+		status.Recording.Paused = lock.Paused
+		status.Recording.ElapsedSeconds = (now.Sub(lock.StartedAt) - lock.PausedDuration(now)).Seconds()
+	}
+
+	sort.Slice(status.Postprocess, func(i, j int) bool {
+		return status.Postprocess[i].StartedAt.Before(status.Postprocess[j].StartedAt)
+	})
+	return status, nil
+}
+
+func readJobStatuses(cfg *config.Config) ([]JobStatus, error) {
+	entries, err := os.ReadDir(statusDir(cfg))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read status directory: %w", err)
+	}
+
+	var out []JobStatus
+	for _, entry := range entries {
+		pid, ok := statusPID(entry.Name())
+		if !ok || !isProcessAlive(pid) {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(statusDir(cfg), entry.Name()))
+		if err != nil {
+			continue
+		}
+		var job JobStatus
+		if err := json.Unmarshal(data, &job); err != nil {
+			continue
+		}
+		out = append(out, job)
+	}
+	return out, nil
+}
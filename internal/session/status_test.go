@@ -0,0 +1,162 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+func TestReadStatusMergesRecordingWithLock(t *testing.T) {
+	cfg := testConfig(t)
+	startedAt := time.Now().Add(-10 * time.Minute)
+
+	lock := &RecordingLock{PID: os.Getpid(), Title: "2026-01-15 1430", StartedAt: startedAt, PromptTemplate: "default"}
+	if err := lock.Acquire(cfg); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	lock.markPaused(startedAt.Add(5 * time.Minute))
+	if err := lock.update(cfg); err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+
+	publisher := newStatusPublisher(cfg, JobStatus{Kind: JobRecording, Title: lock.Title, Stage: StagePaused, StartedAt: startedAt, Mode: "mic_system"})
+	defer publisher.remove()
+
+	status, err := ReadStatus(cfg)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	rec := status.Recording
+	if rec == nil {
+		t.Fatal("expected an active recording")
+	}
+	if rec.Mode != "mic_system" || !rec.Paused {
+		t.Errorf("expected mode from the status file and pause state from the lock, got %+v", rec)
+	}
+	// Paused after 5 of the 10 minutes, and still paused.
+	if rec.ElapsedSeconds < 299 || rec.ElapsedSeconds > 301 {
+		t.Errorf("expected ~300s elapsed excluding the pause, got %v", rec.ElapsedSeconds)
+	}
+}
+
+func TestReadStatusFallsBackToLock(t *testing.T) {
+	cfg := testConfig(t)
+	lock := &RecordingLock{PID: os.Getpid(), Title: "2026-01-15 1430", StartedAt: time.Now(), PromptTemplate: "reunion"}
+	if err := lock.Acquire(cfg); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+
+	status, err := ReadStatus(cfg)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if status.Recording == nil || status.Recording.Title != lock.Title || status.Recording.Prompt != "reunion" {
+		t.Errorf("expected the recording to be described from the lock, got %+v", status.Recording)
+	}
+}
+
+func TestReadStatusListsPostprocessAndSkipsDeadJobs(t *testing.T) {
+	cfg := testConfig(t)
+
+	publisher := newStatusPublisher(cfg, JobStatus{Kind: JobPostprocess, Title: "2026-01-15 1200", Stage: StageSummarizing, StartedAt: time.Now()})
+	defer publisher.remove()
+
+	// A worker that died without cleaning up after itself. PID 0 is never
+	// a real process.
+	dead := filepath.Join(statusDir(cfg), "0.json")
+	if err := os.WriteFile(dead, []byte(`{"pid":0,"kind":"postprocess"}`), 0644); err != nil {
+		t.Fatalf("failed to write status file: %v", err)
+	}
+
+	status, err := ReadStatus(cfg)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if status.Recording != nil {
+		t.Errorf("expected no active recording, got %+v", status.Recording)
+	}
+	if len(status.Postprocess) != 1 || status.Postprocess[0].Stage != StageSummarizing {
+		t.Errorf("expected the one live postprocess job, got %+v", status.Postprocess)
+	}
+	if _, err := os.Stat(dead); err != nil {
+		t.Error("expected reading the status to leave the dead job's file alone")
+	}
+
+	// The next job to publish its status cleans up after the dead one.
+	newStatusPublisher(cfg, JobStatus{Kind: JobPostprocess}).remove()
+	if _, err := os.Stat(dead); !os.IsNotExist(err) {
+		t.Error("expected the dead job's status file to be removed")
+	}
+}
+
+func TestReadStatusShowsFinalChunkAfterLockIsCleared(t *testing.T) {
+	cfg := testConfig(t)
+	lock := &RecordingLock{PID: os.Getpid(), Title: "2026-01-15 1430", StartedAt: time.Now()}
+	if err := lock.Acquire(cfg); err != nil {
+		t.Fatalf("Acquire failed: %v", err)
+	}
+	publisher := newStatusPublisher(cfg, JobStatus{Kind: JobRecording, Title: lock.Title, Stage: StageRecording, StartedAt: lock.StartedAt})
+	defer publisher.remove()
+
+	// As finishRecording does: the lock goes first, so the next session
+	// can start while the last chunk is still being transcribed.
+	if err := ClearLock(cfg); err != nil {
+		t.Fatalf("ClearLock failed: %v", err)
+	}
+	publisher.setStage(StageFinalChunk)
+
+	status, err := ReadStatus(cfg)
+	if err != nil {
+		t.Fatalf("ReadStatus failed: %v", err)
+	}
+	if status.Recording != nil {
+		t.Errorf("expected no active recording, got %+v", status.Recording)
+	}
+	if len(status.Postprocess) != 1 || status.Postprocess[0].Kind != JobRecording || status.Postprocess[0].Stage != StageFinalChunk {
+		t.Errorf("expected the final chunk among the background jobs, got %+v", status.Postprocess)
+	}
+}
+
+type failingTranscriber struct{}
+
+func (failingTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (transcribe.Result, error) {
+	return transcribe.Result{}, errors.New("backend unavailable")
+}
+
+func TestChunkerPublishesProgress(t *testing.T) {
+	cfg := testConfig(t)
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+
+	c, err := newChunker(cfg, "2026-01-15 1430", "", recorder, failingTranscriber{})
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+	c.status = newStatusPublisher(cfg, JobStatus{Kind: JobRecording})
+	defer c.status.remove()
+
+	chunk := filepath.Join(cfg.Paths.TempDir, "chunk-mic-000.wav")
+	writeTestChunk(t, chunk)
+	appendSegmentListLine(t, recorder.MicSegmentList(), chunk)
+
+	// A failed chunk is queued for retry, not an error.
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+
+	jobs, err := readJobStatuses(cfg)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("expected one status file, got %+v (%v)", jobs, err)
+	}
+	if jobs[0].ChunksClosed != 1 || jobs[0].ChunksTranscribed != 0 || jobs[0].ChunksQueued != 1 {
+		t.Errorf("expected 0 of 1 chunks transcribed and 1 queued, got %d of %d and %d", jobs[0].ChunksTranscribed, jobs[0].ChunksClosed, jobs[0].ChunksQueued)
+	}
+	if jobs[0].LastChunkError == "" || jobs[0].LastChunkErrorAt.IsZero() {
+		t.Errorf("expected the chunk error to be published, got %+v", jobs[0])
+	}
+}
@@ -0,0 +1,88 @@
+package session
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+// vttHeader starts every WebVTT file; cues follow after a blank line.
+const vttHeader = "WEBVTT\n\n"
+
+// formatSRT renders segments as SRT cues, numbered from firstIndex (SRT
+// numbering starts at 1 and must keep counting across appended chunks).
+func formatSRT(segments []transcribe.Segment, firstIndex int) string {
+	var b strings.Builder
+	for i, s := range segments {
+		fmt.Fprintf(&b, "%d\n%s --> %s\n%s\n\n",
+			firstIndex+i,
+			formatCueTimestamp(s.Start, ","),
+			formatCueTimestamp(s.End, ","),
+			s.Text,
+		)
+	}
+	return b.String()
+}
+
+// formatVTT renders segments as WebVTT cues, without the file header.
+func formatVTT(segments []transcribe.Segment) string {
+	var b strings.Builder
+	for _, s := range segments {
+		fmt.Fprintf(&b, "%s --> %s\n%s\n\n",
+			formatCueTimestamp(s.Start, "."),
+			formatCueTimestamp(s.End, "."),
+			s.Text,
+		)
+	}
+	return b.String()
+}
+
+// formatCueTimestamp renders d as HH:MM:SS<sep>mmm; SRT separates the
+// milliseconds with a comma, WebVTT with a period.
+func formatCueTimestamp(d time.Duration, sep string) string {
+	if d < 0 {
+		d = 0
+	}
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// mergeSegments combines segments from separately transcribed streams of
+// the same stretch of audio into one list in time order.
+func mergeSegments(a, b []transcribe.Segment) []transcribe.Segment {
+	merged := append(append([]transcribe.Segment{}, a...), b...)
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Start < merged[j].Start
+	})
+	return merged
+}
+
+// countSRTCues counts the cues already in an SRT file, so appending to it
+// (e.g. from a chunker created after a restart) keeps numbering in
+// sequence. A missing file has none.
+func countSRTCues(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read subtitles: %w", err)
+	}
+	return strings.Count(string(data), " --> "), nil
+}
+
+// writeSubtitles writes a whole transcript's segments as fresh .srt and
+// .vtt files, for the single-pass `process` flow.
+func writeSubtitles(srtPath, vttPath string, segments []transcribe.Segment) error {
+	if err := os.WriteFile(srtPath, []byte(formatSRT(segments, 1)), 0644); err != nil {
+		return fmt.Errorf("failed to save SRT subtitles: %w", err)
+	}
+	if err := os.WriteFile(vttPath, []byte(vttHeader+formatVTT(segments)), 0644); err != nil {
+		return fmt.Errorf("failed to save WebVTT subtitles: %w", err)
+	}
+	return nil
+}
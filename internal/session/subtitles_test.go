@@ -0,0 +1,86 @@
+package session
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/transcribe"
+)
+
+func TestFormatCueTimestamp(t *testing.T) {
+	cases := []struct {
+		d        time.Duration
+		sep      string
+		expected string
+	}{
+		{0, ",", "00:00:00,000"},
+		{1500 * time.Millisecond, ",", "00:00:01,500"},
+		{time.Hour + 2*time.Minute + 3*time.Second + 45*time.Millisecond, ".", "01:02:03.045"},
+		{-time.Second, ",", "00:00:00,000"},
+	}
+
+	for _, c := range cases {
+		if got := formatCueTimestamp(c.d, c.sep); got != c.expected {
+			t.Errorf("formatCueTimestamp(%v): expected %s, got %s", c.d, c.expected, got)
+		}
+	}
+}
+
+func TestFormatSRTNumbersFromFirstIndex(t *testing.T) {
+	segments := []transcribe.Segment{
+		{Start: 0, End: 2 * time.Second, Text: "hola"},
+		{Start: 2 * time.Second, End: 3500 * time.Millisecond, Text: "mundo"},
+	}
+
+	expected := "5\n00:00:00,000 --> 00:00:02,000\nhola\n\n" +
+		"6\n00:00:02,000 --> 00:00:03,500\nmundo\n\n"
+	if got := formatSRT(segments, 5); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestFormatVTT(t *testing.T) {
+	segments := []transcribe.Segment{{Start: time.Second, End: 2 * time.Second, Text: "hola"}}
+
+	expected := "00:00:01.000 --> 00:00:02.000\nhola\n\n"
+	if got := formatVTT(segments); got != expected {
+		t.Errorf("expected %q, got %q", expected, got)
+	}
+}
+
+func TestMergeSegmentsOrdersByStart(t *testing.T) {
+	mic := []transcribe.Segment{{Start: 0, Text: "a"}, {Start: 4 * time.Second, Text: "c"}}
+	system := []transcribe.Segment{{Start: 2 * time.Second, Text: "b"}}
+
+	merged := mergeSegments(mic, system)
+
+	var got string
+	for _, s := range merged {
+		got += s.Text
+	}
+	if got != "abc" {
+		t.Errorf("expected segments in time order (abc), got %s", got)
+	}
+}
+
+func TestCountSRTCues(t *testing.T) {
+	dir := t.TempDir()
+
+	n, err := countSRTCues(filepath.Join(dir, "missing.srt"))
+	if err != nil || n != 0 {
+		t.Errorf("missing file: expected (0, nil), got (%d, %v)", n, err)
+	}
+
+	path := filepath.Join(dir, "existing.srt")
+	segments := []transcribe.Segment{{Text: "a"}, {Text: "b"}, {Text: "c"}}
+	if err := os.WriteFile(path, []byte(formatSRT(segments, 1)), 0644); err != nil {
+		t.Fatalf("failed to write subtitles: %v", err)
+	}
+
+	n, err = countSRTCues(path)
+	if err != nil || n != 3 {
+		t.Errorf("expected (3, nil), got (%d, %v)", n, err)
+	}
+}
@@ -0,0 +1,263 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/errlog"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+// With postprocess.title_and_tags, once a session's summary is written, the
+// model is asked for a short title and a few tags for it, which go into the
+// note's frontmatter. With postprocess.rename_note too, the note is then
+// renamed to "<date> <title>.md". Its transcript and the rest of
+// .sources/ keep the session's original title: the session index records
+// the note's new path, which is how resolveNote finds the session again.
+
+// maxTitleLength is as long as a generated title can get in a file name,
+// in characters.
+const maxTitleLength = 80
+
+// titleAndTags is what the model must return:
+//
+//	{"title": "Planificación del Q1", "tags": ["planificacion", "presupuesto"]}
+type titleAndTags struct {
+	Title string   `json:"title"`
+	Tags  []string `json:"tags"`
+}
+
+// writeTitleAndTags generates the session's title and tags into the note's
+// frontmatter, if postprocess.title_and_tags is on, and renames the note
+// if postprocess.rename_note is on too. A title already in the
+// frontmatter is kept; tags are added to the ones already there. Only
+// those two fields are rewritten, leaving the rest of the frontmatter as
+// it was. Returns the note's path, new or not. A failure is notified and
+// logged, leaving the note as it was.
+func writeTitleAndTags(ctx context.Context, cfg *config.Config, llms *llmClients, notePath, transcription string, headStart *summaryHeadStart, promptTemplate, sessionTitle string, data promptData, notifier *notify.Notifier) (string, error) {
+	if !cfg.Postprocess.TitleAndTags {
+		return notePath, nil
+	}
+
+	newPath, err := func() (string, error) {
+		raw, err := os.ReadFile(notePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to read note: %w", err)
+		}
+		content := string(raw)
+
+		data = data.withNote(strings.TrimSpace(stripResumenSections(content)))
+		generated, err := generateTitleAndTags(ctx, llms, cfg.Paths.PromptsDir, promptTemplate, transcription, headStart, data, cfg.LLM.MaxPromptTokens)
+		if err != nil {
+			return "", err
+		}
+
+		title := frontmatterString(data.Frontmatter, "title")
+		if title == "" {
+			title = generated.Title
+			if content, err = setFrontmatterField(content, "title", title); err != nil {
+				return "", err
+			}
+		}
+		existing := frontmatterTags(data.Frontmatter)
+		if tags := mergeTags(existing, generated.Tags); len(tags) > len(existing) {
+			if content, err = setFrontmatterField(content, "tags", tags); err != nil {
+				return "", err
+			}
+		}
+		if content != string(raw) {
+			if err := os.WriteFile(notePath, []byte(content), 0644); err != nil {
+				return "", fmt.Errorf("failed to update note: %w", err)
+			}
+		}
+
+		if !cfg.Postprocess.RenameNote {
+			return notePath, nil
+		}
+		return renameNote(cfg, notePath, sessionTitle, data.Date, title)
+	}()
+	if err != nil {
+		notifier.Error("⚠️ Trani", fmt.Sprintf("Error al generar título y etiquetas (%s): %v", sessionTitle, err))
+		errlog.Error("title_and_tags", sessionTitle, err)
+		return notePath, err
+	}
+	return newPath, nil
+}
+
+// generateTitleAndTags asks for them with templateName's _title.txt prompt
+// (falling back to default_title.txt).
+func generateTitleAndTags(ctx context.Context, llms *llmClients, promptsDir, templateName, transcription string, headStart *summaryHeadStart, data promptData, maxTokens int) (titleAndTags, error) {
+	prompt, err := loadPromptFile(promptsDir, templateName, "_title.txt")
+	if err != nil {
+		return titleAndTags{}, err
+	}
+	req, err := renderWithTranscript(ctx, llms, prompt, promptsDir, templateName, transcription, headStart, data, maxTokens)
+	if err != nil {
+		return titleAndTags{}, err
+	}
+
+	var generated titleAndTags
+	err = llms.generateValid(ctx, prompt.settings.Backend, req, func(reply string) (err error) {
+		generated, err = parseTitleAndTags(reply)
+		return err
+	})
+	return generated, err
+}
+
+// parseTitleAndTags parses and checks a reply against titleAndTags's
+// schema: a title of at most maxTitleLength characters and any number of
+// tags, normalized as Obsidian tags (see normalizeTag).
+func parseTitleAndTags(reply string) (titleAndTags, error) {
+	var parsed struct {
+		Title *string   `json:"title"`
+		Tags  *[]string `json:"tags"`
+	}
+	if err := decodeReply(reply, &parsed); err != nil {
+		return titleAndTags{}, err
+	}
+	if parsed.Title == nil || parsed.Tags == nil {
+		return titleAndTags{}, fmt.Errorf(`"title" and "tags" are required`)
+	}
+
+	title := strings.Join(strings.Fields(*parsed.Title), " ")
+	switch {
+	case title == "":
+		return titleAndTags{}, fmt.Errorf("the title is empty")
+	case utf8.RuneCountInString(title) > maxTitleLength:
+		return titleAndTags{}, fmt.Errorf("the title is longer than %d characters", maxTitleLength)
+	}
+	return titleAndTags{Title: title, Tags: mergeTags(nil, *parsed.Tags)}, nil
+}
+
+// normalizeTag turns a tag into one Obsidian accepts: no leading "#", no
+// spaces, lowercase. "" if nothing's left.
+func normalizeTag(tag string) string {
+	tag = strings.TrimLeft(strings.TrimSpace(tag), "#")
+	return strings.ToLower(strings.Join(strings.Fields(tag), "-"))
+}
+
+// mergeTags appends the tags in added, normalized, that aren't in tags
+// already. tags are kept as they are.
+func mergeTags(tags, added []string) []string {
+	merged := slices.Clone(tags)
+	have := make(map[string]bool)
+	for _, tag := range tags {
+		have[normalizeTag(tag)] = true
+	}
+	for _, tag := range added {
+		if tag = normalizeTag(tag); tag != "" && !have[tag] {
+			merged = append(merged, tag)
+			have[tag] = true
+		}
+	}
+	return merged
+}
+
+func frontmatterString(frontmatter map[string]any, key string) string {
+	s, _ := frontmatter[key].(string)
+	return strings.TrimSpace(s)
+}
+
+// frontmatterTags are the tags in a note's frontmatter, which Obsidian
+// takes as a list or as a string of them separated by commas or spaces.
+func frontmatterTags(frontmatter map[string]any) []string {
+	var tags []string
+	switch t := frontmatter["tags"].(type) {
+	case string:
+		tags = strings.FieldsFunc(t, func(r rune) bool { return r == ',' || r == ' ' })
+	case []any:
+		for _, tag := range t {
+			if s, ok := tag.(string); ok {
+				tags = append(tags, s)
+			}
+		}
+	}
+	return slices.DeleteFunc(tags, func(tag string) bool { return strings.TrimSpace(tag) == "" })
+}
+
+// renameNote renames a note still named after its session's start, as
+// sessionTitle, to "<date> <title>.md" in the same directory, with a
+// number after the title if that's taken, and records the new path in the
+// session index. A note already named anything else, by the user or an
+// earlier run, is left alone.
+func renameNote(cfg *config.Config, notePath, sessionTitle, date, title string) (string, error) {
+	if strings.TrimSuffix(filepath.Base(notePath), filepath.Ext(notePath)) != sessionTitle {
+		return notePath, nil
+	}
+	name := noteFileName(title)
+	if name == "" {
+		return notePath, nil
+	}
+	if date != "" {
+		name = date + " " + name
+	}
+
+	dir := filepath.Dir(notePath)
+	newPath := filepath.Join(dir, name+".md")
+	for n := 2; ; n++ {
+		if _, err := os.Lstat(newPath); os.IsNotExist(err) {
+			break
+		}
+		newPath = filepath.Join(dir, fmt.Sprintf("%s %d.md", name, n))
+	}
+
+	// Recorded first: a renamed note the index doesn't know about couldn't
+	// be traced back to its transcript.
+	if err := updateIndex(cfg, sessionTitle, func(e *IndexEntry) { e.NotePath = newPath }); err != nil {
+		return notePath, err
+	}
+	if err := os.Rename(notePath, newPath); err != nil {
+		logIndex(updateIndex(cfg, sessionTitle, func(e *IndexEntry) { e.NotePath = notePath }))
+		return notePath, fmt.Errorf("failed to rename note: %w", err)
+	}
+	return newPath, nil
+}
+
+// noteFileName makes a title safe as a note's name: without the characters
+// file systems or Obsidian links don't allow, and at most maxTitleLength
+// characters long.
+func noteFileName(title string) string {
+	title = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\:*?"<>|#^[]`, r) || r < ' ' {
+			return ' '
+		}
+		return r
+	}, title)
+	title = strings.Join(strings.Fields(title), " ")
+	if runes := []rune(title); len(runes) > maxTitleLength {
+		title = strings.TrimSpace(string(runes[:maxTitleLength]))
+	}
+	return strings.Trim(title, ". ")
+}
+
+// sessionForNote is the index entry of the session notePath belongs to,
+// false if there's none: a note renamed after its session (see renameNote)
+// no longer has the session's title as its name.
+func sessionForNote(cfg *config.Config, notePath string) (IndexEntry, bool) {
+	entries, _ := ReadIndex(cfg)
+	abs, _ := filepath.Abs(notePath)
+	for i := len(entries) - 1; i >= 0; i-- {
+		if p, _ := filepath.Abs(entries[i].NotePath); entries[i].NotePath != "" && p == abs {
+			return entries[i], true
+		}
+	}
+	return IndexEntry{}, false
+}
+
+// noteForSession is the path the index records for session title's note,
+// "" if it has none.
+func noteForSession(cfg *config.Config, title string) string {
+	entries, _ := ReadIndex(cfg)
+	for _, e := range entries {
+		if e.Title == title {
+			return e.NotePath
+		}
+	}
+	return ""
+}
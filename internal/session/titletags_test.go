@@ -0,0 +1,129 @@
+package session
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/pkg/notify"
+)
+
+func TestParseTitleAndTags(t *testing.T) {
+	got, err := parseTitleAndTags(`{"title": " Planificación  del Q1 ", "tags": ["#Presupuesto", "equipo de datos", "presupuesto", ""]}`)
+	if err != nil {
+		t.Fatalf("parseTitleAndTags failed: %v", err)
+	}
+	if got.Title != "Planificación del Q1" || strings.Join(got.Tags, ",") != "presupuesto,equipo-de-datos" {
+		t.Errorf("unexpected title and tags: %+v", got)
+	}
+
+	for name, reply := range map[string]string{
+		"missing tags":  `{"title": "Sync"}`,
+		"empty title":   `{"title": " ", "tags": []}`,
+		"long title":    `{"title": "` + strings.Repeat("a", maxTitleLength+1) + `", "tags": []}`,
+		"unknown field": `{"title": "Sync", "tags": [], "summary": "..."}`,
+	} {
+		if _, err := parseTitleAndTags(reply); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestNoteFileName(t *testing.T) {
+	cases := map[string]string{
+		"Planificación del Q1":        "Planificación del Q1",
+		"Cliente: ACME / revisión #2": "Cliente ACME revisión 2",
+		"[[Enlace]] | otra cosa.":     "Enlace otra cosa",
+		"???":                         "",
+	}
+	for title, expected := range cases {
+		if got := noteFileName(title); got != expected {
+			t.Errorf("%q: expected %q, got %q", title, expected, got)
+		}
+	}
+}
+
+func TestWriteTitleAndTagsRenamesNote(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Paths.PromptsDir = t.TempDir()
+	cfg.Postprocess.TitleAndTags = true
+	cfg.Postprocess.RenameNote = true
+	if err := ensureDefaultPrompts(cfg.Paths.PromptsDir); err != nil {
+		t.Fatalf("ensureDefaultPrompts failed: %v", err)
+	}
+
+	title := "2026-01-15 1430"
+	notePath := filepath.Join(cfg.Paths.SessionsDir, title+".md")
+	if err := os.WriteFile(notePath, []byte("---\n# de la plantilla\ntags: [Proyecto-X]\nasistentes:  [Ana]\n---\nmis notas\n"), 0644); err != nil {
+		t.Fatalf("failed to write note: %v", err)
+	}
+	if err := recordIndex(cfg, newIndexEntry(cfg, title, notePath, SourceSession, "default", time.Date(2026, 1, 15, 14, 30, 0, 0, time.Local))); err != nil {
+		t.Fatalf("recordIndex failed: %v", err)
+	}
+
+	llmClient := &replyingGenerator{replies: []string{`{"title": "Planificación: Q1", "tags": ["proyecto-x", "presupuesto"]}`}}
+	llms := newLLMClients(config.LLMConfig{}, llmClient)
+	newPath, err := writeTitleAndTags(context.Background(), cfg, llms, notePath, "la transcripción", nil, "default", title, newPromptData(cfg, title), notify.New())
+	if err != nil {
+		t.Fatalf("writeTitleAndTags failed: %v", err)
+	}
+
+	if expected := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 Planificación Q1.md"); newPath != expected {
+		t.Fatalf("expected the note renamed to %s, got %s", expected, newPath)
+	}
+	if _, err := os.Stat(notePath); !os.IsNotExist(err) {
+		t.Errorf("expected the old note gone, got %v", err)
+	}
+	note, err := os.ReadFile(newPath)
+	if err != nil {
+		t.Fatalf("failed to read note: %v", err)
+	}
+	expected := "---\n# de la plantilla\ntags:\n    - Proyecto-X\n    - presupuesto\nasistentes:  [Ana]\ntitle: 'Planificación: Q1'\n---\nmis notas\n"
+	if string(note) != expected {
+		t.Errorf("expected %q, got %q", expected, note)
+	}
+
+	// The renamed note still leads to its session, and the other way round.
+	if p, got := resolveNote(newPath, cfg); p != newPath || got != title {
+		t.Errorf("expected %s to resolve to session %s, got %s, %s", newPath, title, p, got)
+	}
+	if p, got := resolveNote(title, cfg); p != newPath || got != title {
+		t.Errorf("expected session %s to resolve to %s, got %s, %s", title, newPath, p, got)
+	}
+
+	// Once renamed, it isn't renamed again, and its title is kept.
+	llmClient.replies = []string{`{"title": "Otra cosa", "tags": []}`}
+	again, err := writeTitleAndTags(context.Background(), cfg, llms, newPath, "la transcripción", nil, "default", title, newPromptData(cfg, title), notify.New())
+	if err != nil || again != newPath {
+		t.Errorf("expected the note left where it is, got %s (%v)", again, err)
+	}
+	if note, _ := os.ReadFile(newPath); string(note) != expected {
+		t.Errorf("expected the note unchanged, got %q", note)
+	}
+}
+
+func TestRenameNoteTakenName(t *testing.T) {
+	cfg := testConfig(t)
+	notePath := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 1430.md")
+	taken := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 Sync.md")
+	for _, path := range []string{notePath, taken} {
+		if err := os.WriteFile(path, []byte(path), 0644); err != nil {
+			t.Fatalf("failed to write note: %v", err)
+		}
+	}
+
+	newPath, err := renameNote(cfg, notePath, "2026-01-15 1430", "2026-01-15", "Sync")
+	if err != nil {
+		t.Fatalf("renameNote failed: %v", err)
+	}
+	if expected := filepath.Join(cfg.Paths.SessionsDir, "2026-01-15 Sync 2.md"); newPath != expected {
+		t.Errorf("expected %s, got %s", expected, newPath)
+	}
+	if content, _ := os.ReadFile(taken); string(content) != taken {
+		t.Errorf("expected the existing note untouched, got %q", content)
+	}
+}
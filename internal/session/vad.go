@@ -0,0 +1,154 @@
+package session
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio/wav"
+	"github.com/sabhz/trani/internal/config"
+)
+
+// VAD works on short frames, on the 16 kHz mono audio postProcessAudio
+// produces. That audio is already peak-normalized, which boosts a silent
+// room's noise as much as it boosts speech, so a frame can't be judged by
+// its absolute level alone: it counts as speech if it's loud enough
+// relative to the chunk's own noise floor, estimated as a low percentile
+// of all frame levels. Only digital silence is judged absolutely.
+const (
+	vadFrame           = 30 * time.Millisecond
+	vadNoisePercentile = 0.10
+	vadSilenceFloorDB  = -60.0
+)
+
+// speechActivity is the result of running VAD over a chunk.
+type speechActivity struct {
+	ratio    float64       // share of frames that are speech
+	first    time.Duration // start of the first speech frame
+	last     time.Duration // end of the last speech frame
+	duration time.Duration
+}
+
+// detectSpeech classifies every frame of a as speech or not. A frame is
+// speech if its level is more than thresholdDB above the noise floor.
+func detectSpeech(a *wav.Audio, thresholdDB float64) speechActivity {
+	frameLen := a.SampleRate * int(vadFrame/time.Millisecond) / 1000 * a.Channels
+	activity := speechActivity{duration: a.Duration()}
+	if frameLen == 0 || len(a.Samples) < frameLen {
+		return activity
+	}
+
+	levels := make([]float64, 0, len(a.Samples)/frameLen)
+	for start := 0; start+frameLen <= len(a.Samples); start += frameLen {
+		levels = append(levels, frameLevelDB(a.Samples[start:start+frameLen]))
+	}
+
+	sorted := append([]float64(nil), levels...)
+	sort.Float64s(sorted)
+	floor := sorted[int(float64(len(sorted)-1)*vadNoisePercentile)]
+
+	firstFrame, lastFrame, speechFrames := -1, -1, 0
+	for i, level := range levels {
+		if level <= vadSilenceFloorDB || level < floor+thresholdDB {
+			continue
+		}
+		speechFrames++
+		if firstFrame < 0 {
+			firstFrame = i
+		}
+		lastFrame = i
+	}
+
+	activity.ratio = float64(speechFrames) / float64(len(levels))
+	if firstFrame >= 0 {
+		activity.first = time.Duration(firstFrame) * vadFrame
+		activity.last = time.Duration(lastFrame+1) * vadFrame
+	}
+	return activity
+}
+
+// frameLevelDB is the RMS level of samples in dBFS.
+func frameLevelDB(samples []int16) float64 {
+	var sum float64
+	for _, s := range samples {
+		v := float64(s) / 32768
+		sum += v * v
+	}
+	rms := math.Sqrt(sum / float64(len(samples)))
+	if rms == 0 {
+		return -120
+	}
+	return 20 * math.Log10(rms)
+}
+
+// vadResult says what to transcribe for one chunk after VAD: nothing, if
+// skip is set, or path, which is either the chunk itself or a copy with
+// long leading/trailing silence trimmed off. lead is how much was trimmed
+// from the start, which the chunk's segment times must be shifted by.
+type vadResult struct {
+	path  string
+	lead  time.Duration
+	ratio float64
+	skip  bool
+
+	trimmed bool
+}
+
+// cleanup removes the trimmed copy, if one was made.
+func (r vadResult) cleanup() {
+	if r.trimmed {
+		os.Remove(r.path)
+	}
+}
+
+// applyVAD runs VAD on an already post-processed chunk. With VAD disabled
+// it passes the chunk through untouched.
+func applyVAD(chunkPath string, cfg config.AudioConfig) (vadResult, error) {
+	if !cfg.VAD {
+		return vadResult{path: chunkPath, ratio: 1}, nil
+	}
+
+	a, err := wav.Read(chunkPath)
+	if err != nil {
+		return vadResult{}, fmt.Errorf("failed to read audio for voice detection: %w", err)
+	}
+
+	activity := detectSpeech(a, *cfg.VADThresholdDB)
+	if activity.ratio < *cfg.VADMinSpeechRatio || activity.last == 0 {
+		return vadResult{path: chunkPath, ratio: activity.ratio, skip: true}, nil
+	}
+
+	maxSilence := time.Duration(*cfg.VADMaxSilenceSeconds * float64(time.Second))
+	start := activity.first - maxSilence
+	if start < 0 {
+		start = 0
+	}
+	end := activity.last + maxSilence
+	if end > activity.duration {
+		end = activity.duration
+	}
+
+	if start == 0 && end == activity.duration {
+		return vadResult{path: chunkPath, ratio: activity.ratio}, nil
+	}
+
+	trimmedPath := chunkPath + ".vad.wav"
+	if err := wav.Write(trimmedPath, trim(a, start, end)); err != nil {
+		os.Remove(trimmedPath)
+		return vadResult{}, fmt.Errorf("failed to write trimmed audio: %w", err)
+	}
+
+	return vadResult{path: trimmedPath, lead: start, ratio: activity.ratio, trimmed: true}, nil
+}
+
+// trim returns the part of a between start and end.
+func trim(a *wav.Audio, start, end time.Duration) *wav.Audio {
+	from := int(start.Seconds()*float64(a.SampleRate)) * a.Channels
+	to := int(end.Seconds()*float64(a.SampleRate)) * a.Channels
+	if to > len(a.Samples) {
+		to = len(a.Samples)
+	}
+	return &wav.Audio{SampleRate: a.SampleRate, Channels: a.Channels, Samples: a.Samples[from:to]}
+}
@@ -0,0 +1,183 @@
+package session
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sabhz/trani/internal/audio"
+	"github.com/sabhz/trani/internal/audio/wav"
+	"github.com/sabhz/trani/internal/config"
+)
+
+// synthChunk builds 16 kHz mono audio: low background noise throughout,
+// with a loud, syllable-like tone (200ms on, 200ms off) between speechFrom
+// and speechTo. Like a real chunk after postProcessAudio, it's peak
+// normalized, so the noise ends up well above digital silence.
+func synthChunk(total, speechFrom, speechTo time.Duration) *wav.Audio {
+	const rate = 16000
+	rng := rand.New(rand.NewSource(1))
+
+	n := int(total.Seconds() * rate)
+	samples := make([]float64, n)
+	peak := 0.0
+	for i := range samples {
+		v := (rng.Float64()*2 - 1) * 0.01
+		at := time.Duration(i) * time.Second / rate
+		if at >= speechFrom && at < speechTo && (at-speechFrom)%(400*time.Millisecond) < 200*time.Millisecond {
+			v += 0.5 * math.Sin(2*math.Pi*220*float64(i)/rate)
+		}
+		samples[i] = v
+		peak = math.Max(peak, math.Abs(v))
+	}
+
+	out := &wav.Audio{SampleRate: rate, Channels: 1, Samples: make([]int16, n)}
+	for i, v := range samples {
+		out.Samples[i] = int16(v / peak * 32767)
+	}
+	return out
+}
+
+func vadConfig() config.AudioConfig {
+	cfg := config.Config{Audio: config.AudioConfig{VAD: true}}
+	cfg.ApplyDefaults()
+	return cfg.Audio
+}
+
+func TestDetectSpeechNoiseOnly(t *testing.T) {
+	// Normalizing a silent room's noise brings it up to full scale; it
+	// must still not count as speech.
+	a := synthChunk(5*time.Second, 0, 0)
+
+	activity := detectSpeech(a, 12)
+	if activity.ratio > 0.02 {
+		t.Errorf("expected (almost) no speech in noise, got ratio %.3f", activity.ratio)
+	}
+}
+
+func TestDetectSpeechFindsSpeechSpan(t *testing.T) {
+	a := synthChunk(10*time.Second, 3*time.Second, 6*time.Second)
+
+	activity := detectSpeech(a, 12)
+	if activity.ratio < 0.1 || activity.ratio > 0.2 {
+		t.Errorf("expected ~15%% speech, got ratio %.3f", activity.ratio)
+	}
+	if activity.first < 2900*time.Millisecond || activity.first > 3100*time.Millisecond {
+		t.Errorf("expected speech to start around 3s, got %v", activity.first)
+	}
+	if activity.last < 5700*time.Millisecond || activity.last > 6000*time.Millisecond {
+		t.Errorf("expected speech to end around 5.8s, got %v", activity.last)
+	}
+}
+
+func TestDetectSpeechDigitalSilence(t *testing.T) {
+	a := &wav.Audio{SampleRate: 16000, Channels: 1, Samples: make([]int16, 16000)}
+
+	if activity := detectSpeech(a, 12); activity.ratio != 0 {
+		t.Errorf("expected no speech in digital silence, got ratio %.3f", activity.ratio)
+	}
+}
+
+func TestApplyVADSkipsSilentChunk(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := wav.Write(path, synthChunk(5*time.Second, 0, 0)); err != nil {
+		t.Fatalf("failed to write chunk: %v", err)
+	}
+
+	result, err := applyVAD(path, vadConfig())
+	if err != nil {
+		t.Fatalf("applyVAD failed: %v", err)
+	}
+	if !result.skip {
+		t.Errorf("expected a silent chunk to be skipped (ratio %.3f)", result.ratio)
+	}
+}
+
+func TestApplyVADTrimsLeadingAndTrailingSilence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := wav.Write(path, synthChunk(10*time.Second, 3*time.Second, 6*time.Second)); err != nil {
+		t.Fatalf("failed to write chunk: %v", err)
+	}
+
+	result, err := applyVAD(path, vadConfig())
+	if err != nil {
+		t.Fatalf("applyVAD failed: %v", err)
+	}
+	defer result.cleanup()
+
+	if result.skip {
+		t.Fatal("a chunk with speech should not be skipped")
+	}
+	if result.path == path {
+		t.Fatal("expected a trimmed copy")
+	}
+
+	// One second of silence is kept on either side of the speech.
+	if result.lead < 1900*time.Millisecond || result.lead > 2100*time.Millisecond {
+		t.Errorf("expected ~2s trimmed from the start, got %v", result.lead)
+	}
+
+	trimmed, err := wav.Read(result.path)
+	if err != nil {
+		t.Fatalf("failed to read trimmed chunk: %v", err)
+	}
+	if d := trimmed.Duration(); d < 4600*time.Millisecond || d > 5100*time.Millisecond {
+		t.Errorf("expected ~4.8s left after trimming, got %v", d)
+	}
+}
+
+func TestApplyVADDisabledPassesThrough(t *testing.T) {
+	result, err := applyVAD("/does/not/need/to/exist.wav", config.AudioConfig{})
+	if err != nil {
+		t.Fatalf("applyVAD failed: %v", err)
+	}
+	if result.skip || result.path != "/does/not/need/to/exist.wav" || result.lead != 0 {
+		t.Errorf("expected the chunk untouched, got %+v", result)
+	}
+}
+
+func TestChunkerReportsSpeechRatio(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Audio = vadConfig()
+	cfg.Transcription.Backend = "openai"
+	recorder := audio.New(cfg.Audio, cfg.Paths.TempDir)
+
+	c, err := newChunker(cfg, "2026-01-15 1430", "", recorder, &stubTranscriber{texts: []string{"hola"}})
+	if err != nil {
+		t.Fatalf("newChunker failed: %v", err)
+	}
+	c.status = newStatusPublisher(cfg, JobStatus{Kind: JobRecording})
+	defer c.status.remove()
+
+	for i, a := range []*wav.Audio{synthChunk(10*time.Second, 2*time.Second, 8*time.Second), synthChunk(5*time.Second, 0, 0)} {
+		chunk := filepath.Join(cfg.Paths.TempDir, fmt.Sprintf("chunk-mic-%03d.wav", i))
+		if err := wav.Write(chunk, a); err != nil {
+			t.Fatalf("failed to write chunk: %v", err)
+		}
+		appendSegmentListLine(t, recorder.MicSegmentList(), chunk)
+	}
+	if err := c.pollOnce(context.Background()); err != nil {
+		t.Fatalf("pollOnce failed: %v", err)
+	}
+
+	entries, err := ReadIndex(cfg)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one index entry, got %v (%v)", entries, err)
+	}
+	ratios := entries[0].SpeechRatios
+	if len(ratios) != 2 || ratios[0] < 0.2 || ratios[1] > 0.02 {
+		t.Errorf("expected a speech ratio per chunk, the first with speech and the second without, got %v", ratios)
+	}
+
+	jobs, err := readJobStatuses(cfg)
+	if err != nil || len(jobs) != 1 {
+		t.Fatalf("expected one status file, got %+v (%v)", jobs, err)
+	}
+	if jobs[0].LastChunkSpeech == nil || *jobs[0].LastChunkSpeech != ratios[1] {
+		t.Errorf("expected the last chunk's speech ratio to be published, got %v", jobs[0].LastChunkSpeech)
+	}
+}
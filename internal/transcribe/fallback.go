@@ -0,0 +1,51 @@
+package transcribe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/sabhz/trani/internal/retry"
+	"github.com/sabhz/trani/pkg/errlog"
+)
+
+// Fallback is a Transcriber that tries several backends in order
+// (transcription.backend, then transcription.fallback), moving on to the
+// next one when a backend fails, after its own retries, in a way another
+// backend might not (see retry.CanFallBack): an outage, a rate limit, a
+// rejected key or no credit left. Any other failure, such as unreadable
+// audio, would fail the same way everywhere and is returned as is. Results
+// name the backend that produced them.
+type Fallback struct {
+	names    []string
+	backends []Transcriber
+}
+
+// Transcribe transcribes audioPath with the first backend that succeeds.
+func (f *Fallback) Transcribe(ctx context.Context, audioPath, prompt string) (Result, error) {
+	var err error
+	for i, backend := range f.backends {
+		var result Result
+		result, err = backend.Transcribe(ctx, audioPath, prompt)
+		if err == nil {
+			result.Backend = f.names[i]
+			return result, nil
+		}
+		if !retry.CanFallBack(err) || ctx.Err() != nil {
+			return Result{}, fmt.Errorf("%s: %w", f.names[i], err)
+		}
+		if i+1 < len(f.backends) {
+			errlog.Warn("transcription_fallback", "", fmt.Errorf("%s: %w", f.names[i], err), "next", f.names[i+1])
+		}
+	}
+	return Result{}, fmt.Errorf("every transcription backend failed, last %s: %w", f.names[len(f.names)-1], err)
+}
+
+// Close closes every backend in the chain.
+func (f *Fallback) Close() error {
+	var errs []error
+	for _, backend := range f.backends {
+		errs = append(errs, Close(backend))
+	}
+	return errors.Join(errs...)
+}
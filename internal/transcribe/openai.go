@@ -10,21 +10,29 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
-// OpenAI implements Transcriber using OpenAI Whisper API.
+const openaiAPIURL = "https://api.openai.com/v1"
+
+// OpenAI implements Transcriber using OpenAI Whisper API, or any
+// self-hosted server implementing the same endpoint.
 type OpenAI struct {
 	apiKey   string
 	model    string
 	language string
+	baseURL  string // "" means OpenAI's own API
 	client   *http.Client
+	policy   retry.Policy
 }
 
 // NewOpenAI creates a new OpenAI transcriber.
 // The apiKey parameter must be non-empty and model must be configured.
-func NewOpenAI(cfg config.OpenAIConfig, apiKey string) *OpenAI {
+func NewOpenAI(cfg config.OpenAIConfig, apiKey string, policy retry.Policy) *OpenAI {
 	// Note: apiKey validation is done in New() factory function
 	// Model validation is also done in New() factory function
 	return &OpenAI{
@@ -32,28 +40,76 @@ func NewOpenAI(cfg config.OpenAIConfig, apiKey string) *OpenAI {
 		model:    cfg.Model,
 		language: cfg.Language,
 		client:   &http.Client{},
+		policy:   policy,
+	}
+}
+
+// NewOpenAICompatible creates a transcriber for a self-hosted server
+// implementing OpenAI's transcription endpoint. Unlike OpenAI's own API,
+// such servers usually take no API key, so apiKey may be empty.
+func NewOpenAICompatible(cfg config.OpenAICompatibleTranscriptionConfig, apiKey string, policy retry.Policy) *OpenAI {
+	return &OpenAI{
+		apiKey:   apiKey,
+		model:    cfg.Model,
+		language: cfg.Language,
+		baseURL:  strings.TrimSuffix(cfg.BaseURL, "/"),
+		client:   &http.Client{},
+		policy:   policy,
 	}
 }
 
-// openaiResponse represents the API response from OpenAI Whisper.
+// openaiResponse represents the API response from OpenAI Whisper. Segments
+// is only present with response_format=verbose_json; start and end are in
+// seconds from the start of the file.
 type openaiResponse struct {
-	Text string `json:"text"`
+	Text     string `json:"text"`
+	Segments []struct {
+		Start float64 `json:"start"`
+		End   float64 `json:"end"`
+		Text  string  `json:"text"`
+	} `json:"segments"`
+}
+
+// supportsVerboseJSON reports whether model accepts
+// response_format=verbose_json, the only format that carries segment
+// timing. The gpt-4o transcription models reject it outright and only
+// return plain json, so they're transcribed without segments.
+func supportsVerboseJSON(model string) bool {
+	return !strings.HasPrefix(model, "gpt-4o")
+}
+
+// segments converts the response's segments to Segments, skipping ones
+// with no text.
+func (r openaiResponse) segments() []Segment {
+	var out []Segment
+	for _, s := range r.Segments {
+		text := strings.TrimSpace(s.Text)
+		if text == "" {
+			continue
+		}
+		out = append(out, Segment{
+			Start: time.Duration(s.Start * float64(time.Second)),
+			End:   time.Duration(s.End * float64(time.Second)),
+			Text:  text,
+		})
+	}
+	return out
 }
 
 // Transcribe converts audio to text using OpenAI Whisper API.
-func (o *OpenAI) Transcribe(ctx context.Context, audioPath, prompt string) (string, error) {
-	if o.apiKey == "" {
-		return "", fmt.Errorf("OpenAI API key is required")
+func (o *OpenAI) Transcribe(ctx context.Context, audioPath, prompt string) (Result, error) {
+	if o.apiKey == "" && o.baseURL == "" {
+		return Result{}, fmt.Errorf("OpenAI API key is required")
 	}
 
 	if _, err := os.Stat(audioPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("audio file not found at %s", audioPath)
+		return Result{}, fmt.Errorf("audio file not found at %s", audioPath)
 	}
 
 	// Open the audio file
 	file, err := os.Open(audioPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to open audio file: %w", err)
+		return Result{}, fmt.Errorf("failed to open audio file: %w", err)
 	}
 	defer file.Close()
 
@@ -64,68 +120,99 @@ func (o *OpenAI) Transcribe(ctx context.Context, audioPath, prompt string) (stri
 	// Add the file field
 	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
 	if err != nil {
-		return "", fmt.Errorf("failed to create form file: %w", err)
+		return Result{}, fmt.Errorf("failed to create form file: %w", err)
 	}
 	if _, err := io.Copy(part, file); err != nil {
-		return "", fmt.Errorf("failed to copy file data: %w", err)
+		return Result{}, fmt.Errorf("failed to copy file data: %w", err)
 	}
 
-	// Add model field
-	if err := writer.WriteField("model", o.model); err != nil {
-		return "", fmt.Errorf("failed to write model field: %w", err)
+	// Add model field (always set for OpenAI's own API, see New; servers
+	// that only serve one model don't need it)
+	if o.model != "" {
+		if err := writer.WriteField("model", o.model); err != nil {
+			return Result{}, fmt.Errorf("failed to write model field: %w", err)
+		}
 	}
 
 	// Add language field if specified
 	if o.language != "" {
 		if err := writer.WriteField("language", o.language); err != nil {
-			return "", fmt.Errorf("failed to write language field: %w", err)
+			return Result{}, fmt.Errorf("failed to write language field: %w", err)
 		}
 	}
 
 	// Add prompt field if specified, to bias word/spelling choices
 	if prompt != "" {
 		if err := writer.WriteField("prompt", prompt); err != nil {
-			return "", fmt.Errorf("failed to write prompt field: %w", err)
+			return Result{}, fmt.Errorf("failed to write prompt field: %w", err)
+		}
+	}
+
+	// Ask for segment timing where the model supports it
+	if supportsVerboseJSON(o.model) {
+		if err := writer.WriteField("response_format", "verbose_json"); err != nil {
+			return Result{}, fmt.Errorf("failed to write response format field: %w", err)
+		}
+		if err := writer.WriteField("timestamp_granularities[]", "segment"); err != nil {
+			return Result{}, fmt.Errorf("failed to write timestamp granularity field: %w", err)
 		}
 	}
 
 	// Close the writer to finalize the multipart message
 	if err := writer.Close(); err != nil {
-		return "", fmt.Errorf("failed to close multipart writer: %w", err)
+		return Result{}, fmt.Errorf("failed to close multipart writer: %w", err)
 	}
 
+	var result Result
+	err = retry.Do(ctx, o.policy, func(ctx context.Context) error {
+		var err error
+		result, err = o.send(ctx, buf.Bytes(), writer.FormDataContentType())
+		return err
+	})
+	return result, err
+}
+
+// send makes a single request to the transcription endpoint with the
+// multipart body Transcribe built.
+func (o *OpenAI) send(ctx context.Context, body []byte, contentType string) (Result, error) {
 	// Create HTTP request
-	req, err := http.NewRequestWithContext(ctx, "POST", "https://api.openai.com/v1/audio/transcriptions", &buf)
+	baseURL := o.baseURL
+	if baseURL == "" {
+		baseURL = openaiAPIURL
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", baseURL+"/audio/transcriptions", bytes.NewReader(body))
 	if err != nil {
-		return "", fmt.Errorf("failed to create request: %w", err)
+		return Result{}, fmt.Errorf("failed to create request: %w", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+o.apiKey)
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if o.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+o.apiKey)
+	}
+	req.Header.Set("Content-Type", contentType)
 
 	// Send request
 	resp, err := o.client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
+		return Result{}, retry.FromTransport(fmt.Errorf("failed to send request: %w", err))
 	}
 	defer resp.Body.Close()
 
 	// Read response body
-	body, err := io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return Result{}, retry.FromTransport(fmt.Errorf("failed to read response: %w", err))
 	}
 
 	// Check for non-200 status codes
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("OpenAI API returned status %d: %s", resp.StatusCode, string(body))
+		return Result{}, retry.FromResponse(resp, fmt.Errorf("transcription API at %s returned status %d: %s", baseURL, resp.StatusCode, string(respBody)))
 	}
 
 	// Parse response
 	var result openaiResponse
-	if err := json.Unmarshal(body, &result); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return Result{}, fmt.Errorf("failed to parse response: %w", err)
 	}
 
-	return result.Text, nil
+	return Result{Text: result.Text, Segments: result.segments()}, nil
 }
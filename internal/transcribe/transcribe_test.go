@@ -2,13 +2,72 @@ package transcribe
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
+// TestMain doubles as a fake whisper.cpp server when the test binary is run
+// as one (see TestWhisperServer_StartsAndStopsServer).
+func TestMain(m *testing.M) {
+	if os.Getenv("TRANI_FAKE_WHISPER_SERVER") == "1" {
+		runFakeWhisperServer()
+		return
+	}
+
+	// Keep every test's errlog lines out of the real log; tests that check
+	// what's logged use tempHome.
+	home, err := os.MkdirTemp("", "trani-test-home")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("HOME", home)
+	code := m.Run()
+	os.RemoveAll(home)
+	os.Exit(code)
+}
+
+// tempHome points $HOME at a temp dir for the test, so that errlog writes
+// there rather than to the real log, and returns the log's contents so
+// far each time it's called.
+func tempHome(t *testing.T) func() string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	return func() string {
+		log, _ := os.ReadFile(filepath.Join(home, ".config", "trani", "logs.jsonl"))
+		return string(log)
+	}
+}
+
+// runFakeWhisperServer serves /inference at the --host and --port it's
+// given, like whisper-server.
+func runFakeWhisperServer() {
+	flags := flag.NewFlagSet("whisper-server", flag.ExitOnError)
+	flags.String("m", "", "model")
+	host := flags.String("host", "127.0.0.1", "host")
+	port := flags.String("port", "8080", "port")
+	flags.Parse(os.Args[1:])
+
+	http.HandleFunc("/inference", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"text": " Desde el servidor.", "segments": []}`))
+	})
+	http.ListenAndServe(net.JoinHostPort(*host, *port), nil)
+	os.Exit(1)
+}
+
 // Test New() factory function
 
 func TestNew_EmptyBackend(t *testing.T) {
@@ -343,7 +402,7 @@ func TestNewOpenAI_CreatesClient(t *testing.T) {
 		Language: "en",
 	}
 
-	openai := NewOpenAI(cfg, "test-api-key")
+	openai := NewOpenAI(cfg, "test-api-key", retry.Policy{})
 
 	if openai == nil {
 		t.Fatal("NewOpenAI() returned nil")
@@ -362,3 +421,509 @@ func TestNewOpenAI_CreatesClient(t *testing.T) {
 		t.Error("client should not be nil")
 	}
 }
+
+// Test segments
+
+func TestParseWhisperJSON(t *testing.T) {
+	data := []byte(`{
+		"transcription": [
+			{"timestamps": {"from": "00:00:00,000", "to": "00:00:02,500"}, "offsets": {"from": 0, "to": 2500}, "text": " Hola a todos."},
+			{"timestamps": {"from": "00:00:02,500", "to": "00:00:03,000"}, "offsets": {"from": 2500, "to": 3000}, "text": " "},
+			{"timestamps": {"from": "00:00:03,000", "to": "00:00:05,120"}, "offsets": {"from": 3000, "to": 5120}, "text": " Empecemos."}
+		]
+	}`)
+
+	segments, err := parseWhisperJSON(data)
+	if err != nil {
+		t.Fatalf("parseWhisperJSON failed: %v", err)
+	}
+
+	expected := []Segment{
+		{Start: 0, End: 2500 * time.Millisecond, Text: "Hola a todos."},
+		{Start: 3 * time.Second, End: 5120 * time.Millisecond, Text: "Empecemos."},
+	}
+	if len(segments) != len(expected) {
+		t.Fatalf("expected %d segments (blank one skipped), got %d", len(expected), len(segments))
+	}
+	for i, e := range expected {
+		if segments[i] != e {
+			t.Errorf("segment %d: expected %+v, got %+v", i, e, segments[i])
+		}
+	}
+}
+
+func TestOpenAIResponseSegments(t *testing.T) {
+	var resp openaiResponse
+	body := `{"text": "Hola. Empecemos.", "segments": [
+		{"id": 0, "start": 0.0, "end": 1.5, "text": " Hola."},
+		{"id": 1, "start": 1.5, "end": 3.25, "text": " Empecemos."}
+	]}`
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	segments := resp.segments()
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments, got %d", len(segments))
+	}
+	if segments[1].Start != 1500*time.Millisecond || segments[1].End != 3250*time.Millisecond || segments[1].Text != "Empecemos." {
+		t.Errorf("unexpected second segment: %+v", segments[1])
+	}
+}
+
+func TestOffsetShiftsSegments(t *testing.T) {
+	segments := []Segment{{Start: time.Second, End: 2 * time.Second, Text: "a"}}
+
+	shifted := Offset(segments, 5*time.Minute)
+
+	if shifted[0].Start != 5*time.Minute+time.Second || shifted[0].End != 5*time.Minute+2*time.Second {
+		t.Errorf("unexpected shifted segment: %+v", shifted[0])
+	}
+	if segments[0].Start != time.Second {
+		t.Error("Offset should not modify its input")
+	}
+}
+
+func TestSupportsVerboseJSON(t *testing.T) {
+	if !supportsVerboseJSON("whisper-1") {
+		t.Error("whisper-1 should support verbose_json")
+	}
+	if supportsVerboseJSON("gpt-4o-transcribe") {
+		t.Error("gpt-4o-transcribe should not support verbose_json")
+	}
+}
+
+// Test OpenAI-compatible servers
+
+func TestNew_OpenAICompatibleBackend(t *testing.T) {
+	cfg := config.TranscriptionConfig{Backend: "openai_compatible"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when base_url is not configured")
+	}
+
+	cfg.OpenAICompatible = config.OpenAICompatibleTranscriptionConfig{BaseURL: "http://whisper.office:8000/v1/", APIKeyEnv: "TRANI_TEST_WHISPER_KEY"}
+	t.Setenv("TRANI_TEST_WHISPER_KEY", "")
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when the API key variable is empty")
+	}
+
+	t.Setenv("TRANI_TEST_WHISPER_KEY", "office-key")
+	transcriber, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() should not error with valid config: %v", err)
+	}
+	client := transcriber.(*OpenAI)
+	if client.baseURL != "http://whisper.office:8000/v1" || client.apiKey != "office-key" {
+		t.Errorf("unexpected client: baseURL %q, apiKey %q", client.baseURL, client.apiKey)
+	}
+}
+
+func TestOpenAICompatible_Transcribe(t *testing.T) {
+	cases := []struct {
+		name   string
+		apiKey string
+		model  string
+	}{
+		{"no API key or model", "", ""},
+		{"with API key and model", "office-key", "Systran/faster-whisper-large-v3"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/v1/audio/transcriptions" {
+					t.Errorf("unexpected path %s", r.URL.Path)
+				}
+				expectedAuth := ""
+				if c.apiKey != "" {
+					expectedAuth = "Bearer " + c.apiKey
+				}
+				if auth := r.Header.Get("Authorization"); auth != expectedAuth {
+					t.Errorf("expected Authorization %q, got %q", expectedAuth, auth)
+				}
+				if err := r.ParseMultipartForm(1 << 20); err != nil {
+					t.Errorf("failed to parse form: %v", err)
+					return
+				}
+				if model := r.FormValue("model"); model != c.model {
+					t.Errorf("expected model %q, got %q", c.model, model)
+				}
+				if r.FormValue("language") != "es" {
+					t.Errorf("expected language es, got %q", r.FormValue("language"))
+				}
+				w.Write([]byte(`{"text": "Hola.", "segments": [{"start": 0.0, "end": 1.5, "text": " Hola."}]}`))
+			}))
+			defer server.Close()
+
+			audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+			if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+				t.Fatalf("Failed to create test audio file: %v", err)
+			}
+
+			client := NewOpenAICompatible(config.OpenAICompatibleTranscriptionConfig{
+				BaseURL:  server.URL + "/v1",
+				Model:    c.model,
+				Language: "es",
+			}, c.apiKey, retry.Policy{})
+
+			result, err := client.Transcribe(context.Background(), audioPath, "")
+			if err != nil {
+				t.Fatalf("Transcribe() failed: %v", err)
+			}
+			if result.Text != "Hola." || len(result.Segments) != 1 || result.Segments[0].End != 1500*time.Millisecond {
+				t.Errorf("unexpected result: %+v", result)
+			}
+		})
+	}
+}
+
+func TestOpenAICompatible_TranscribeErrorStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "model not loaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	client := NewOpenAICompatible(config.OpenAICompatibleTranscriptionConfig{BaseURL: server.URL}, "", retry.Policy{})
+	if _, err := client.Transcribe(context.Background(), audioPath, ""); err == nil {
+		t.Fatal("Transcribe() should error on a non-200 status")
+	}
+}
+
+func TestOpenAICompatible_TranscribeRetriesRateLimit(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if err := r.ParseMultipartForm(1 << 20); err != nil || r.FormValue("language") != "es" {
+			t.Errorf("attempt %d: expected the full request again, got %v", calls, err)
+		}
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "rate limited", http.StatusTooManyRequests)
+			return
+		}
+		w.Write([]byte(`{"text": "Hola."}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	policy := retry.Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Second}
+	client := NewOpenAICompatible(config.OpenAICompatibleTranscriptionConfig{BaseURL: server.URL, Language: "es"}, "", policy)
+	result, err := client.Transcribe(context.Background(), audioPath, "")
+	if err != nil {
+		t.Fatalf("Transcribe() failed: %v", err)
+	}
+	if result.Text != "Hola." || calls != 2 {
+		t.Errorf("expected the text after one retry, got %q after %d calls", result.Text, calls)
+	}
+}
+
+// Test whisper.cpp server
+
+func TestNew_WhisperServerBackend(t *testing.T) {
+	cfg := config.TranscriptionConfig{Backend: "whisper_server"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when url is not configured")
+	}
+
+	cfg.WhisperServer = config.WhisperServerConfig{URL: "http://127.0.0.1:8178", BinaryPath: "/usr/bin/whisper-server"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when binary_path is set without model_path")
+	}
+
+	cfg.WhisperServer.ModelPath = "/models/ggml-large-v3-turbo.bin"
+	transcriber, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() should not error with valid config: %v", err)
+	}
+	if _, ok := transcriber.(*WhisperServer); !ok {
+		t.Errorf("expected *WhisperServer, got %T", transcriber)
+	}
+}
+
+func TestWhisperServer_Transcribe(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/inference" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("failed to parse form: %v", err)
+			return
+		}
+		if r.FormValue("response_format") != "verbose_json" {
+			t.Errorf("expected verbose_json, got %q", r.FormValue("response_format"))
+		}
+		if r.FormValue("language") != "es" {
+			t.Errorf("expected language es, got %q", r.FormValue("language"))
+		}
+		if r.FormValue("prompt") != "Trani" {
+			t.Errorf("expected prompt Trani, got %q", r.FormValue("prompt"))
+		}
+		w.Write([]byte(`{"text": " Hola.\n", "segments": [{"start": 0.0, "end": 1.5, "text": " Hola."}]}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	client, err := NewWhisperServer(config.WhisperServerConfig{URL: server.URL + "/", Language: "es"}, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewWhisperServer() failed: %v", err)
+	}
+	defer client.Close()
+
+	result, err := client.Transcribe(context.Background(), audioPath, "Trani")
+	if err != nil {
+		t.Fatalf("Transcribe() failed: %v", err)
+	}
+	if result.Text != "Hola." || len(result.Segments) != 1 || result.Segments[0].End != 1500*time.Millisecond {
+		t.Errorf("unexpected result: %+v", result)
+	}
+}
+
+func TestWhisperServer_TranscribeErrorField(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"error": "failed to read WAV file"}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	client, err := NewWhisperServer(config.WhisperServerConfig{URL: server.URL}, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewWhisperServer() failed: %v", err)
+	}
+	if _, err := client.Transcribe(context.Background(), audioPath, ""); err == nil {
+		t.Fatal("Transcribe() should error when the server reports an error")
+	}
+}
+
+func TestWhisperServer_UsesRunningServer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"text": "Hola."}`))
+	}))
+	defer server.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	// A server already answering is used even though the binary that
+	// would start one doesn't exist.
+	client, err := NewWhisperServer(config.WhisperServerConfig{
+		URL:        server.URL,
+		BinaryPath: "/nonexistent/whisper-server",
+		ModelPath:  "/nonexistent/model.bin",
+	}, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewWhisperServer() failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Transcribe(context.Background(), audioPath, ""); err != nil {
+		t.Fatalf("Transcribe() failed: %v", err)
+	}
+	if client.process != nil {
+		t.Error("expected no server to be started")
+	}
+}
+
+func TestWhisperServer_StartsAndStopsServer(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	modelPath := filepath.Join(t.TempDir(), "model.bin")
+	if err := os.WriteFile(modelPath, []byte("dummy model"), 0644); err != nil {
+		t.Fatalf("Failed to create test model file: %v", err)
+	}
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	binaryPath, err := os.Executable()
+	if err != nil {
+		t.Fatalf("failed to find test binary: %v", err)
+	}
+	t.Setenv("TRANI_FAKE_WHISPER_SERVER", "1")
+
+	client, err := NewWhisperServer(config.WhisperServerConfig{
+		URL:        "http://" + addr,
+		BinaryPath: binaryPath,
+		ModelPath:  modelPath,
+	}, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewWhisperServer() failed: %v", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		result, err := client.Transcribe(context.Background(), audioPath, "")
+		if err != nil {
+			t.Fatalf("Transcribe() failed: %v", err)
+		}
+		if result.Text != "Desde el servidor." {
+			t.Errorf("unexpected text %q", result.Text)
+		}
+	}
+	process := client.process
+	if process == nil {
+		t.Fatal("expected the server to be started")
+	}
+
+	if err := client.Close(); err != nil {
+		t.Fatalf("Close() failed: %v", err)
+	}
+	if process.ProcessState == nil {
+		t.Error("expected the server to have exited")
+	}
+	if client.reachable(context.Background()) {
+		t.Error("expected nothing listening after Close")
+	}
+}
+
+func TestWhisperServer_StartMissingBinary(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+
+	audioPath := filepath.Join(t.TempDir(), "chunk.wav")
+	if err := os.WriteFile(audioPath, []byte("dummy audio"), 0644); err != nil {
+		t.Fatalf("Failed to create test audio file: %v", err)
+	}
+
+	client, err := NewWhisperServer(config.WhisperServerConfig{
+		URL:        "http://" + addr,
+		BinaryPath: "/nonexistent/whisper-server",
+		ModelPath:  "/nonexistent/model.bin",
+	}, retry.Policy{})
+	if err != nil {
+		t.Fatalf("NewWhisperServer() failed: %v", err)
+	}
+	if _, err := client.Transcribe(context.Background(), audioPath, ""); err == nil {
+		t.Fatal("Transcribe() should error when the server can't be started")
+	}
+}
+
+// Test fallback chains
+
+// scriptedTranscriber fails with err if set, and otherwise returns text.
+type scriptedTranscriber struct {
+	text  string
+	err   error
+	calls int
+}
+
+func (s *scriptedTranscriber) Transcribe(ctx context.Context, audioPath, prompt string) (Result, error) {
+	s.calls++
+	if s.err != nil {
+		return Result{}, s.err
+	}
+	return Result{Text: s.text}, nil
+}
+
+func TestNew_FallbackChain(t *testing.T) {
+	cfg := config.TranscriptionConfig{
+		Backend:          "openai_compatible",
+		Fallback:         []string{"local"},
+		OpenAICompatible: config.OpenAICompatibleTranscriptionConfig{BaseURL: "http://whisper.office:8000/v1"},
+		Local:            config.LocalWhisperConfig{BinaryPath: "/usr/bin/whisper-cli", ModelPath: "/models/ggml-base.bin"},
+	}
+	transcriber, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() should not error with valid config: %v", err)
+	}
+	chain, ok := transcriber.(*Fallback)
+	if !ok || !slices.Equal(chain.names, []string{"openai_compatible", "local"}) {
+		t.Fatalf("expected a openai_compatible -> local chain, got %#v", transcriber)
+	}
+
+	cfg.Fallback = []string{"local", "openai_compatible"}
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when a backend is listed twice")
+	}
+
+	cfg.Fallback = []string{"openai"}
+	t.Setenv("OPENAI_API_KEY", "")
+	if _, err := New(cfg); err == nil {
+		t.Error("New() should return error when a fallback backend is misconfigured")
+	}
+}
+
+func TestFallback_TranscribeFallsBackOnRetryableErrors(t *testing.T) {
+	log := tempHome(t)
+	primary := &scriptedTranscriber{err: &retry.Error{Kind: retry.RateLimit, StatusCode: 429, Err: errors.New("insufficient_quota")}}
+	secondary := &scriptedTranscriber{text: "Hola."}
+	chain := &Fallback{names: []string{"openai", "local"}, backends: []Transcriber{primary, secondary}}
+
+	result, err := chain.Transcribe(context.Background(), "chunk.wav", "")
+	if err != nil {
+		t.Fatalf("Transcribe() failed: %v", err)
+	}
+	if result.Text != "Hola." || result.Backend != "local" {
+		t.Errorf("expected the fallback's text and name, got %+v", result)
+	}
+	if !strings.Contains(log(), `"event":"transcription_fallback"`) || !strings.Contains(log(), `"next":"local"`) {
+		t.Errorf("expected the fallback logged, got %q", log())
+	}
+}
+
+func TestFallback_TranscribeFallsBackOnAuthErrors(t *testing.T) {
+	primary := &scriptedTranscriber{err: &retry.Error{Kind: retry.Auth, StatusCode: 401, Err: errors.New("Incorrect API key provided")}}
+	secondary := &scriptedTranscriber{text: "Hola."}
+	chain := &Fallback{names: []string{"openai", "local"}, backends: []Transcriber{primary, secondary}}
+
+	result, err := chain.Transcribe(context.Background(), "chunk.wav", "")
+	if err != nil {
+		t.Fatalf("Transcribe() failed: %v", err)
+	}
+	if result.Text != "Hola." || result.Backend != "local" {
+		t.Errorf("expected local whisper to transcribe after openai's 401, got %+v", result)
+	}
+}
+
+func TestFallback_TranscribeStopsOnPermanentErrors(t *testing.T) {
+	primary := &scriptedTranscriber{err: &retry.Error{Kind: retry.Client, StatusCode: 400, Err: errors.New("Invalid file format")}}
+	secondary := &scriptedTranscriber{text: "Hola."}
+	chain := &Fallback{names: []string{"openai", "local"}, backends: []Transcriber{primary, secondary}}
+
+	if _, err := chain.Transcribe(context.Background(), "chunk.wav", ""); err == nil {
+		t.Fatal("Transcribe() should return the primary's permanent error")
+	}
+	if secondary.calls != 0 {
+		t.Error("the fallback shouldn't be tried after a permanent error")
+	}
+}
+
+func TestFallback_TranscribeAllFail(t *testing.T) {
+	outage := &retry.Error{Kind: retry.Server, StatusCode: 503, Err: errors.New("unavailable")}
+	chain := &Fallback{
+		names:    []string{"openai", "openai_compatible"},
+		backends: []Transcriber{&scriptedTranscriber{err: outage}, &scriptedTranscriber{err: outage}},
+	}
+
+	_, err := chain.Transcribe(context.Background(), "chunk.wav", "")
+	if !retry.IsRetryable(err) {
+		t.Errorf("expected the last backend's error, got %v", err)
+	}
+}
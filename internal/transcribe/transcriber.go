@@ -3,26 +3,84 @@ package transcribe
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
 )
 
 // Transcriber converts audio files to text. prompt, when non-empty, is fed
 // to the model as prior context to bias word/spelling choices (e.g. proper
-// nouns) on ambiguous audio; both backends treat "" as no prompt.
+// nouns) on ambiguous audio; every backend treats "" as no prompt.
 type Transcriber interface {
-	Transcribe(ctx context.Context, audioPath, prompt string) (string, error)
+	Transcribe(ctx context.Context, audioPath, prompt string) (Result, error)
 }
 
-// New creates a Transcriber based on the configured backend.
-// Returns error if backend is unknown or required configuration is missing.
+// Result is a transcription of one audio file. Text is the plain
+// transcript, exactly as the backend produced it; Segments carries the same
+// speech with timing, relative to the start of that file. A backend that
+// can't report timing leaves Segments empty. Backend names the backend
+// that produced it when it came through a Fallback chain, and is empty
+// otherwise.
+type Result struct {
+	Text     string
+	Segments []Segment
+	Backend  string
+}
+
+// Segment is one timed stretch of transcribed speech.
+type Segment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// Offset returns a copy of segments shifted later by d, e.g. to place a
+// chunk's segments at the chunk's position within the whole session.
+func Offset(segments []Segment, d time.Duration) []Segment {
+	out := make([]Segment, len(segments))
+	for i, s := range segments {
+		out[i] = Segment{Start: s.Start + d, End: s.End + d, Text: s.Text}
+	}
+	return out
+}
+
+// New creates a Transcriber based on the configured backend, or a Fallback
+// chain of it and the backends in cfg.Fallback.
+// Returns error if a backend is unknown or required configuration is missing.
 func New(cfg config.TranscriptionConfig) (Transcriber, error) {
 	if cfg.Backend == "" {
 		return nil, fmt.Errorf("transcription backend not configured")
 	}
+	if len(cfg.Fallback) == 0 {
+		return newBackend(cfg, cfg.Backend)
+	}
+
+	names := append([]string{cfg.Backend}, cfg.Fallback...)
+	backends := make([]Transcriber, 0, len(names))
+	for i, name := range names {
+		if slices.Contains(names[:i], name) {
+			return nil, fmt.Errorf("transcription backend %s listed twice in the fallback chain", name)
+		}
+		backend, err := newBackend(cfg, name)
+		if err != nil {
+			return nil, fmt.Errorf("fallback %s: %w", name, err)
+		}
+		backends = append(backends, backend)
+	}
+	return &Fallback{names: names, backends: backends}, nil
+}
 
-	switch cfg.Backend {
+// newBackend creates the Transcriber for one backend, with its settings
+// from cfg.
+func newBackend(cfg config.TranscriptionConfig, backend string) (Transcriber, error) {
+	// whisper.cpp's CLI isn't an API call: a failed run fails the same way
+	// again, so only the HTTP backends retry.
+	policy := retry.NewPolicy(cfg.Retry)
+	switch backend {
 	case "local":
 		return NewWhisperLocal(cfg.Local)
 	case "openai":
@@ -33,8 +91,32 @@ func New(cfg config.TranscriptionConfig) (Transcriber, error) {
 		if cfg.OpenAI.Model == "" {
 			return nil, fmt.Errorf("OpenAI model not configured")
 		}
-		return NewOpenAI(cfg.OpenAI, apiKey), nil
+		return NewOpenAI(cfg.OpenAI, apiKey, policy), nil
+	case "openai_compatible":
+		if cfg.OpenAICompatible.BaseURL == "" {
+			return nil, fmt.Errorf("openai_compatible base_url not configured")
+		}
+		var apiKey string
+		if cfg.OpenAICompatible.APIKeyEnv != "" {
+			apiKey = os.Getenv(cfg.OpenAICompatible.APIKeyEnv)
+			if apiKey == "" {
+				return nil, fmt.Errorf("%s environment variable not set", cfg.OpenAICompatible.APIKeyEnv)
+			}
+		}
+		return NewOpenAICompatible(cfg.OpenAICompatible, apiKey, policy), nil
+	case "whisper_server":
+		return NewWhisperServer(cfg.WhisperServer, policy)
 	default:
-		return nil, fmt.Errorf("unknown transcription backend: %s (supported: local, openai)", cfg.Backend)
+		return nil, fmt.Errorf("unknown transcription backend: %s (supported: local, openai, openai_compatible, whisper_server)", backend)
+	}
+}
+
+// Close releases whatever t holds on to between transcriptions, such as a
+// whisper.cpp server it started. It's a no-op for backends that hold
+// nothing, so callers can close any Transcriber once done with it.
+func Close(t Transcriber) error {
+	if closer, ok := t.(io.Closer); ok {
+		return closer.Close()
 	}
+	return nil
 }
@@ -2,12 +2,14 @@ package transcribe
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/sabhz/trani/internal/config"
 )
@@ -38,18 +40,56 @@ func NewWhisperLocal(cfg config.LocalWhisperConfig) (*WhisperLocal, error) {
 	}, nil
 }
 
-// Transcribe converts audio to text using local whisper.cpp.
-func (w *WhisperLocal) Transcribe(ctx context.Context, audioPath, prompt string) (string, error) {
+// whisperJSON is the subset of whisper.cpp's -oj output trani reads:
+// one entry per segment, with offsets in milliseconds from the start of
+// the file.
+type whisperJSON struct {
+	Transcription []struct {
+		Offsets struct {
+			From int64 `json:"from"`
+			To   int64 `json:"to"`
+		} `json:"offsets"`
+		Text string `json:"text"`
+	} `json:"transcription"`
+}
+
+// parseWhisperJSON extracts timed segments from whisper.cpp's -oj output,
+// skipping segments with no text.
+func parseWhisperJSON(data []byte) ([]Segment, error) {
+	var out whisperJSON
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+
+	var segments []Segment
+	for _, entry := range out.Transcription {
+		text := strings.TrimSpace(entry.Text)
+		if text == "" {
+			continue
+		}
+		segments = append(segments, Segment{
+			Start: time.Duration(entry.Offsets.From) * time.Millisecond,
+			End:   time.Duration(entry.Offsets.To) * time.Millisecond,
+			Text:  text,
+		})
+	}
+	return segments, nil
+}
+
+// Transcribe converts audio to text using local whisper.cpp. The plain
+// text comes from -otxt, as it always has, so it's unaffected by how
+// segments are parsed from the -oj output written alongside it.
+func (w *WhisperLocal) Transcribe(ctx context.Context, audioPath, prompt string) (Result, error) {
 	if _, err := os.Stat(w.binaryPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("whisper binary not found at %s", w.binaryPath)
+		return Result{}, fmt.Errorf("whisper binary not found at %s", w.binaryPath)
 	}
 
 	if _, err := os.Stat(w.modelPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("whisper model not found at %s", w.modelPath)
+		return Result{}, fmt.Errorf("whisper model not found at %s", w.modelPath)
 	}
 
 	if _, err := os.Stat(audioPath); os.IsNotExist(err) {
-		return "", fmt.Errorf("audio file not found at %s", audioPath)
+		return Result{}, fmt.Errorf("audio file not found at %s", audioPath)
 	}
 
 	outputDir := filepath.Dir(audioPath)
@@ -61,6 +101,7 @@ func (w *WhisperLocal) Transcribe(ctx context.Context, audioPath, prompt string)
 		"-l", w.language,
 		"-t", strconv.Itoa(w.threads),
 		"-otxt",
+		"-oj",
 		"-of", outputBase,
 	}
 	if prompt != "" {
@@ -70,16 +111,27 @@ func (w *WhisperLocal) Transcribe(ctx context.Context, audioPath, prompt string)
 	cmd := exec.CommandContext(ctx, w.binaryPath, args...)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		return "", fmt.Errorf("whisper transcription failed: %w\nOutput: %s", err, string(output))
+		return Result{}, fmt.Errorf("whisper transcription failed: %w\nOutput: %s", err, string(output))
 	}
 
 	transcriptionPath := outputBase + ".txt"
+	jsonPath := outputBase + ".json"
+	defer os.Remove(transcriptionPath)
+	defer os.Remove(jsonPath)
+
 	content, err := os.ReadFile(transcriptionPath)
 	if err != nil {
-		return "", fmt.Errorf("failed to read transcription file: %w", err)
+		return Result{}, fmt.Errorf("failed to read transcription file: %w", err)
 	}
 
-	os.Remove(transcriptionPath)
+	jsonContent, err := os.ReadFile(jsonPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to read transcription segments: %w", err)
+	}
+	segments, err := parseWhisperJSON(jsonContent)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to parse transcription segments: %w", err)
+	}
 
-	return strings.TrimSpace(string(content)), nil
+	return Result{Text: strings.TrimSpace(string(content)), Segments: segments}, nil
 }
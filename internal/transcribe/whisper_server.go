@@ -0,0 +1,336 @@
+package transcribe
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/sabhz/trani/internal/config"
+	"github.com/sabhz/trani/internal/retry"
+)
+
+const (
+	// whisperServerStartTimeout is how long a server trani starts gets to
+	// load its model and start listening. Large models take a while to
+	// read from a cold disk.
+	whisperServerStartTimeout = 2 * time.Minute
+
+	// whisperServerStopTimeout is how long a server trani started gets to
+	// exit after SIGTERM before it's killed.
+	whisperServerStopTimeout = 5 * time.Second
+)
+
+// WhisperServer implements Transcriber using a whisper.cpp server's
+// /inference endpoint, which keeps its model in memory across chunks. When
+// configured with a binary and model, it starts the server the first time
+// it's needed and owns it until Close.
+type WhisperServer struct {
+	url      string
+	language string
+	client   *http.Client
+	policy   retry.Policy
+
+	binaryPath string
+	modelPath  string
+	threads    int
+
+	mu      sync.Mutex
+	process *exec.Cmd     // the server this transcriber started, if any
+	exited  chan struct{} // closed once process exits
+}
+
+// NewWhisperServer creates a new WhisperServer transcriber.
+// Returns error if the URL is invalid, or a binary is configured without a
+// model to load.
+func NewWhisperServer(cfg config.WhisperServerConfig, policy retry.Policy) (*WhisperServer, error) {
+	if cfg.URL == "" {
+		return nil, fmt.Errorf("whisper_server url not configured")
+	}
+	if _, err := url.Parse(cfg.URL); err != nil {
+		return nil, fmt.Errorf("invalid whisper_server url: %w", err)
+	}
+	if cfg.BinaryPath != "" && cfg.ModelPath == "" {
+		return nil, fmt.Errorf("whisper model path not configured")
+	}
+
+	return &WhisperServer{
+		url:        strings.TrimSuffix(cfg.URL, "/"),
+		language:   cfg.Language,
+		client:     &http.Client{},
+		policy:     policy,
+		binaryPath: cfg.BinaryPath,
+		modelPath:  cfg.ModelPath,
+		threads:    cfg.Threads,
+	}, nil
+}
+
+// Transcribe converts audio to text by posting it to the server's
+// /inference endpoint, starting the server first if this transcriber owns
+// it and it isn't running.
+func (w *WhisperServer) Transcribe(ctx context.Context, audioPath, prompt string) (Result, error) {
+	if _, err := os.Stat(audioPath); os.IsNotExist(err) {
+		return Result{}, fmt.Errorf("audio file not found at %s", audioPath)
+	}
+
+	file, err := os.Open(audioPath)
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to open audio file: %w", err)
+	}
+	defer file.Close()
+
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+
+	part, err := writer.CreateFormFile("file", filepath.Base(audioPath))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create form file: %w", err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		return Result{}, fmt.Errorf("failed to copy file data: %w", err)
+	}
+
+	// verbose_json is the only format carrying both the text and segment
+	// timing, in the same shape as OpenAI's API.
+	fields := map[string]string{"response_format": "verbose_json"}
+	if w.language != "" {
+		fields["language"] = w.language
+	}
+	if prompt != "" {
+		fields["prompt"] = prompt
+	}
+	for name, value := range fields {
+		if err := writer.WriteField(name, value); err != nil {
+			return Result{}, fmt.Errorf("failed to write %s field: %w", name, err)
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return Result{}, fmt.Errorf("failed to close multipart writer: %w", err)
+	}
+
+	var result Result
+	err = retry.Do(ctx, w.policy, func(ctx context.Context) error {
+		var err error
+		result, err = w.send(ctx, buf.Bytes(), writer.FormDataContentType())
+		return err
+	})
+	return result, err
+}
+
+// send makes a single request to /inference with the multipart body
+// Transcribe built. The server is (re)started first if needed, so a retry
+// after it died mid-session brings it back.
+func (w *WhisperServer) send(ctx context.Context, body []byte, contentType string) (Result, error) {
+	if err := w.ensureRunning(ctx); err != nil {
+		return Result{}, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", w.url+"/inference", bytes.NewReader(body))
+	if err != nil {
+		return Result{}, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return Result{}, retry.FromTransport(fmt.Errorf("failed to send request to whisper server: %w", err))
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Result{}, retry.FromTransport(fmt.Errorf("failed to read response: %w", err))
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return Result{}, retry.FromResponse(resp, fmt.Errorf("whisper server at %s returned status %d: %s", w.url, resp.StatusCode, string(respBody)))
+	}
+
+	// The server reports failures it catches as 200 {"error": "..."}.
+	var result struct {
+		openaiResponse
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return Result{}, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if result.Error != "" {
+		return Result{}, fmt.Errorf("whisper server at %s failed: %s", w.url, result.Error)
+	}
+
+	return Result{Text: strings.TrimSpace(result.Text), Segments: result.segments()}, nil
+}
+
+// ensureRunning starts the server if this transcriber is configured to own
+// one and it isn't running, either because it was never started or because
+// it died since. A server already answering at the URL (another trani's, or
+// one started by hand) is used as is.
+func (w *WhisperServer) ensureRunning(ctx context.Context) error {
+	if w.binaryPath == "" {
+		return nil
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.process != nil {
+		select {
+		case <-w.exited:
+			w.process = nil
+		default:
+			return nil
+		}
+	}
+
+	if w.reachable(ctx) {
+		return nil
+	}
+	return w.start(ctx)
+}
+
+// start runs the server and waits until it accepts connections, which it
+// only does once its model is loaded.
+func (w *WhisperServer) start(ctx context.Context) error {
+	if _, err := os.Stat(w.binaryPath); os.IsNotExist(err) {
+		return fmt.Errorf("whisper server binary not found at %s", w.binaryPath)
+	}
+	if _, err := os.Stat(w.modelPath); os.IsNotExist(err) {
+		return fmt.Errorf("whisper model not found at %s", w.modelPath)
+	}
+
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return fmt.Errorf("invalid whisper_server url: %w", err)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+	}
+
+	args := []string{"-m", w.modelPath, "--host", u.Hostname(), "--port", port}
+	if w.threads > 0 {
+		args = append(args, "-t", strconv.Itoa(w.threads))
+	}
+
+	// Not tied to ctx: the server outlives the chunk that started it and is
+	// stopped by Close. Pdeathsig stops it if trani dies without closing it,
+	// so it doesn't hold the port and the model's memory forever.
+	cmd := exec.Command(w.binaryPath, args...)
+	output := &tailWriter{max: 4096}
+	cmd.Stdout = output
+	cmd.Stderr = output
+	cmd.SysProcAttr = &syscall.SysProcAttr{Pdeathsig: syscall.SIGTERM}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start whisper server: %w", err)
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(exited)
+	}()
+	w.process, w.exited = cmd, exited
+
+	deadline := time.Now().Add(whisperServerStartTimeout)
+	for !w.reachable(ctx) {
+		select {
+		case <-exited:
+			w.process = nil
+			return fmt.Errorf("whisper server exited while starting\nOutput: %s", output.String())
+		case <-ctx.Done():
+			w.stop()
+			return ctx.Err()
+		case <-time.After(250 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			w.stop()
+			return fmt.Errorf("whisper server didn't start listening at %s within %s\nOutput: %s", w.url, whisperServerStartTimeout, output.String())
+		}
+	}
+	return nil
+}
+
+// reachable reports whether something accepts connections at the server's
+// address.
+func (w *WhisperServer) reachable(ctx context.Context) bool {
+	u, err := url.Parse(w.url)
+	if err != nil {
+		return false
+	}
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "80")
+	}
+
+	dialer := net.Dialer{Timeout: time.Second}
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// Close stops the server this transcriber started, if any. A server it
+// merely found running is left alone.
+func (w *WhisperServer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.stop()
+	return nil
+}
+
+// stop asks the owned server to exit and waits for it, killing it if it
+// takes too long. Callers hold w.mu.
+func (w *WhisperServer) stop() {
+	if w.process == nil {
+		return
+	}
+	w.process.Process.Signal(syscall.SIGTERM)
+	select {
+	case <-w.exited:
+	case <-time.After(whisperServerStopTimeout):
+		w.process.Process.Kill()
+		<-w.exited
+	}
+	w.process = nil
+}
+
+// tailWriter keeps the last max bytes written to it: enough of a server's
+// output to explain why it failed to start, without growing for as long as
+// it runs.
+type tailWriter struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+func (t *tailWriter) Write(p []byte) (int, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.buf = append(t.buf, p...)
+	if len(t.buf) > t.max {
+		t.buf = t.buf[len(t.buf)-t.max:]
+	}
+	return len(p), nil
+}
+
+func (t *tailWriter) String() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return string(t.buf)
+}
@@ -1,6 +1,7 @@
 package errlog
 
 import (
+	"errors"
 	"io"
 	"log/slog"
 	"os"
@@ -8,29 +9,78 @@ import (
 	"sync"
 )
 
-var once sync.Once
-var logger *slog.Logger
+var (
+	mu      sync.Mutex
+	logPath string
+	logFile *os.File
+	logger  *slog.Logger
+)
 
+// get returns the logger for the current $HOME's log file, opening it the
+// first time and again whenever $HOME changes (as it does in tests, which
+// point it at a temp dir so they don't write to the real log).
 func get() *slog.Logger {
-	once.Do(func() {
-		path := filepath.Join(os.Getenv("HOME"), ".config", "trani", "logs.jsonl")
-		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
-			logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
-			return
-		}
-		f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
-		if err != nil {
-			logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
-			return
-		}
-		logger = slog.New(slog.NewJSONHandler(f, nil))
-	})
+	path := filepath.Join(os.Getenv("HOME"), ".config", "trani", "logs.jsonl")
+
+	mu.Lock()
+	defer mu.Unlock()
+	if logger != nil && path == logPath {
+		return logger
+	}
+	if logFile != nil {
+		logFile.Close()
+		logFile = nil
+	}
+	logPath = path
+	logger = slog.New(slog.NewJSONHandler(io.Discard, nil))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return logger
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return logger
+	}
+	logFile = f
+	logger = slog.New(slog.NewJSONHandler(f, nil))
 	return logger
 }
 
+// classified is implemented by errors that know what kind of failure they
+// are, such as failed API calls (internal/retry.Error).
+type classified interface {
+	error
+	ErrorKind() string
+	Retryable() bool
+}
+
 // Error appends one JSON line to ~/.config/trani/logs.jsonl. Best-effort:
 // if the log file can't be opened, the line is silently discarded — this
-// is a debugging aid, not something that should ever break the app.
+// is a debugging aid, not something that should ever break the app. A
+// classified err also records its kind and whether it was retryable, to
+// tell an outage apart from a bad key or request.
 func Error(event, session string, err error) {
-	get().Error(err.Error(), "event", event, "session", session)
+	get().Error(err.Error(), errorArgs(event, session, err)...)
+}
+
+// Warn is Error for a failure that was worked around, such as a call that
+// is about to be retried or a backend that was fallen back from, so that
+// the detached workers, whose stderr goes nowhere, leave a trace of it.
+// attrs are more key-value pairs to record, as with slog.
+func Warn(event, session string, err error, attrs ...any) {
+	get().Warn(err.Error(), append(errorArgs(event, session, err), attrs...)...)
+}
+
+// Info records something that isn't a failure but is worth having next to
+// the ones that led to it, such as a failed chunk transcribed on retry.
+func Info(event, session, msg string, attrs ...any) {
+	get().Info(msg, append([]any{"event", event, "session", session}, attrs...)...)
+}
+
+func errorArgs(event, session string, err error) []any {
+	args := []any{"event", event, "session", session}
+	var c classified
+	if errors.As(err, &c) {
+		args = append(args, "kind", c.ErrorKind(), "retryable", c.Retryable())
+	}
+	return args
 }